@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// maxJSONBody is the largest JSON request body accepted, in bytes. File
+// uploads have their own limit.
+const maxJSONBody = 256 << 10
+
+// identityFields are the request body fields that name the acting user.
+var identityFields = []string{"username", "author", "user_id", "from"}
+
+// publicRoutes are the mutating routes that can be called without a token.
+var publicRoutes = map[string]bool{
+	"/register": true,
+	"/login":    true,
+}
+
+// fileRoutes take a file rather than JSON as their body, which is left unread
+// here rather than buffered whole to look for identity fields.
+var fileRoutes = map[string]bool{
+	"/media": true,
+}
+
+// privatePrefixes and privateSuffixes mark the paths whose reads also need a token.
+var (
+	privatePrefixes = []string{"/feed/", "/messages/", "/notifications", "/stream"}
+	privateSuffixes = []string{"/saved"}
+)
+
+// requiresAuth reports whether a request must carry a bearer token.
+func requiresAuth(r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return !publicRoutes[r.URL.Path]
+	}
+	for _, prefix := range privatePrefixes {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			return true
+		}
+	}
+	for _, suffix := range privateSuffixes {
+		if strings.HasSuffix(r.URL.Path, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+type contextKey string
+
+const actingUserKey contextKey = "actingUser" // Holds the verified *tokenClaims.
+
+// TokenSigner issues and verifies HMAC-SHA256 signed bearer tokens.
+type TokenSigner struct {
+	secret []byte
+	ttl    time.Duration
+}
+
+// tokenClaims is the signed payload of a bearer token.
+type tokenClaims struct {
+	Subject    string `json:"sub"`
+	ExpiresAt  int64  `json:"exp"`
+	Registered int64  `json:"reg,omitempty"` // When the user registered, for new-account rate limits.
+}
+
+// NewTokenSigner returns a signer using secret, or a random secret if it is empty.
+// Tokens signed with a random secret stop working when the server restarts.
+func NewTokenSigner(secret string, ttl time.Duration) (*TokenSigner, error) {
+	key := []byte(secret)
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+	}
+	return &TokenSigner{secret: key, ttl: ttl}, nil
+}
+
+// Issue returns a token for username, who registered at registered, and its expiry time.
+func (ts *TokenSigner) Issue(username string, registered time.Time) (string, time.Time) {
+	expiresAt := time.Now().Add(ts.ttl)
+	claims := tokenClaims{Subject: username, ExpiresAt: expiresAt.Unix()}
+	if !registered.IsZero() {
+		claims.Registered = registered.Unix()
+	}
+	payload, _ := json.Marshal(claims)
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + ts.sign(encoded), expiresAt
+}
+
+// Verify checks a token's signature and expiry and returns its claims.
+func (ts *TokenSigner) Verify(token string) (*tokenClaims, error) {
+	encoded, signature, found := strings.Cut(token, ".")
+	if !found || !hmac.Equal([]byte(signature), []byte(ts.sign(encoded))) {
+		return nil, errors.New("invalid token")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, errors.New("invalid token")
+	}
+	var claims tokenClaims
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Subject == "" {
+		return nil, errors.New("invalid token")
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return nil, errors.New("token expired")
+	}
+	return &claims, nil
+}
+
+func (ts *TokenSigner) sign(encoded string) string {
+	mac := hmac.New(sha256.New, ts.secret)
+	mac.Write([]byte(encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// AuthMiddleware requires a valid bearer token on every mutating route except
+// registration and login, and on private reads such as the inbox. The token's
+// user becomes the acting user, and a request whose body names a different
+// user in an identity field is rejected. Public reads may send a token too,
+// to be read as that user; an invalid one is ignored there. Bodies other than
+// file uploads are limited to maxJSONBody.
+func AuthMiddleware(rs *RedditSystem) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !fileRoutes[r.URL.Path] {
+				r.Body = http.MaxBytesReader(w, r.Body, maxJSONBody)
+			}
+			if !requiresAuth(r) {
+				token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+				if claims, err := rs.auth.Verify(token); found && err == nil {
+					r = r.WithContext(context.WithValue(r.Context(), actingUserKey, claims))
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !found {
+				JSONError(w, CodeUnauthorized, "Missing bearer token")
+				return
+			}
+			claims, err := rs.auth.Verify(token)
+			if err != nil {
+				JSONError(w, CodeUnauthorized, err.Error())
+				return
+			}
+
+			if !fileRoutes[r.URL.Path] {
+				body, err := io.ReadAll(r.Body)
+				var tooLarge *http.MaxBytesError
+				if errors.As(err, &tooLarge) {
+					JSONError(w, CodeTooLarge, fmt.Sprintf("Request bodies are limited to %d bytes", maxJSONBody))
+					return
+				}
+				if err != nil {
+					JSONError(w, CodeInvalidRequest, "Invalid request body")
+					return
+				}
+				r.Body = io.NopCloser(bytes.NewReader(body))
+				var fields map[string]interface{}
+				if json.Unmarshal(body, &fields) == nil {
+					for _, name := range identityFields {
+						if value, present := fields[name]; present && value != "" && value != claims.Subject {
+							JSONError(w, CodeForbidden, fmt.Sprintf("%s does not match the authenticated user", name))
+							return
+						}
+					}
+				}
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), actingUserKey, claims)))
+		})
+	}
+}
+
+// actingUser returns the authenticated user of a request, or "" on public routes.
+func actingUser(r *http.Request) string {
+	if claims, ok := r.Context().Value(actingUserKey).(*tokenClaims); ok {
+		return claims.Subject
+	}
+	return ""
+}
+
+// registeredAt returns when the authenticated user of a request registered,
+// or the zero time if it is unknown.
+func registeredAt(r *http.Request) time.Time {
+	if claims, ok := r.Context().Value(actingUserKey).(*tokenClaims); ok && claims.Registered != 0 {
+		return time.Unix(claims.Registered, 0)
+	}
+	return time.Time{}
+}
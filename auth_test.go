@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTokenSignerVerify(t *testing.T) {
+	signer, err := NewTokenSigner("secret", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	registered := time.Unix(1700000000, 0)
+	token, _ := signer.Issue("alice", registered)
+	encoded, signature, _ := strings.Cut(token, ".")
+
+	other, _ := NewTokenSigner("another secret", time.Hour)
+	otherToken, _ := other.Issue("alice", registered)
+	expired, _ := (&TokenSigner{secret: []byte("secret"), ttl: -time.Minute}).Issue("alice", registered)
+	forged := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"mallory","exp":9999999999}`))
+	noSubject := base64.RawURLEncoding.EncodeToString([]byte(`{"exp":9999999999}`))
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr string
+	}{
+		{name: "valid", token: token},
+		{name: "empty", token: "", wantErr: "invalid token"},
+		{name: "no signature", token: encoded, wantErr: "invalid token"},
+		{name: "tampered payload", token: forged + "." + signature, wantErr: "invalid token"},
+		{name: "tampered signature", token: encoded + "." + strings.ToUpper(signature), wantErr: "invalid token"},
+		{name: "other secret", token: otherToken, wantErr: "invalid token"},
+		{name: "no subject", token: noSubject + "." + signer.sign(noSubject), wantErr: "invalid token"},
+		{name: "payload not base64", token: "!!!." + signer.sign("!!!"), wantErr: "invalid token"},
+		{name: "expired", token: expired, wantErr: "token expired"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := signer.Verify(tt.token)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("Verify() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if claims.Subject != "alice" || claims.Registered != registered.Unix() {
+				t.Errorf("claims = %+v, want alice registered at %d", claims, registered.Unix())
+			}
+		})
+	}
+}
+
+func TestRandomSecretsDiffer(t *testing.T) {
+	a, _ := NewTokenSigner("", time.Hour)
+	b, _ := NewTokenSigner("", time.Hour)
+	token, _ := a.Issue("alice", time.Time{})
+	if _, err := a.Verify(token); err != nil {
+		t.Fatalf("Verify() with the issuing signer: %v", err)
+	}
+	if _, err := b.Verify(token); err == nil {
+		t.Error("a token from one random secret verified with another")
+	}
+}
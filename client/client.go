@@ -0,0 +1,458 @@
+// Package client is a typed Go client for the Reddit clone's REST API, as
+// described by the server's /openapi.json.
+//
+// A Client without a token can register, log in and read public listings.
+// WithToken returns a client acting as the token's user; the server takes the
+// acting user from the token, so request types have no username fields.
+// Clients are safe for concurrent use.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrorCode classifies a failed request, as in the code field of error responses.
+type ErrorCode string
+
+const (
+	CodeInvalidRequest       ErrorCode = "invalid_request"
+	CodeInvalidCursor        ErrorCode = "invalid_cursor"
+	CodeUnauthorized         ErrorCode = "unauthorized"
+	CodeForbidden            ErrorCode = "forbidden"
+	CodeBanned               ErrorCode = "banned"
+	CodeUserNotFound         ErrorCode = "user_not_found"
+	CodeSubredditNotFound    ErrorCode = "subreddit_not_found"
+	CodePostNotFound         ErrorCode = "post_not_found"
+	CodeCommentNotFound      ErrorCode = "comment_not_found"
+	CodeMessageNotFound      ErrorCode = "message_not_found"
+	CodeUserExists           ErrorCode = "user_exists"
+	CodeSubredditExists      ErrorCode = "subreddit_exists"
+	CodeTooLarge             ErrorCode = "too_large"
+	CodeUnsupportedMedia     ErrorCode = "unsupported_media"
+	CodeMediaNotFound        ErrorCode = "media_not_found"
+	CodeNotificationNotFound ErrorCode = "notification_not_found"
+	CodeRateLimited          ErrorCode = "rate_limited"
+	CodeTimeout              ErrorCode = "timeout"
+	CodeInternal             ErrorCode = "internal"
+)
+
+// Error is a request the server answered with an error response.
+type Error struct {
+	StatusCode int // HTTP status code.
+	Code       ErrorCode
+	Message    string
+	RetryAfter time.Duration // How long to wait before retrying a rate-limited request.
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// IsCode reports whether err is an *Error with the given code.
+func IsCode(err error, code ErrorCode) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && apiErr.Code == code
+}
+
+// Client makes requests to one server.
+type Client struct {
+	baseURL string
+	http    *http.Client
+	token   string
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithHTTPClient makes the client send requests through hc instead of
+// http.DefaultClient. A timeout on hc also ends event streams.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.http = hc }
+}
+
+// New returns a client of the server at baseURL, such as "http://localhost:8080".
+func New(baseURL string, options ...Option) *Client {
+	c := &Client{baseURL: strings.TrimSuffix(baseURL, "/"), http: http.DefaultClient}
+	for _, option := range options {
+		option(c)
+	}
+	return c
+}
+
+// WithToken returns a copy of c that authenticates with a bearer token from Login.
+func (c *Client) WithToken(token string) *Client {
+	clone := *c
+	clone.token = token
+	return &clone
+}
+
+// envelope is the wrapper of every JSON response.
+type envelope struct {
+	Status  string          `json:"status"`
+	Code    ErrorCode       `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// send performs a request and returns the response, which the caller must close.
+// A body that is an io.Reader is sent as it is; any other is encoded as JSON.
+func (c *Client) send(ctx context.Context, method, path string, query url.Values, body interface{}) (*http.Response, error) {
+	var payload io.Reader
+	contentType := "application/json"
+	if raw, ok := body.(io.Reader); ok {
+		payload, contentType = raw, "application/octet-stream"
+	} else if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		payload = bytes.NewReader(encoded)
+	}
+	target := c.baseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, payload)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	return c.http.Do(req)
+}
+
+// do performs a request and decodes the data of a successful response into
+// out, unless out is nil.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, out interface{}) error {
+	resp, err := c.send(ctx, method, path, query, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var reply envelope
+	if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+		return fmt.Errorf("%s %s: unexpected %s response", method, path, resp.Status)
+	}
+	if reply.Status != "success" {
+		apiErr := &Error{StatusCode: resp.StatusCode, Code: reply.Code, Message: reply.Message}
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			apiErr.RetryAfter = time.Duration(seconds) * time.Second
+		}
+		return apiErr
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(reply.Data, out)
+}
+
+// get performs a GET request and decodes its data into a new T.
+func get[T any](ctx context.Context, c *Client, path string, query url.Values) (*T, error) {
+	out := new(T)
+	if err := c.do(ctx, http.MethodGet, path, query, nil, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// post performs a POST request and decodes its data into a new T.
+func post[T any](ctx context.Context, c *Client, path string, body interface{}) (*T, error) {
+	out := new(T)
+	if err := c.do(ctx, http.MethodPost, path, nil, body, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (p Page) values() url.Values {
+	query := url.Values{}
+	if p.Limit > 0 {
+		query.Set("limit", strconv.Itoa(p.Limit))
+	}
+	if p.After != "" {
+		query.Set("after", p.After)
+	}
+	if p.Before != "" {
+		query.Set("before", p.Before)
+	}
+	return query
+}
+
+// setIf adds a query parameter unless value is empty.
+func setIf(query url.Values, name, value string) {
+	if value != "" {
+		query.Set(name, value)
+	}
+}
+
+// Register creates a user. Log in to get a token for it.
+func (c *Client) Register(ctx context.Context, credentials Credentials) error {
+	return c.do(ctx, http.MethodPost, "/register", nil, credentials, nil)
+}
+
+// Login returns a bearer token for the user; pass it to WithToken.
+func (c *Client) Login(ctx context.Context, credentials Credentials) (*LoginToken, error) {
+	return post[LoginToken](ctx, c, "/login", credentials)
+}
+
+func (c *Client) CreateSubreddit(ctx context.Context, request CreateSubredditRequest) error {
+	return c.do(ctx, http.MethodPost, "/subreddit/create", nil, request, nil)
+}
+
+func (c *Client) JoinSubreddit(ctx context.Context, subreddit string) error {
+	return c.do(ctx, http.MethodPost, "/subreddit/join", nil, map[string]string{"subreddit": subreddit}, nil)
+}
+
+func (c *Client) LeaveSubreddit(ctx context.Context, subreddit string) error {
+	return c.do(ctx, http.MethodPost, "/subreddit/leave", nil, map[string]string{"subreddit": subreddit}, nil)
+}
+
+// SubredditMembers lists a subreddit's members, newest first.
+func (c *Client) SubredditMembers(ctx context.Context, subreddit string, page Page) (*MemberList, error) {
+	return get[MemberList](ctx, c, "/subreddit/"+url.PathEscape(subreddit)+"/members", page.values())
+}
+
+func (c *Client) Moderators(ctx context.Context, subreddit string) (*ModeratorList, error) {
+	return get[ModeratorList](ctx, c, "/subreddit/"+url.PathEscape(subreddit)+"/moderators", nil)
+}
+
+func (c *Client) AddModerator(ctx context.Context, request AddModeratorRequest) (*Moderator, error) {
+	return post[Moderator](ctx, c, "/subreddit/moderators/add", request)
+}
+
+func (c *Client) RemoveModerator(ctx context.Context, request RemoveModeratorRequest) error {
+	return c.do(ctx, http.MethodPost, "/subreddit/moderators/remove", nil, request, nil)
+}
+
+func (c *Client) Ban(ctx context.Context, request BanRequest) (*Ban, error) {
+	return post[Ban](ctx, c, "/subreddit/ban", request)
+}
+
+func (c *Client) Unban(ctx context.Context, request UnbanRequest) error {
+	return c.do(ctx, http.MethodPost, "/subreddit/unban", nil, request, nil)
+}
+
+// SetBanner sets a subreddit's banner to an uploaded image, or clears it if
+// hash is empty. Only the subreddit's owner may.
+func (c *Client) SetBanner(ctx context.Context, subreddit, hash string) (*SubredditSummary, error) {
+	return post[SubredditSummary](ctx, c, "/subreddit/banner", map[string]string{"subreddit": subreddit, "banner": hash})
+}
+
+func (c *Client) RemovePost(ctx context.Context, request RemovePostRequest) (*Removal, error) {
+	return post[Removal](ctx, c, "/post/remove", request)
+}
+
+func (c *Client) RemoveComment(ctx context.Context, request RemoveCommentRequest) (*Removal, error) {
+	return post[Removal](ctx, c, "/comment/remove", request)
+}
+
+// CreatePost creates a post and returns it as it appears in feeds.
+func (c *Client) CreatePost(ctx context.Context, request CreatePostRequest) (*FeedItem, error) {
+	return post[FeedItem](ctx, c, "/post/create", request)
+}
+
+func (c *Client) EditPost(ctx context.Context, request EditPostRequest) (*History, error) {
+	return post[History](ctx, c, "/post/edit", request)
+}
+
+func (c *Client) DeletePost(ctx context.Context, postID string) (*History, error) {
+	return post[History](ctx, c, "/post/delete", map[string]string{"post_id": postID})
+}
+
+// Post returns a post with its content and, for a gallery, every image.
+func (c *Client) Post(ctx context.Context, postID string) (*PostDetail, error) {
+	return get[PostDetail](ctx, c, "/post/"+url.PathEscape(postID), nil)
+}
+
+func (c *Client) PostRevisions(ctx context.Context, postID string) (*History, error) {
+	return get[History](ctx, c, "/post/"+url.PathEscape(postID)+"/revisions", nil)
+}
+
+// PostComments returns a post's comment tree, or the comments a continuation stands for.
+func (c *Client) PostComments(ctx context.Context, postID string, options CommentsOptions) (*CommentTree, error) {
+	query := url.Values{}
+	setIf(query, "sort", options.Sort)
+	if options.Depth > 0 {
+		query.Set("depth", strconv.Itoa(options.Depth))
+	}
+	if options.Limit > 0 {
+		query.Set("limit", strconv.Itoa(options.Limit))
+	}
+	setIf(query, "continuation", options.Continuation)
+	return get[CommentTree](ctx, c, "/post/"+url.PathEscape(postID)+"/comments", query)
+}
+
+// Crosspost shares a post into a subreddit the acting user has joined and
+// returns the new post.
+func (c *Client) Crosspost(ctx context.Context, request CrosspostRequest) (*FeedItem, error) {
+	return post[FeedItem](ctx, c, "/post/crosspost", request)
+}
+
+// CreateComment comments on a post or replies to a comment and returns the new comment.
+func (c *Client) CreateComment(ctx context.Context, request CreateCommentRequest) (*CommentNode, error) {
+	return post[CommentNode](ctx, c, "/comment/create", request)
+}
+
+func (c *Client) EditComment(ctx context.Context, request EditCommentRequest) (*History, error) {
+	return post[History](ctx, c, "/comment/edit", request)
+}
+
+func (c *Client) DeleteComment(ctx context.Context, commentID string) (*History, error) {
+	return post[History](ctx, c, "/comment/delete", map[string]string{"comment_id": commentID})
+}
+
+func (c *Client) CommentRevisions(ctx context.Context, commentID string) (*History, error) {
+	return get[History](ctx, c, "/comment/"+url.PathEscape(commentID)+"/revisions", nil)
+}
+
+func (c *Client) Upvote(ctx context.Context, request VoteRequest) (*VoteResult, error) {
+	return post[VoteResult](ctx, c, "/post/upvote", request)
+}
+
+func (c *Client) Downvote(ctx context.Context, request VoteRequest) (*VoteResult, error) {
+	return post[VoteResult](ctx, c, "/post/downvote", request)
+}
+
+func (c *Client) ClearVote(ctx context.Context, request VoteRequest) (*VoteResult, error) {
+	return post[VoteResult](ctx, c, "/post/clearvote", request)
+}
+
+func (c *Client) SendMessage(ctx context.Context, request SendMessageRequest) (*DirectMessage, error) {
+	return post[DirectMessage](ctx, c, "/message/send", request)
+}
+
+func (c *Client) Save(ctx context.Context, request SaveRequest) (*SaveResult, error) {
+	return post[SaveResult](ctx, c, "/save", request)
+}
+
+func (c *Client) Unsave(ctx context.Context, request SaveRequest) (*SaveResult, error) {
+	return post[SaveResult](ctx, c, "/unsave", request)
+}
+
+// Hide leaves a post out of the acting user's feed, or a comment out of the
+// comment trees this client reads.
+func (c *Client) Hide(ctx context.Context, request SaveRequest) (*SaveResult, error) {
+	return post[SaveResult](ctx, c, "/hide", request)
+}
+
+func (c *Client) Unhide(ctx context.Context, request SaveRequest) (*SaveResult, error) {
+	return post[SaveResult](ctx, c, "/unhide", request)
+}
+
+// Saved lists the acting user's saved posts and comments.
+func (c *Client) Saved(ctx context.Context, username string, page Page) (*SavedList, error) {
+	return get[SavedList](ctx, c, "/user/"+url.PathEscape(username)+"/saved", page.values())
+}
+
+func (c *Client) Inbox(ctx context.Context, page Page) (*MessageList, error) {
+	return get[MessageList](ctx, c, "/messages/inbox", page.values())
+}
+
+func (c *Client) Sent(ctx context.Context, page Page) (*MessageList, error) {
+	return get[MessageList](ctx, c, "/messages/sent", page.values())
+}
+
+// Conversation lists the messages exchanged with otherUser.
+func (c *Client) Conversation(ctx context.Context, otherUser string, page Page) (*MessageList, error) {
+	return get[MessageList](ctx, c, "/messages/conversation/"+url.PathEscape(otherUser), page.values())
+}
+
+func (c *Client) MarkRead(ctx context.Context, messageID string) (*DirectMessage, error) {
+	return post[DirectMessage](ctx, c, "/messages/read", map[string]string{"message_id": messageID})
+}
+
+// Notifications lists the user's notifications, or only the unread ones.
+func (c *Client) Notifications(ctx context.Context, unread bool, page Page) (*NotificationList, error) {
+	query := page.values()
+	if unread {
+		query.Set("unread", "true")
+	}
+	return get[NotificationList](ctx, c, "/notifications", query)
+}
+
+// MarkNotificationRead marks one notification read, or all of them if notificationID is empty.
+func (c *Client) MarkNotificationRead(ctx context.Context, notificationID string) (*NotificationsRead, error) {
+	return post[NotificationsRead](ctx, c, "/notifications/read", map[string]string{"notification_id": notificationID})
+}
+
+// MutePost stops notifications about a post and its comments.
+func (c *Client) MutePost(ctx context.Context, postID string) (*MuteResult, error) {
+	return post[MuteResult](ctx, c, "/notifications/mute", map[string]string{"post_id": postID})
+}
+
+func (c *Client) UnmutePost(ctx context.Context, postID string) (*MuteResult, error) {
+	return post[MuteResult](ctx, c, "/notifications/unmute", map[string]string{"post_id": postID})
+}
+
+func (c *Client) Feed(ctx context.Context, username string, options FeedOptions) (*Feed, error) {
+	query := options.Page.values()
+	setIf(query, "sort", options.Sort)
+	setIf(query, "t", options.Time)
+	return get[Feed](ctx, c, "/feed/"+url.PathEscape(username), query)
+}
+
+func (c *Client) UserProfile(ctx context.Context, username string) (*UserProfile, error) {
+	return get[UserProfile](ctx, c, "/user/"+url.PathEscape(username), nil)
+}
+
+// SetAvatar sets the acting user's avatar to an uploaded image, or clears it if hash is empty.
+func (c *Client) SetAvatar(ctx context.Context, hash string) (*UserProfile, error) {
+	return post[UserProfile](ctx, c, "/user/avatar", map[string]string{"avatar": hash})
+}
+
+func (c *Client) UserSubreddits(ctx context.Context, username string) (*UserSubreddits, error) {
+	return get[UserSubreddits](ctx, c, "/user/"+url.PathEscape(username)+"/subreddits", nil)
+}
+
+// Search matches q against subreddits, posts and comments.
+func (c *Client) Search(ctx context.Context, q string, options SearchOptions) (*SearchResults, error) {
+	query := options.Page.values()
+	query.Set("q", q)
+	setIf(query, "sort", options.Sort)
+	return get[SearchResults](ctx, c, "/search", query)
+}
+
+// UploadMedia stores the PNG, JPEG or GIF image read from r on the server and
+// returns the hash posts and avatars refer to it by.
+func (c *Client) UploadMedia(ctx context.Context, r io.Reader) (*Media, error) {
+	return post[Media](ctx, c, "/media", r)
+}
+
+// Metrics returns the server's metrics in the Prometheus text format.
+func (c *Client) Metrics(ctx context.Context) (string, error) {
+	body, err := c.raw(ctx, "/metrics")
+	return string(body), err
+}
+
+// OpenAPI returns the server's OpenAPI description.
+func (c *Client) OpenAPI(ctx context.Context) ([]byte, error) {
+	return c.raw(ctx, "/openapi.json")
+}
+
+// raw returns the body of a GET request to a route that does not use the JSON envelope.
+func (c *Client) raw(ctx context.Context, path string) ([]byte, error) {
+	resp, err := c.send(ctx, http.MethodGet, path, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: unexpected %s response", path, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
@@ -0,0 +1,92 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Stream event types.
+const (
+	EventPost         = "post"         // Data is a FeedItem.
+	EventReply        = "reply"        // Data is a Reply.
+	EventMessage      = "message"      // Data is a DirectMessage.
+	EventNotification = "notification" // Data is a Notification.
+	EventOverflow     = "overflow"     // The stream fell behind and was closed.
+)
+
+// Event is one server-sent event.
+type Event struct {
+	ID   string
+	Type string
+	Data json.RawMessage
+}
+
+// Decode unmarshals the event's data into v, whose type depends on the event's Type.
+func (e *Event) Decode(v interface{}) error {
+	return json.Unmarshal(e.Data, v)
+}
+
+// EventStream reads the acting user's events.
+type EventStream struct {
+	body    io.ReadCloser
+	scanner *bufio.Scanner
+}
+
+// Stream opens the acting user's event stream. It stays open until ctx is
+// done, Close is called or the server ends it.
+func (c *Client) Stream(ctx context.Context) (*EventStream, error) {
+	resp, err := c.send(ctx, http.MethodGet, "/stream", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		var reply envelope
+		if json.NewDecoder(resp.Body).Decode(&reply) == nil {
+			return nil, &Error{StatusCode: resp.StatusCode, Code: reply.Code, Message: reply.Message}
+		}
+		return nil, fmt.Errorf("GET /stream: unexpected %s response", resp.Status)
+	}
+	return &EventStream{body: resp.Body, scanner: bufio.NewScanner(resp.Body)}, nil
+}
+
+// Next blocks until the next event arrives. It returns io.EOF once the server
+// closes the stream.
+func (s *EventStream) Next() (*Event, error) {
+	event := &Event{}
+	var data []string
+	for s.scanner.Scan() {
+		line := s.scanner.Text()
+		if line == "" {
+			if event.Type == "" && data == nil {
+				continue // The end of a comment.
+			}
+			event.Data = json.RawMessage(strings.Join(data, "\n"))
+			return event, nil
+		}
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "id":
+			event.ID = value
+		case "event":
+			event.Type = value
+		case "data":
+			data = append(data, value)
+		}
+	}
+	if err := s.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+// Close ends the stream.
+func (s *EventStream) Close() error {
+	return s.body.Close()
+}
@@ -0,0 +1,474 @@
+package client
+
+import "time"
+
+// MediaType names the kind of item a vote applies to.
+type MediaType string
+
+const (
+	MediaPost    MediaType = "Post"
+	MediaComment MediaType = "Comment"
+)
+
+// Credentials is the body of Register and Login.
+type Credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// LoginToken is the reply to Login.
+type LoginToken struct {
+	Token     string    `json:"token"`
+	TokenType string    `json:"token_type"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type CreateSubredditRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type AddModeratorRequest struct {
+	Subreddit   string   `json:"subreddit"`
+	Moderator   string   `json:"moderator"`
+	Permissions []string `json:"permissions,omitempty"` // "posts" and "bans"; all of them if empty.
+}
+
+type RemoveModeratorRequest struct {
+	Subreddit string `json:"subreddit"`
+	Moderator string `json:"moderator"`
+}
+
+type BanRequest struct {
+	Subreddit string     `json:"subreddit"`
+	User      string     `json:"user"`
+	Reason    string     `json:"reason,omitempty"`
+	Until     *time.Time `json:"until,omitempty"` // Nil for a permanent ban.
+}
+
+type UnbanRequest struct {
+	Subreddit string `json:"subreddit"`
+	User      string `json:"user"`
+}
+
+type RemovePostRequest struct {
+	PostID string `json:"post_id"`
+	Reason string `json:"reason,omitempty"`
+}
+
+type RemoveCommentRequest struct {
+	CommentID string `json:"comment_id"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// Post kinds.
+const (
+	KindText    = "text"
+	KindLink    = "link"
+	KindImage   = "image"
+	KindGallery = "gallery"
+)
+
+// PostImage is an uploaded image in an image or gallery post.
+type PostImage struct {
+	Hash    string `json:"hash"` // As returned by UploadMedia.
+	Caption string `json:"caption,omitempty"`
+}
+
+type CreatePostRequest struct {
+	Subreddit string      `json:"subreddit"`
+	Title     string      `json:"title"`
+	Content   string      `json:"content"`
+	Kind      string      `json:"kind,omitempty"` // KindText if empty.
+	URL       string      `json:"url,omitempty"`  // For link posts.
+	Images    []PostImage `json:"images,omitempty"`
+}
+
+type CrosspostRequest struct {
+	PostID    string `json:"post_id"`
+	Subreddit string `json:"subreddit"`
+	Title     string `json:"title,omitempty"` // The original's title if empty.
+}
+
+type CreateCommentRequest struct {
+	PostID   string `json:"post_id"`
+	ParentID string `json:"parent_id,omitempty"` // Empty for a comment on the post itself.
+	Content  string `json:"content"`
+}
+
+// EditPostRequest changes a post's title, its content or both; nil fields are left unchanged.
+type EditPostRequest struct {
+	PostID  string  `json:"post_id"`
+	Title   *string `json:"title,omitempty"`
+	Content *string `json:"content,omitempty"`
+}
+
+type EditCommentRequest struct {
+	CommentID string `json:"comment_id"`
+	Content   string `json:"content"`
+}
+
+type VoteRequest struct {
+	MediaType MediaType `json:"media_type"`
+	TargetID  string    `json:"target_id"`
+}
+
+// SaveRequest names the post or comment to save, unsave, hide or unhide.
+type SaveRequest struct {
+	MediaType MediaType `json:"media_type"`
+	TargetID  string    `json:"target_id"`
+}
+
+type SendMessageRequest struct {
+	To      string `json:"to"`
+	Content string `json:"content"`
+	ReplyTo string `json:"reply_to,omitempty"` // ID of the message being answered.
+}
+
+// Page selects a page of a listing. Pass the Before or After cursor of the
+// previous page to move back or forward.
+type Page struct {
+	Limit  int
+	After  string
+	Before string
+}
+
+// CommentsOptions shapes the comment tree returned by PostComments.
+type CommentsOptions struct {
+	Sort         string // "top", "new" or "controversial".
+	Depth        int
+	Limit        int    // Comments per level.
+	Continuation string // From the More of an earlier tree.
+}
+
+// FeedOptions shapes the page returned by Feed.
+type FeedOptions struct {
+	Sort string // "hot", "new", "top" or "controversial".
+	Time string // "day", "week" or "all"; for top and controversial.
+	Page
+}
+
+// SearchOptions shapes the page returned by Search.
+type SearchOptions struct {
+	Sort string // "relevance", "score" or "new".
+	Page
+}
+
+type Member struct {
+	Username string    `json:"username"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+type MemberList struct {
+	Subreddit   string   `json:"subreddit"`
+	Subscribers int      `json:"subscribers"`
+	Members     []Member `json:"members"`
+	Before      string   `json:"before,omitempty"`
+	After       string   `json:"after,omitempty"`
+}
+
+type SubredditSummary struct {
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Subscribers int        `json:"subscribers"`
+	CreatedAt   time.Time  `json:"created_at"`
+	Banner      *ImageView `json:"banner,omitempty"`
+}
+
+type UserSubreddits struct {
+	Username   string             `json:"username"`
+	Subreddits []SubredditSummary `json:"subreddits"`
+}
+
+type Moderator struct {
+	Username    string    `json:"username"`
+	Permissions []string  `json:"permissions"`
+	AddedAt     time.Time `json:"added_at"`
+}
+
+type ModeratorList struct {
+	Subreddit  string       `json:"subreddit"`
+	Owner      string       `json:"owner"`
+	Moderators []*Moderator `json:"moderators"`
+}
+
+type Ban struct {
+	Username string     `json:"username"`
+	By       string     `json:"by"`
+	Reason   string     `json:"reason,omitempty"`
+	BannedAt time.Time  `json:"banned_at"`
+	Until    *time.Time `json:"until,omitempty"`
+}
+
+type Removal struct {
+	By        string    `json:"by"`
+	Reason    string    `json:"reason,omitempty"`
+	RemovedAt time.Time `json:"removed_at"`
+}
+
+type Revision struct {
+	Title      string    `json:"title,omitempty"`
+	Content    string    `json:"content"`
+	ReplacedAt time.Time `json:"replaced_at"`
+}
+
+// History is the current version of a post or comment and the versions it replaced.
+type History struct {
+	ID        string     `json:"id"`
+	Title     string     `json:"title,omitempty"`
+	Content   string     `json:"content"`
+	EditedAt  *time.Time `json:"edited_at,omitempty"`
+	Deleted   bool       `json:"deleted,omitempty"`
+	Revisions []Revision `json:"revisions"`
+}
+
+type CommentNode struct {
+	ID        string         `json:"id"`
+	Author    string         `json:"author"`
+	Content   string         `json:"content"`
+	ParentID  string         `json:"parent_id,omitempty"`
+	Score     int            `json:"score"`
+	Upvotes   int            `json:"upvotes"`
+	Downvotes int            `json:"downvotes"`
+	CreatedAt time.Time      `json:"created_at"`
+	EditedAt  *time.Time     `json:"edited_at,omitempty"`
+	Removed   bool           `json:"removed,omitempty"`
+	Deleted   bool           `json:"deleted,omitempty"`
+	Replies   []*CommentNode `json:"replies,omitempty"`
+	More      *MoreComments  `json:"more,omitempty"`
+}
+
+// MoreComments stands in for comments left out of a tree. Pass its
+// Continuation to PostComments to load them.
+type MoreComments struct {
+	Count        int    `json:"count"`
+	Continuation string `json:"continuation"`
+}
+
+type CommentTree struct {
+	PostID   string         `json:"post_id"`
+	ParentID string         `json:"parent_id,omitempty"`
+	Sort     string         `json:"sort"`
+	Comments []*CommentNode `json:"comments"`
+	More     *MoreComments  `json:"more,omitempty"`
+}
+
+type VoteResult struct {
+	MediaType MediaType `json:"media_type"`
+	TargetID  string    `json:"target_id"`
+	Vote      string    `json:"vote"` // "up", "down" or "none".
+	Changed   bool      `json:"changed"`
+	Score     int       `json:"score"`
+	Upvotes   int       `json:"upvotes"`
+	Downvotes int       `json:"downvotes"`
+}
+
+type DirectMessage struct {
+	ID       string    `json:"id"`
+	From     string    `json:"from"`
+	To       string    `json:"to"`
+	Body     string    `json:"body"`
+	SentAt   time.Time `json:"sent_at"`
+	Read     bool      `json:"read"`
+	ReplyTo  string    `json:"reply_to,omitempty"`
+	ThreadID string    `json:"thread_id"`
+}
+
+type MessageList struct {
+	Box      string          `json:"box"`
+	With     string          `json:"with,omitempty"`
+	Unread   int             `json:"unread"`
+	Messages []DirectMessage `json:"messages"`
+	Before   string          `json:"before,omitempty"`
+	After    string          `json:"after,omitempty"`
+}
+
+// FeedItem is a post as it appears in a feed and in post events.
+type FeedItem struct {
+	ID             string           `json:"id"`
+	Title          string           `json:"title"`
+	Subreddit      string           `json:"subreddit"`
+	Author         string           `json:"author"`
+	Score          int              `json:"score"`
+	Upvotes        int              `json:"upvotes"`
+	Downvotes      int              `json:"downvotes"`
+	CommentCount   int              `json:"comment_count"`
+	CreatedAt      time.Time        `json:"created_at"`
+	EditedAt       *time.Time       `json:"edited_at,omitempty"`
+	Kind           string           `json:"kind"`
+	Link           *LinkView        `json:"link,omitempty"`
+	Image          *ImageView       `json:"image,omitempty"`
+	Gallery        *GalleryView     `json:"gallery,omitempty"` // Feeds carry only the cover image.
+	CrosspostOf    *CrosspostOrigin `json:"crosspost_of,omitempty"`
+	CrosspostCount int              `json:"crosspost_count"`
+}
+
+// CrosspostOrigin names the post a crosspost links to.
+type CrosspostOrigin struct {
+	ID        string `json:"id"`
+	Subreddit string `json:"subreddit"`
+	Author    string `json:"author"`
+}
+
+// CrosspostRef is a crosspost as its original lists it.
+type CrosspostRef struct {
+	ID        string    `json:"id"`
+	Subreddit string    `json:"subreddit"`
+	Author    string    `json:"author"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type LinkView struct {
+	URL    string `json:"url"`
+	Domain string `json:"domain"`
+}
+
+type ImageView struct {
+	Hash         string `json:"hash"`
+	URL          string `json:"url"`
+	ThumbnailURL string `json:"thumbnail_url"`
+	Caption      string `json:"caption,omitempty"`
+}
+
+type GalleryView struct {
+	Count  int         `json:"count"`
+	Images []ImageView `json:"images"`
+}
+
+// PostDetail is the reply to Post.
+type PostDetail struct {
+	FeedItem
+	Content    string         `json:"content"`
+	Removed    bool           `json:"removed,omitempty"`
+	Deleted    bool           `json:"deleted,omitempty"`
+	Crossposts []CrosspostRef `json:"crossposts,omitempty"`
+}
+
+// Media is the reply to UploadMedia.
+type Media struct {
+	Hash         string `json:"hash"`
+	URL          string `json:"url"`
+	ThumbnailURL string `json:"thumbnail_url"`
+	ContentType  string `json:"content_type"`
+	Size         int64  `json:"size"`
+	Width        int    `json:"width"`
+	Height       int    `json:"height"`
+}
+
+type Feed struct {
+	Username string     `json:"username"`
+	Sort     string     `json:"sort"`
+	Time     string     `json:"t"`
+	Posts    []FeedItem `json:"posts"`
+	Before   string     `json:"before,omitempty"`
+	After    string     `json:"after,omitempty"`
+}
+
+// SaveResult is whether a post or comment is saved and hidden after a request.
+type SaveResult struct {
+	MediaType MediaType `json:"media_type"`
+	TargetID  string    `json:"target_id"`
+	Saved     bool      `json:"saved"`
+	Hidden    bool      `json:"hidden"`
+}
+
+// SavedView is a saved post or comment as it is now. Deleted and removed ones
+// show "[deleted]".
+type SavedView struct {
+	MediaType MediaType  `json:"media_type"`
+	ID        string     `json:"id"`
+	SavedAt   time.Time  `json:"saved_at"`
+	Subreddit string     `json:"subreddit"`
+	Author    string     `json:"author"`
+	Title     string     `json:"title"`             // For a comment, the title of its post.
+	PostID    string     `json:"post_id,omitempty"` // Comments only.
+	Content   string     `json:"content"`
+	Score     int        `json:"score"`
+	CreatedAt time.Time  `json:"created_at"`
+	EditedAt  *time.Time `json:"edited_at,omitempty"`
+	Deleted   bool       `json:"deleted,omitempty"`
+}
+
+type SavedList struct {
+	Username string      `json:"username"`
+	Items    []SavedView `json:"items"` // Most recently saved first.
+	Before   string      `json:"before,omitempty"`
+	After    string      `json:"after,omitempty"`
+}
+
+// Notification types.
+const (
+	NotificationReply   = "reply"
+	NotificationMention = "mention"
+	NotificationRemoval = "removal"
+)
+
+// Notification tells the user about a reply, a mention or a moderator's removal.
+type Notification struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	From      string    `json:"from,omitempty"` // Empty for removals.
+	Subreddit string    `json:"subreddit"`
+	PostID    string    `json:"post_id"`
+	CommentID string    `json:"comment_id,omitempty"`
+	Body      string    `json:"body"` // The reply or mention, or the removal reason.
+	CreatedAt time.Time `json:"created_at"`
+	Read      bool      `json:"read"`
+}
+
+type NotificationList struct {
+	Unread        int            `json:"unread"`
+	Notifications []Notification `json:"notifications"` // Newest first.
+	Before        string         `json:"before,omitempty"`
+	After         string         `json:"after,omitempty"`
+}
+
+type NotificationsRead struct {
+	Marked int `json:"marked"`
+	Unread int `json:"unread"`
+}
+
+type MuteResult struct {
+	PostID string `json:"post_id"`
+	Muted  bool   `json:"muted"`
+}
+
+type UserProfile struct {
+	Username     string     `json:"username"`
+	Avatar       *ImageView `json:"avatar,omitempty"`
+	PostKarma    int        `json:"post_karma"`
+	CommentKarma int        `json:"comment_karma"`
+	Karma        int        `json:"karma"`
+}
+
+type SearchHit struct {
+	Type      string    `json:"type"` // "subreddit", "post" or "comment".
+	ID        string    `json:"id"`
+	Title     string    `json:"title,omitempty"`
+	Snippet   string    `json:"snippet,omitempty"`
+	Subreddit string    `json:"subreddit"`
+	Author    string    `json:"author,omitempty"`
+	PostID    string    `json:"post_id,omitempty"`
+	Score     int       `json:"score"`
+	Relevance float64   `json:"relevance"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type SearchResults struct {
+	Query  string      `json:"query"`
+	Sort   string      `json:"sort"`
+	Hits   []SearchHit `json:"hits"`
+	Before string      `json:"before,omitempty"`
+	After  string      `json:"after,omitempty"`
+}
+
+// Reply is the data of a reply event.
+type Reply struct {
+	CommentID string    `json:"comment_id"`
+	PostID    string    `json:"post_id"`
+	ParentID  string    `json:"parent_id,omitempty"`
+	Subreddit string    `json:"subreddit"`
+	Author    string    `json:"author"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+}
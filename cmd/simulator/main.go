@@ -0,0 +1,119 @@
+// Command simulator drives a running Reddit clone server over HTTP with
+// simulated users. To drive the engine in-process instead, run the server
+// with -simulate, which takes the same options prefixed with sim-.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"RedditAPI/client"
+	"RedditAPI/simulator"
+)
+
+func main() {
+	cfg := simulator.DefaultConfig()
+	cfg.RegisterFlags(flag.CommandLine, "")
+	baseURL := flag.String("url", "http://localhost:8080", "base URL of the server")
+	timeout := flag.Duration("timeout", 5*time.Second, "timeout of each HTTP request")
+	flag.Parse()
+
+	driver := &httpDriver{
+		api:     client.New(*baseURL, client.WithHTTPClient(&http.Client{Timeout: *timeout})),
+		clients: make(map[string]*client.Client),
+	}
+	report, err := simulator.Run(cfg, driver, os.Stdout)
+	if err != nil {
+		log.Fatal(err)
+	}
+	report.Print(os.Stdout)
+}
+
+// httpDriver performs the simulator's requests against the server's REST API,
+// logging each user in once it is registered.
+type httpDriver struct {
+	api *client.Client
+
+	mu      sync.Mutex
+	clients map[string]*client.Client // Map of username to a client holding its token.
+}
+
+// as returns the client acting as username.
+func (d *httpDriver) as(username string) *client.Client {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.clients[username]
+}
+
+// Register registers username, or reuses it if a previous run already did, and logs it in.
+func (d *httpDriver) Register(username, password string) error {
+	ctx := context.Background()
+	credentials := client.Credentials{Username: username, Password: password}
+	// A user left over from an earlier run against the same server can still log in.
+	if err := d.api.Register(ctx, credentials); err != nil && !client.IsCode(err, client.CodeUserExists) {
+		return err
+	}
+	login, err := d.api.Login(ctx, credentials)
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	d.clients[username] = d.api.WithToken(login.Token)
+	d.mu.Unlock()
+	return nil
+}
+
+func (d *httpDriver) CreateSubreddit(username, name, description string) error {
+	return d.as(username).CreateSubreddit(context.Background(), client.CreateSubredditRequest{Name: name, Description: description})
+}
+
+func (d *httpDriver) JoinSubreddit(username, subreddit string) error {
+	return d.as(username).JoinSubreddit(context.Background(), subreddit)
+}
+
+func (d *httpDriver) CreatePost(username, subreddit, title, content string) (string, error) {
+	post, err := d.as(username).CreatePost(context.Background(), client.CreatePostRequest{Subreddit: subreddit, Title: title, Content: content})
+	if err != nil {
+		return "", err
+	}
+	return post.ID, nil
+}
+
+func (d *httpDriver) CreateComment(username, postID, parentID, content string) (string, error) {
+	comment, err := d.as(username).CreateComment(context.Background(), client.CreateCommentRequest{PostID: postID, ParentID: parentID, Content: content})
+	if err != nil {
+		return "", err
+	}
+	return comment.ID, nil
+}
+
+func (d *httpDriver) Vote(username, postID string, up bool) error {
+	vote := d.as(username).Downvote
+	if up {
+		vote = d.as(username).Upvote
+	}
+	_, err := vote(context.Background(), client.VoteRequest{MediaType: client.MediaPost, TargetID: postID})
+	return err
+}
+
+func (d *httpDriver) SendMessage(from, to, content string) error {
+	_, err := d.as(from).SendMessage(context.Background(), client.SendMessageRequest{To: to, Content: content})
+	return err
+}
+
+func (d *httpDriver) Feed(username string) ([]simulator.Post, error) {
+	feed, err := d.as(username).Feed(context.Background(), username, client.FeedOptions{Sort: "new"})
+	if err != nil {
+		return nil, err
+	}
+	posts := make([]simulator.Post, len(feed.Posts))
+	for i, post := range feed.Posts {
+		posts[i] = simulator.Post{ID: post.ID, Title: post.Title, Subreddit: post.Subreddit, Author: post.Author}
+	}
+	return posts, nil
+}
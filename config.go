@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"RedditAPI/simulator"
+)
+
+// Config is the server's configuration. Every setting is a flag, and can also
+// be given in a JSON config file keyed by flag name or in an environment
+// variable named REDDIT_ followed by the flag name in upper case with dashes as
+// underscores. Flags override the environment, which overrides the file.
+type Config struct {
+	Addr              string
+	DataDir           string
+	MediaDir          string
+	MaxUploadSize     int64 // The largest image upload accepted, in bytes.
+	SnapshotInterval  int
+	RequestTimeout    time.Duration // How long a handler waits for the engine's reply.
+	ReadHeaderTimeout time.Duration
+	IdleTimeout       time.Duration
+	ShutdownTimeout   time.Duration // How long shutdown waits for in-flight requests.
+	AuthSecret        string
+	TokenTTL          time.Duration
+	LogLevel          string
+	RateLimits        RateLimits
+	Simulate          bool
+	Simulator         simulator.Config
+}
+
+func defaultConfig() *Config {
+	return &Config{
+		Addr:              ":8080",
+		DataDir:           "data",
+		MediaDir:          "media",
+		MaxUploadSize:     10 << 20,
+		SnapshotInterval:  1000,
+		RequestTimeout:    1 * time.Second,
+		ReadHeaderTimeout: 10 * time.Second,
+		IdleTimeout:       2 * time.Minute,
+		ShutdownTimeout:   15 * time.Second,
+		TokenTTL:          24 * time.Hour,
+		LogLevel:          "info",
+		RateLimits: RateLimits{
+			Actions: map[string]*Limit{
+				ActionPost:    {Burst: 5, Period: time.Minute},
+				ActionComment: {Burst: 20, Period: time.Minute},
+				ActionVote:    {Burst: 120, Period: time.Minute},
+				ActionMessage: {Burst: 20, Period: time.Minute},
+			},
+			IPFactor:        4,
+			NewAccountAge:   24 * time.Hour,
+			NewAccountShare: 0.25,
+		},
+		Simulator: simulator.DefaultConfig(),
+	}
+}
+
+// define adds a flag for every setting to fs.
+func (c *Config) define(fs *flag.FlagSet) {
+	fs.StringVar(&c.Addr, "addr", c.Addr, "address to listen on")
+	fs.StringVar(&c.DataDir, "data", c.DataDir, "directory for the event journal and snapshots")
+	fs.StringVar(&c.MediaDir, "media", c.MediaDir, "directory for uploaded images")
+	fs.Int64Var(&c.MaxUploadSize, "max-upload-size", c.MaxUploadSize, "largest image upload accepted, in bytes")
+	fs.IntVar(&c.SnapshotInterval, "snapshot-interval", c.SnapshotInterval, "number of events between snapshots")
+	fs.DurationVar(&c.RequestTimeout, "request-timeout", c.RequestTimeout, "how long a request waits for the engine")
+	fs.DurationVar(&c.ReadHeaderTimeout, "read-header-timeout", c.ReadHeaderTimeout, "how long a client may take to send request headers")
+	fs.DurationVar(&c.IdleTimeout, "idle-timeout", c.IdleTimeout, "how long an idle keep-alive connection is kept open")
+	fs.DurationVar(&c.ShutdownTimeout, "shutdown-timeout", c.ShutdownTimeout, "how long shutdown waits for in-flight requests")
+	fs.StringVar(&c.AuthSecret, "auth-secret", c.AuthSecret, "secret for signing bearer tokens (random if empty)")
+	fs.DurationVar(&c.TokenTTL, "token-ttl", c.TokenTTL, "lifetime of issued bearer tokens")
+	fs.StringVar(&c.LogLevel, "log-level", c.LogLevel, "least severe log level printed: debug, info, warn or error")
+	for _, action := range []string{ActionPost, ActionComment, ActionVote, ActionMessage} {
+		fs.Var(c.RateLimits.Actions[action], "limit-"+action, "per-user "+action+" budget as burst/period, such as 10/1m, or off")
+	}
+	fs.Float64Var(&c.RateLimits.IPFactor, "limit-ip-factor", c.RateLimits.IPFactor, "multiplies the per-user budgets for each client IP")
+	fs.DurationVar(&c.RateLimits.NewAccountAge, "limit-new-account-age", c.RateLimits.NewAccountAge, "accounts younger than this get the new-account share of each budget")
+	fs.Float64Var(&c.RateLimits.NewAccountShare, "limit-new-account-share", c.RateLimits.NewAccountShare, "fraction of each per-user budget given to new accounts")
+	fs.BoolVar(&c.RateLimits.TrustProxy, "trust-proxy", c.RateLimits.TrustProxy, "take the client IP from X-Forwarded-For")
+	fs.BoolVar(&c.Simulate, "simulate", c.Simulate, "run the simulator against a throwaway engine in-process instead of serving HTTP")
+	c.Simulator.RegisterFlags(fs, "sim-")
+}
+
+// envName returns the environment variable that sets the flag called name.
+func envName(name string) string {
+	return "REDDIT_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// LoadConfig reads the configuration from the command-line arguments args, the
+// environment and the config file named by -config or REDDIT_CONFIG.
+func LoadConfig(args []string) (*Config, error) {
+	cfg := defaultConfig()
+	fs := flag.NewFlagSet("reddit", flag.ContinueOnError)
+	cfg.define(fs)
+	configPath := fs.String("config", os.Getenv(envName("config")), "path of a JSON config file")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	// Settings from the file and the environment are applied through the flags,
+	// skipping the ones given on the command line.
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+	set := func(name, value, source string) error {
+		if explicit[name] || name == "config" {
+			return nil
+		}
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("%s: invalid value %q for %s: %v", source, value, name, err)
+		}
+		return nil
+	}
+
+	if *configPath != "" {
+		data, err := os.ReadFile(*configPath)
+		if err != nil {
+			return nil, err
+		}
+		var settings map[string]interface{}
+		if err := json.Unmarshal(data, &settings); err != nil {
+			return nil, fmt.Errorf("%s: %v", *configPath, err)
+		}
+		for name, value := range settings {
+			if fs.Lookup(name) == nil {
+				return nil, fmt.Errorf("%s: unknown setting %q", *configPath, name)
+			}
+			text := fmt.Sprint(value)
+			if number, ok := value.(float64); ok {
+				text = strconv.FormatFloat(number, 'f', -1, 64)
+			}
+			if err := set(name, text, *configPath); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var envErr error
+	fs.VisitAll(func(f *flag.Flag) {
+		if value, ok := os.LookupEnv(envName(f.Name)); ok && envErr == nil {
+			envErr = set(f.Name, value, envName(f.Name))
+		}
+	})
+	if envErr != nil {
+		return nil, envErr
+	}
+	return cfg, cfg.validate()
+}
+
+func (c *Config) validate() error {
+	if _, err := parseLogLevel(c.LogLevel); err != nil {
+		return err
+	}
+	if c.RequestTimeout <= 0 || c.ShutdownTimeout <= 0 {
+		return fmt.Errorf("request and shutdown timeouts must be positive")
+	}
+	if c.MaxUploadSize <= 0 {
+		return fmt.Errorf("max-upload-size must be positive")
+	}
+	if c.RateLimits.IPFactor <= 0 || c.RateLimits.NewAccountShare <= 0 || c.RateLimits.NewAccountShare > 1 {
+		return fmt.Errorf("limit-ip-factor must be positive and limit-new-account-share between 0 and 1")
+	}
+	return nil
+}
+
+// level returns the parsed log level, which validate has already checked.
+func (c *Config) level() slog.Level {
+	level, _ := parseLogLevel(c.LogLevel)
+	return level
+}
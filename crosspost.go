@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/asynkron/protoactor-go/actor"
+)
+
+// Crosspost shares a post into another subreddit as a new post linked to it.
+// The engine assigns the new post's ID and hands the request to the original's
+// subreddit, which sends the new post on to the target.
+type Crosspost struct {
+	Author    string
+	PostID    string     // The post being shared.
+	Subreddit string     // The subreddit it is shared into.
+	Title     string     // Optional: defaults to the original's title.
+	ID        string     `json:"-"` // Assigned by the engine.
+	Target    *actor.PID `json:"-"` // The target subreddit's actor, found by the engine.
+}
+
+// CrosspostOrigin names the post a crosspost links to.
+type CrosspostOrigin struct {
+	ID        string `json:"id"`
+	Subreddit string `json:"subreddit"`
+	Author    string `json:"author"`
+}
+
+// CrosspostRef is a crosspost as its original lists it.
+type CrosspostRef struct {
+	ID        string    `json:"id"`
+	Subreddit string    `json:"subreddit"`
+	Author    string    `json:"author"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// crosspostCreated reports a new crosspost to the subreddit holding its
+// original, through the engine.
+type crosspostCreated struct {
+	OriginalID string
+	Crosspost  CrosspostRef
+}
+
+// crosspost checks the target subreddit and the post exist and assigns the
+// crosspost an ID. The rest is up to the post's subreddit.
+func (re *RedditEngine) crosspost(msg *Crosspost, context actor.Context) {
+	if _, userExists := re.users[msg.Author]; !userExists {
+		debugf("No such user with username %s\n", msg.Author)
+		context.Respond(failure(CodeUserNotFound, "No such username"))
+		return
+	}
+
+	target, subExists := re.subreddits[msg.Subreddit]
+	if !subExists {
+		debugf("No such subreddit with name %s\n", msg.Subreddit)
+		context.Respond(failure(CodeSubredditNotFound, "No such subreddit"))
+		return
+	}
+
+	source, rejected := re.postSubreddit(msg.PostID)
+	if rejected != nil {
+		context.Respond(rejected)
+		return
+	}
+
+	re.postSeq++
+	request := *msg
+	request.ID = fmt.Sprintf("%s_post_%d", msg.Author, re.postSeq)
+	request.Target = target.PID
+	context.RequestWithCustomSender(source.PID, &request, context.Sender())
+}
+
+// crosspost turns a request to share one of the subreddit's posts into the new
+// post and sends it to the target subreddit, which replies. Crossposts of
+// crossposts link to the first post, and carry its kind, link and images but
+// not its text.
+func (sa *SubredditActor) crosspost(msg *Crosspost, context actor.Context) {
+	post, exists := sa.post(msg.PostID, context)
+	if !exists {
+		return
+	}
+	if post.Removal != nil {
+		context.Respond(failure(CodeForbidden, "The post has been removed"))
+		return
+	}
+	if post.Deleted {
+		context.Respond(failure(CodeForbidden, "The post has been deleted"))
+		return
+	}
+	origin := post.CrosspostOf
+	if origin == nil {
+		origin = &CrosspostOrigin{ID: post.ID, Subreddit: sa.subreddit.Name, Author: post.Author}
+	}
+	if origin.Subreddit == msg.Subreddit || sa.subreddit.Name == msg.Subreddit {
+		context.Respond(failure(CodeInvalidRequest, "The post is already in r/%s", msg.Subreddit))
+		return
+	}
+
+	title := msg.Title
+	if title == "" {
+		title = post.Title
+	}
+	context.RequestWithCustomSender(msg.Target, &CreatePost{
+		ID:          msg.ID,
+		Title:       title,
+		Author:      msg.Author,
+		Subreddit:   msg.Subreddit,
+		Kind:        post.Kind,
+		URL:         post.URL,
+		Images:      post.Images,
+		CrosspostOf: origin,
+	}, context.Sender())
+}
+
+// addCrosspost lists a new crosspost on its original.
+func (sa *SubredditActor) addCrosspost(msg *crosspostCreated) {
+	if post, exists := sa.posts[msg.OriginalID]; exists {
+		post.Crossposts = append(post.Crossposts, msg.Crosspost)
+	}
+}
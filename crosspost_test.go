@@ -0,0 +1,45 @@
+package main
+
+import "testing"
+
+func TestCrosspost(t *testing.T) {
+	e := startCommunity(t)
+	for _, name := range []string{"rust", "python"} {
+		e.request(&CreateSubreddit{Name: name, Description: name, Creator: "bob"})
+		e.request(&JoinSubreddit{Username: "bob", Subreddit: name})
+		e.request(&JoinSubreddit{Username: "carol", Subreddit: name})
+	}
+	post := e.request(&CreatePost{Title: "Go 1.23", Content: "Notes", Author: "alice", Subreddit: "golang", Kind: KindLink, URL: "https://go.dev/blog"}).Data.(*FeedItem)
+
+	e.refuse(&Crosspost{Author: "alice", PostID: post.ID, Subreddit: "rust"}, CodeForbidden)
+
+	shared := e.request(&Crosspost{Author: "carol", PostID: post.ID, Subreddit: "rust"}).Data.(*FeedItem)
+	origin := CrosspostOrigin{ID: post.ID, Subreddit: "golang", Author: "alice"}
+	if shared.CrosspostOf == nil || *shared.CrosspostOf != origin {
+		t.Errorf("crosspost of %+v, want %+v", shared.CrosspostOf, origin)
+	}
+	if shared.Title != "Go 1.23" || shared.Subreddit != "rust" || shared.Link == nil || shared.Link.Domain != "go.dev" {
+		t.Errorf("crosspost = %q in r/%s linking %+v, want the original's title and link in r/rust", shared.Title, shared.Subreddit, shared.Link)
+	}
+
+	// Sharing a crosspost links the new one to the first post.
+	again := e.request(&Crosspost{Author: "carol", PostID: shared.ID, Subreddit: "python", Title: "Go news"}).Data.(*FeedItem)
+	if again.CrosspostOf == nil || *again.CrosspostOf != origin || again.Title != "Go news" {
+		t.Errorf("crosspost of a crosspost = %q of %+v, want Go news of %+v", again.Title, again.CrosspostOf, origin)
+	}
+	e.eventually("crossposts listed on the original", func() bool {
+		detail := e.request(&GetPost{PostID: post.ID}).Data.(*PostDetail)
+		return len(detail.Crossposts) == 2 && detail.Crossposts[0].ID == shared.ID && detail.Crossposts[1].ID == again.ID
+	})
+
+	e.refuse(&Crosspost{Author: "carol", PostID: shared.ID, Subreddit: "golang"}, CodeInvalidRequest)
+	e.refuse(&Crosspost{Author: "carol", PostID: post.ID, Subreddit: "nowhere"}, CodeSubredditNotFound)
+	e.refuse(&Crosspost{Author: "carol", PostID: "nobody_post_9", Subreddit: "rust"}, CodePostNotFound)
+
+	e.request(&BanUser{Subreddit: "python", By: "bob", Username: "carol"})
+	other := e.request(&CreatePost{Title: "Another", Content: "Post", Author: "alice", Subreddit: "golang"}).Data.(*FeedItem)
+	e.refuse(&Crosspost{Author: "carol", PostID: other.ID, Subreddit: "python"}, CodeBanned)
+
+	e.request(&DeletePost{Author: "alice", PostID: other.ID})
+	e.refuse(&Crosspost{Author: "carol", PostID: other.ID, Subreddit: "rust"}, CodeForbidden)
+}
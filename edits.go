@@ -0,0 +1,213 @@
+package main
+
+import (
+	"time"
+
+	"github.com/asynkron/protoactor-go/actor"
+)
+
+// titleEditWindow is how long after posting a post's title can still be edited.
+const titleEditWindow = 5 * time.Minute
+
+// deletedPlaceholder stands in for the author and content of deleted posts and comments.
+const deletedPlaceholder = "[deleted]"
+
+type EditPost struct {
+	Author  string
+	PostID  string
+	Title   *string // Nil keeps the current title.
+	Content *string // Nil keeps the current content.
+}
+
+type DeletePost struct {
+	Author string
+	PostID string
+}
+
+type EditComment struct {
+	Author    string
+	CommentID string
+	Content   string
+}
+
+type DeleteComment struct {
+	Author    string
+	CommentID string
+}
+
+type GetPostRevisions struct {
+	PostID string
+}
+
+type GetCommentRevisions struct {
+	CommentID string
+}
+
+// Revision is an earlier version of a post or comment.
+type Revision struct {
+	Title      string    `json:"title,omitempty"` // Posts only.
+	Content    string    `json:"content"`
+	ReplacedAt time.Time `json:"replaced_at"` // When an edit replaced this version.
+}
+
+// Edits is the edit and delete state shared by posts and comments.
+type Edits struct {
+	Revisions []Revision // Earlier versions, oldest first.
+	EditedAt  *time.Time // Time of the latest edit; nil if never edited.
+	Deleted   bool       // Deleted by its author; the content has been cleared.
+}
+
+// History is the reply to edits, deletes and revision requests: the current
+// version of a post or comment and the versions it replaced.
+type History struct {
+	ID        string     `json:"id"`
+	Title     string     `json:"title,omitempty"`
+	Content   string     `json:"content"`
+	EditedAt  *time.Time `json:"edited_at,omitempty"`
+	Deleted   bool       `json:"deleted,omitempty"`
+	Revisions []Revision `json:"revisions"`
+}
+
+func postHistory(post *Post) *History {
+	return newHistory(post.ID, post.Title, post.Content, post.Edits, post.Removal)
+}
+
+func commentHistory(comment *Comment) *History {
+	return newHistory(comment.ID, "", comment.Content, comment.Edits, comment.Removal)
+}
+
+// newHistory builds a History, withholding the content of deleted and removed versions.
+func newHistory(id, title, content string, edits Edits, removal *Removal) *History {
+	history := &History{ID: id, Title: title, Content: content, EditedAt: edits.EditedAt, Deleted: edits.Deleted, Revisions: edits.Revisions}
+	switch {
+	case edits.Deleted:
+		history.Content = deletedPlaceholder
+	case removal != nil:
+		history.Content = "[removed]"
+		history.Revisions = nil
+	}
+	if history.Revisions == nil {
+		history.Revisions = []Revision{}
+	}
+	return history
+}
+
+// editable checks that author may change a post or comment in its current state.
+func editable(owner, author string, edits *Edits, removal *Removal) *Result {
+	switch {
+	case owner != author:
+		return failure(CodeForbidden, "Only the author can change this")
+	case edits.Deleted:
+		return failure(CodeForbidden, "It has been deleted")
+	case removal != nil:
+		return failure(CodeForbidden, "It has been removed by a moderator")
+	}
+	return nil
+}
+
+// editPost replaces a post's title and content, keeping the old version. The
+// title can only change within titleEditWindow of posting.
+func (sa *SubredditActor) editPost(msg *EditPost, context actor.Context) {
+	post, exists := sa.post(msg.PostID, context)
+	if !exists {
+		return
+	}
+	if rejected := editable(post.Author, msg.Author, &post.Edits, post.Removal); rejected != nil {
+		context.Respond(rejected)
+		return
+	}
+
+	title, content := post.Title, post.Content
+	if msg.Title != nil {
+		title = *msg.Title
+	}
+	if msg.Content != nil {
+		content = *msg.Content
+	}
+	if title != post.Title && sa.now.Sub(post.CreatedAt) > titleEditWindow {
+		context.Respond(failure(CodeForbidden, "Titles can only be edited within %s of posting", titleEditWindow))
+		return
+	}
+	if title == post.Title && content == post.Content {
+		context.Respond(success(postHistory(post)))
+		return
+	}
+
+	post.Revisions = append(post.Revisions, Revision{Title: post.Title, Content: post.Content, ReplacedAt: sa.now})
+	post.Title, post.Content = title, content
+	editedAt := sa.now
+	post.EditedAt = &editedAt
+	context.Send(context.Parent(), &indexDocument{Doc: postDocument(post)})
+	debugf("Post %s edited by %s\n", post.ID, msg.Author)
+	context.Respond(success(postHistory(post)))
+}
+
+// deletePost clears a post's title and content and takes it out of feeds. Its
+// comments stay readable.
+func (sa *SubredditActor) deletePost(msg *DeletePost, context actor.Context) {
+	post, exists := sa.post(msg.PostID, context)
+	if !exists {
+		return
+	}
+	if post.Author != msg.Author {
+		context.Respond(failure(CodeForbidden, "Only the author can change this"))
+		return
+	}
+	if post.Deleted {
+		context.Respond(failure(CodePostNotFound, "The post has already been deleted"))
+		return
+	}
+	post.Deleted = true
+	post.Title, post.Content = deletedPlaceholder, ""
+	post.URL, post.Domain, post.Images = "", "", nil
+	post.Revisions = nil
+	context.Send(context.Parent(), &unindexDocument{Type: "post", ID: post.ID})
+	debugf("Post %s deleted by %s\n", post.ID, msg.Author)
+	context.Respond(success(postHistory(post)))
+}
+
+func (sa *SubredditActor) editComment(msg *EditComment, context actor.Context) {
+	comment, exists := sa.comment(msg.CommentID, context)
+	if !exists {
+		return
+	}
+	if rejected := editable(comment.Author, msg.Author, &comment.Edits, comment.Removal); rejected != nil {
+		context.Respond(rejected)
+		return
+	}
+	if msg.Content == comment.Content {
+		context.Respond(success(commentHistory(comment)))
+		return
+	}
+
+	comment.Revisions = append(comment.Revisions, Revision{Content: comment.Content, ReplacedAt: sa.now})
+	comment.Content = msg.Content
+	editedAt := sa.now
+	comment.EditedAt = &editedAt
+	context.Send(context.Parent(), &indexDocument{Doc: commentDocument(comment)})
+	debugf("Comment %s edited by %s\n", comment.ID, msg.Author)
+	context.Respond(success(commentHistory(comment)))
+}
+
+// deleteComment clears a comment's content. It stays in the tree as a
+// placeholder so replies under it still render.
+func (sa *SubredditActor) deleteComment(msg *DeleteComment, context actor.Context) {
+	comment, exists := sa.comment(msg.CommentID, context)
+	if !exists {
+		return
+	}
+	if comment.Author != msg.Author {
+		context.Respond(failure(CodeForbidden, "Only the author can change this"))
+		return
+	}
+	if comment.Deleted {
+		context.Respond(failure(CodeCommentNotFound, "The comment has already been deleted"))
+		return
+	}
+	comment.Deleted = true
+	comment.Content = ""
+	comment.Revisions = nil
+	context.Send(context.Parent(), &unindexDocument{Type: "comment", ID: comment.ID})
+	debugf("Comment %s deleted by %s\n", comment.ID, msg.Author)
+	context.Respond(success(commentHistory(comment)))
+}
@@ -0,0 +1,94 @@
+package main
+
+import "testing"
+
+func TestEditHistory(t *testing.T) {
+	e := startCommunity(t)
+	post := e.request(&CreatePost{Title: "Hello", Content: "World", Author: "alice", Subreddit: "golang"}).Data.(*FeedItem)
+	text := func(s string) *string { return &s }
+
+	history := e.request(&EditPost{Author: "alice", PostID: post.ID, Content: text("Everyone")}).Data.(*History)
+	if history.Title != "Hello" || history.Content != "Everyone" || history.EditedAt == nil || len(history.Revisions) != 1 {
+		t.Fatalf("after the first edit: %+v, want Hello/Everyone, edited, with one revision", history)
+	}
+	e.request(&EditPost{Author: "alice", PostID: post.ID, Title: text("Hi"), Content: text("All")})
+	unchanged := e.request(&EditPost{Author: "alice", PostID: post.ID, Title: text("Hi")}).Data.(*History)
+	if len(unchanged.Revisions) != 2 {
+		t.Errorf("an edit that changed nothing left %d revisions, want 2", len(unchanged.Revisions))
+	}
+
+	history = e.request(&GetPostRevisions{PostID: post.ID}).Data.(*History)
+	want := []Revision{{Title: "Hello", Content: "World"}, {Title: "Hello", Content: "Everyone"}}
+	if len(history.Revisions) != len(want) {
+		t.Fatalf("revisions = %+v, want %+v", history.Revisions, want)
+	}
+	for i, revision := range history.Revisions {
+		if revision.Title != want[i].Title || revision.Content != want[i].Content || revision.ReplacedAt.IsZero() {
+			t.Errorf("revision %d = %+v, want %+v replaced at some time", i, revision, want[i])
+		}
+	}
+	if detail := e.request(&GetPost{PostID: post.ID}).Data.(*PostDetail); detail.Title != "Hi" || detail.Content != "All" {
+		t.Errorf("post shows %q/%q, want the latest version Hi/All", detail.Title, detail.Content)
+	}
+	e.refuse(&EditPost{Author: "bob", PostID: post.ID, Content: text("Mine now")}, CodeForbidden)
+
+	comment := e.request(&CreateComment{Content: "Nice", Author: "bob", PostID: post.ID}).Data.(*CommentNode)
+	history = e.request(&EditComment{Author: "bob", CommentID: comment.ID, Content: "Very nice"}).Data.(*History)
+	if history.Content != "Very nice" || len(history.Revisions) != 1 || history.Revisions[0].Content != "Nice" {
+		t.Errorf("edited comment = %+v, want Very nice replacing Nice", history)
+	}
+	e.refuse(&EditComment{Author: "alice", CommentID: comment.ID, Content: "Rude"}, CodeForbidden)
+
+	// A moderator's removal withholds the content and every earlier version.
+	e.request(&RemoveComment{By: "alice", CommentID: comment.ID})
+	history = e.request(&GetCommentRevisions{CommentID: comment.ID}).Data.(*History)
+	if history.Content != "[removed]" || len(history.Revisions) != 0 {
+		t.Errorf("removed comment's history = %+v, want its content and revisions withheld", history)
+	}
+	e.refuse(&EditComment{Author: "bob", CommentID: comment.ID, Content: "Back"}, CodeForbidden)
+}
+
+func TestSoftDelete(t *testing.T) {
+	e := startCommunity(t)
+	post := e.request(&CreatePost{Title: "Hello", Content: "World", Author: "alice", Subreddit: "golang"}).Data.(*FeedItem)
+	comment := e.request(&CreateComment{Content: "Nice", Author: "bob", PostID: post.ID}).Data.(*CommentNode)
+	reply := e.request(&CreateComment{Content: "Agreed", Author: "carol", PostID: post.ID, ParentID: comment.ID}).Data.(*CommentNode)
+	e.request(&EditComment{Author: "bob", CommentID: comment.ID, Content: "Very nice"})
+
+	t.Run("comment", func(t *testing.T) {
+		e.refuse(&DeleteComment{Author: "alice", CommentID: comment.ID}, CodeForbidden)
+		history := e.request(&DeleteComment{Author: "bob", CommentID: comment.ID}).Data.(*History)
+		if !history.Deleted || history.Content != deletedPlaceholder || len(history.Revisions) != 0 {
+			t.Errorf("deleted comment's history = %+v, want it deleted with no content or revisions", history)
+		}
+		e.refuse(&DeleteComment{Author: "bob", CommentID: comment.ID}, CodeCommentNotFound)
+		e.refuse(&EditComment{Author: "bob", CommentID: comment.ID, Content: "Undo"}, CodeForbidden)
+		e.refuse(&CreateComment{Content: "Reply", Author: "carol", PostID: post.ID, ParentID: comment.ID}, CodeForbidden)
+
+		// It stays in the thread as a placeholder over its replies.
+		tree := e.request(&GetPostComments{PostID: post.ID}).Data.(*CommentTree)
+		node := tree.Comments[0]
+		if !node.Deleted || node.Author != deletedPlaceholder || node.Content != deletedPlaceholder {
+			t.Errorf("deleted comment shows %s: %q, want the placeholder", node.Author, node.Content)
+		}
+		if len(node.Replies) != 1 || node.Replies[0].ID != reply.ID || node.Replies[0].Content != "Agreed" {
+			t.Errorf("replies under the deleted comment = %+v, want %s intact", node.Replies, reply.ID)
+		}
+	})
+
+	t.Run("post", func(t *testing.T) {
+		e.refuse(&DeletePost{Author: "bob", PostID: post.ID}, CodeForbidden)
+		e.request(&DeletePost{Author: "alice", PostID: post.ID})
+		detail := e.request(&GetPost{PostID: post.ID}).Data.(*PostDetail)
+		if !detail.Deleted || detail.Title != deletedPlaceholder || detail.Content != "" || detail.CommentCount != 2 {
+			t.Errorf("deleted post = %q/%q with %d comments, deleted %t, want the placeholder title, no content and its 2 comments", detail.Title, detail.Content, detail.CommentCount, detail.Deleted)
+		}
+		e.refuse(&DeletePost{Author: "alice", PostID: post.ID}, CodePostNotFound)
+		e.refuse(&CreateComment{Content: "Late", Author: "carol", PostID: post.ID}, CodeForbidden)
+
+		feed := e.request(&GetUserFeed{Username: "bob", Sort: "new"}).Data.(*Feed)
+		if len(feed.Posts) != 0 {
+			t.Errorf("feed still has %d posts, want the deleted post left out", len(feed.Posts))
+		}
+	})
+}
@@ -2,7 +2,6 @@ package main
 
 import (
 	"fmt"
-	"net/http"
 	"time"
 
 	"github.com/asynkron/protoactor-go/actor"
@@ -10,12 +9,25 @@ import (
 
 // Define message types
 type RegisterUser struct {
+	Username     string
+	PasswordHash string // bcrypt hash; the plain password never reaches the engine.
+}
+
+type GetPasswordHash struct {
 	Username string
 }
 
+// Account is the engine's reply to GetPasswordHash: what login needs to
+// check a password and issue a token.
+type Account struct {
+	PasswordHash string
+	CreatedAt    time.Time
+}
+
 type CreateSubreddit struct {
 	Name        string
 	Description string
+	Creator     string // Becomes the subreddit's owner.
 }
 
 type JoinSubreddit struct {
@@ -29,10 +41,15 @@ type LeaveSubreddit struct {
 }
 
 type CreatePost struct {
-	Title     string
-	Content   string
-	Author    string
-	Subreddit string
+	Title       string
+	Content     string
+	Author      string
+	Subreddit   string
+	Kind        string           // KindText, KindLink, KindImage or KindGallery; empty means text.
+	URL         string           // Link posts only.
+	Images      []PostImage      // One for an image post; a gallery's in display order.
+	ID          string           // Assigned by the engine before the post reaches its subreddit.
+	CrosspostOf *CrosspostOrigin // Set on crossposts, which only a subreddit actor creates.
 }
 
 type CreateComment struct {
@@ -40,6 +57,7 @@ type CreateComment struct {
 	Author   string
 	PostID   string // Post ID should be handled correctly in a real scenario
 	ParentID string // Optional: ID of the parent comment
+	ID       string // Assigned by the engine before the comment reaches its subreddit.
 }
 
 type Upvote struct {
@@ -54,23 +72,183 @@ type Downvote struct {
 	TargetID  string // Can be a Post or Comment ID
 }
 
+type ClearVote struct {
+	UserID    string // Username in a real scenario
+	MediaType string //type of media
+	TargetID  string // Can be a Post or Comment ID
+}
+
 type SendDirectMessage struct {
 	From    string
-	To      string
+	To      string // May be left empty when replying; the other party of ReplyTo is used.
 	Content string
+	ReplyTo string // Optional: ID of the message being replied to.
+}
+
+type GetPostComments struct {
+	PostID       string
+	Sort         string          // "top", "new" or "controversial"; defaults to "top".
+	Depth        int             // Number of reply levels to include.
+	Limit        int             // Maximum comments per level.
+	Continuation string          // Optional: token from a "more" stub to load further comments.
+	Viewer       string          // Optional: the user reading, whose hidden comments are left out.
+	Hidden       map[string]bool // Filled in by the engine from Viewer.
+}
+
+type GetUserProfile struct {
+	Username string
+}
+
+type SetAvatar struct {
+	Username string
+	Avatar   string // Hash of an uploaded image, or empty to clear the avatar.
 }
 
 type GetUserFeed struct {
 	Username string
-	writer   http.ResponseWriter
+	Sort     string // "hot", "new", "top" or "controversial"; defaults to "hot".
+	Time     string // "day", "week" or "all"; limits top and controversial sorts. Defaults to "all".
+	Page
+}
+
+// Messages sent by subreddit actors to the engine as their state changes.
+
+// karmaChanged reports a change in the score of a user's post or comment. It
+// is not journaled: the subreddits' vote ledgers are the record of karma, and
+// the engine rebuilds it from them on start.
+type karmaChanged struct {
+	Username  string
+	Subreddit string
+	Comment   bool // Comment karma if set, post karma otherwise.
+	Delta     int
+}
+
+// karmaTotals is the karma an author has from one subreddit's posts and comments.
+type karmaTotals struct {
+	Post    int
+	Comment int
+}
+
+// plus returns t with sign times other added.
+func (t karmaTotals) plus(other karmaTotals, sign int) karmaTotals {
+	return karmaTotals{Post: t.Post + sign*other.Post, Comment: t.Comment + sign*other.Comment}
+}
+
+// subredditLoaded reports what a subreddit actor holds once it has recovered,
+// so the engine can rebuild what it derives from the subreddit's journal. The
+// post and comment IDs restore routes to any the engine did not journal
+// postCreated or commentCreated for before a crash.
+type subredditLoaded struct {
+	Subreddit string
+	Banner    string
+	Posts     []string               // IDs of the subreddit's posts.
+	Comments  map[string]string      // Map of comment ID to the ID of the post it is on.
+	Karma     map[string]karmaTotals // Map of author to the score of their posts and comments.
+}
+
+// postCreated reports that a subreddit accepted a post, so the engine can route to it.
+type postCreated struct {
+	ID        string
+	Subreddit string
+}
+
+// commentCreated reports that a subreddit accepted a comment.
+type commentCreated struct {
+	ID     string
+	PostID string
+}
+
+// membershipChanged reports a user joining or leaving a subreddit.
+type membershipChanged struct {
+	Username    string
+	Subreddit   string
+	Joined      bool
+	Subscribers int // The subreddit's member count after the change.
 }
 
 // User represents a Reddit user.
 type User struct {
-	ID       string
-	Username string
-	Karma    int
-	Inbox    []string // List of direct messages received.
+	ID            string
+	Username      string
+	PasswordHash  string           // bcrypt hash of the user's password.
+	CreatedAt     time.Time        // When the user registered; zero for accounts older than the field.
+	Avatar        string           // Hash of the user's avatar image, if any.
+	PostKarma     int              `json:"-"` // Net votes received on the user's posts; rebuilt on start.
+	CommentKarma  int              `json:"-"` // Net votes received on the user's comments; rebuilt on start.
+	Subreddits    map[string]bool  // Names of the subreddits the user has joined.
+	Saved         []*SavedItem     // Saved posts and comments, oldest first.
+	Hidden        map[string]bool  // IDs of the posts and comments the user has hidden.
+	Notifications []*Notification  // Notifications received, oldest first.
+	Muted         map[string]bool  // IDs of the posts the user gets no notifications about.
+	Inbox         []*DirectMessage `json:"-"` // Direct messages received, oldest first.
+	Sent          []*DirectMessage `json:"-"` // Direct messages sent, oldest first.
+}
+
+// Karma is the user's total karma across posts and comments.
+func (u *User) Karma() int {
+	return u.PostKarma + u.CommentKarma
+}
+
+// VoteDirection is the way a user has voted on a post or comment.
+type VoteDirection int
+
+const (
+	VoteNone VoteDirection = 0
+	VoteUp   VoteDirection = 1
+	VoteDown VoteDirection = -1
+)
+
+func (v VoteDirection) String() string {
+	switch v {
+	case VoteUp:
+		return "up"
+	case VoteDown:
+		return "down"
+	default:
+		return "none"
+	}
+}
+
+// Votes holds the vote counters of a post or comment and the ledger of who cast them.
+type Votes struct {
+	Upvotes   int
+	Downvotes int
+	Ledger    map[string]VoteDirection // Map of username to that user's current vote.
+}
+
+// Score is the net vote count.
+func (v *Votes) Score() int {
+	return v.Upvotes - v.Downvotes
+}
+
+// cast records username's vote, replacing any earlier one, and returns the vote it replaced.
+// Casting VoteNone clears the vote.
+func (v *Votes) cast(username string, vote VoteDirection) VoteDirection {
+	previous := v.Ledger[username]
+	if previous == vote {
+		return previous
+	}
+	switch previous {
+	case VoteUp:
+		v.Upvotes--
+	case VoteDown:
+		v.Downvotes--
+	}
+	switch vote {
+	case VoteUp:
+		v.Upvotes++
+	case VoteDown:
+		v.Downvotes++
+	}
+	if vote == VoteNone {
+		delete(v.Ledger, username)
+	} else {
+		if v.Ledger == nil {
+			v.Ledger = make(map[string]VoteDirection)
+		}
+		v.Ledger[username] = vote
+	}
+	return previous
 }
 
 // Post represents a Reddit post.
@@ -78,319 +256,756 @@ type Post struct {
 	ID        string
 	Title     string
 	Content   string
-	Author    *User      // Reference to the user who created the post.
+	Author    string     // Username of the user who created the post.
 	Subreddit *Subreddit // Reference to the subreddit where the post was made.
-	Upvotes   int
-	Downvotes int
-	CreatedAt time.Time
+	Kind      string     // KindText, KindLink, KindImage or KindGallery.
+	URL       string     // The target of a link post.
+	Domain    string     // The host name of URL, without "www.".
+	Images    []PostImage
+	Votes
+	CreatedAt    time.Time
+	Comments     []*Comment // Top-level comments, in creation order.
+	CommentCount int        // Number of comments at any depth.
+	Removal      *Removal   // Set when a moderator has removed the post.
+	Edits
+	CrosspostOf *CrosspostOrigin // The post this one shares, if it is a crosspost.
+	Crossposts  []CrosspostRef   // Crossposts of this post, oldest first.
 }
 
 // Comment represents a comment on a post.
 type Comment struct {
-	ID        string
-	Content   string
-	Author    *User   // Reference to the user who created the comment.
-	Post      *Post   // Reference to the post where the comment was made.
-	ParentID  *string // Optional: ID of the parent comment for hierarchical comments.
-	Upvotes   int
-	Downvotes int
+	ID       string
+	Content  string
+	Author   string  // Username of the user who created the comment.
+	Post     *Post   // Reference to the post where the comment was made.
+	ParentID *string // Optional: ID of the parent comment for hierarchical comments.
+	Votes
 	CreatedAt time.Time
+	Replies   []*Comment // Direct replies, in creation order.
+	Removal   *Removal   // Set when a moderator has removed the comment.
+	Edits
 }
 
-// Subreddit represents a subreddit.
+// Subreddit represents a subreddit. It is owned by the subreddit's SubredditActor.
 type Subreddit struct {
-	ID          string           // Unique identifier for the subreddit.
-	Name        string           // Name of the subreddit.
-	Description string           // Description of the subreddit.
-	Members     map[string]*User // Map of usernames to User objects who are members of the subreddit.
+	ID          string               // Unique identifier for the subreddit.
+	Name        string               // Name of the subreddit.
+	Description string               // Description of the subreddit.
+	CreatedAt   time.Time            // When the subreddit was created.
+	Members     map[string]time.Time // Map of member usernames to when they joined.
+	Subscribers int                  // Number of members.
+	Owner       string               // Username of the creator, who has every moderator permission.
+	Moderators  map[string]*Moderator
+	Bans        map[string]*Ban
+	Banner      string  // Hash of the subreddit's banner image, if any.
+	Posts       []*Post // Posts made in the subreddit, in creation order.
+}
+
+// SubredditRef is the engine's directory entry for a subreddit actor.
+type SubredditRef struct {
+	Name        string
+	Description string
+	Owner       string
+	CreatedAt   time.Time
+	Subscribers int    // Kept in step with the subreddit's members by membershipChanged.
+	Banner      string // Kept in step with the subreddit by subredditLoaded and bannerChanged.
+	PID         *actor.PID
 }
 
-// RedditEngine is the main actor for the Reddit clone engine.
+// RedditEngine is the main actor for the Reddit clone engine. It owns users and
+// direct messages, and supervises one SubredditActor per subreddit, routing
+// post, comment and vote traffic to the actor that owns the target.
 type RedditEngine struct {
-	users      map[string]*User      // Map of username to User details.
-	subreddits map[string]*Subreddit // Map of subreddit name to Subreddit details.
-	// usernames  map[string]string     // Map of username to user ID for quick lookup.
-	posts    map[string]*Post    // Map of post ID to Post details.
-	comments map[string]*Comment // Map of comment ID to Comment details.
+	Persistence
+	users      map[string]*User          // Map of username to User details.
+	subreddits map[string]*SubredditRef  // Map of subreddit name to its actor.
+	messages   map[string]*DirectMessage // Map of message ID to direct message.
+
+	postIndex       map[string]string // Map of post ID to the name of the subreddit holding it.
+	commentIndex    map[string]string // Map of comment ID to the ID of the post it is on.
+	postSeq         int               // Number of post IDs assigned so far.
+	commentSeq      int               // Number of comment IDs assigned so far.
+	messageSeq      int               // Number of direct message IDs assigned so far.
+	notificationSeq int               // Number of notification IDs assigned so far.
+
+	index *searchIndex                      // Full-text index of subreddits, posts and comments; rebuilt on start.
+	karma map[string]map[string]karmaTotals // Map of subreddit name to each author's karma from it; rebuilt on start.
+
+	feedTimeout time.Duration // How long a feed waits on slow subreddits before replying without them.
+}
+
+// NewRedditEngine returns an engine persisting to provider, or in memory only if provider is nil.
+func NewRedditEngine(provider *FileProvider, feedTimeout time.Duration) *RedditEngine {
+	return &RedditEngine{
+		Persistence:  Persistence{provider: provider},
+		users:        make(map[string]*User),
+		subreddits:   make(map[string]*SubredditRef),
+		messages:     make(map[string]*DirectMessage),
+		postIndex:    make(map[string]string),
+		commentIndex: make(map[string]string),
+		index:        newSearchIndex(),
+		karma:        make(map[string]map[string]karmaTotals),
+		feedTimeout:  feedTimeout,
+	}
+}
+
+// FeedItem is a post as it appears in a feed.
+type FeedItem struct {
+	ID             string           `json:"id"`
+	Title          string           `json:"title"`
+	Subreddit      string           `json:"subreddit"`
+	Author         string           `json:"author"`
+	Score          int              `json:"score"`
+	Upvotes        int              `json:"upvotes"`
+	Downvotes      int              `json:"downvotes"`
+	CommentCount   int              `json:"comment_count"`
+	CreatedAt      time.Time        `json:"created_at"`
+	EditedAt       *time.Time       `json:"edited_at,omitempty"`
+	Kind           string           `json:"kind"`
+	Link           *LinkView        `json:"link,omitempty"`    // Link posts.
+	Image          *ImageView       `json:"image,omitempty"`   // Image posts.
+	Gallery        *GalleryView     `json:"gallery,omitempty"` // Gallery posts.
+	CrosspostOf    *CrosspostOrigin `json:"crosspost_of,omitempty"`
+	CrosspostCount int              `json:"crosspost_count"`
 }
 
-// to get user feed json object
-type PostInfo struct {
-	SubredditName string `json:"subreddit_name"`
-	Title         string `json:"title"`
-	AuthorName    string `json:"author_name"`
+// Feed is the engine's reply to GetUserFeed.
+type Feed struct {
+	Username string     `json:"username"`
+	Sort     string     `json:"sort"`
+	Time     string     `json:"t"`
+	Posts    []FeedItem `json:"posts"`
+	Before   string     `json:"before,omitempty"` // Cursor for the previous page, if any.
+	After    string     `json:"after,omitempty"`  // Cursor for the next page, if any.
+}
+
+// VoteResult is the engine's reply to a successful Upvote, Downvote or ClearVote.
+type VoteResult struct {
+	MediaType string `json:"media_type"`
+	TargetID  string `json:"target_id"`
+	Vote      string `json:"vote"`    // The user's vote after the request: "up", "down" or "none".
+	Changed   bool   `json:"changed"` // False when the request repeated the user's existing vote.
+	Score     int    `json:"score"`
+	Upvotes   int    `json:"upvotes"`
+	Downvotes int    `json:"downvotes"`
+}
+
+// UserProfile is the engine's reply to GetUserProfile.
+type UserProfile struct {
+	Username     string     `json:"username"`
+	Avatar       *ImageView `json:"avatar,omitempty"`
+	PostKarma    int        `json:"post_karma"`
+	CommentKarma int        `json:"comment_karma"`
+	Karma        int        `json:"karma"`
 }
 
 // Receive handles incoming messages for the RedditEngine actor.
+// State-changing messages are journaled before they are handled.
 func (re *RedditEngine) Receive(context actor.Context) {
-	switch msg := context.Message().(type) {
+	defer observeMessage("engine", context.Message(), time.Now())
+	re.receive(re, context)
+	re.updateEntityCounts()
+}
+
+// events lists the messages that change the engine's own state.
+func (re *RedditEngine) events() eventRegistry {
+	return engineEvents
+}
+
+var engineEvents = eventRegistry{
+	"RegisterUser":          func() interface{} { return &RegisterUser{} },
+	"CreateSubreddit":       func() interface{} { return &CreateSubreddit{} },
+	"CreatePost":            func() interface{} { return &CreatePost{} },
+	"CreateComment":         func() interface{} { return &CreateComment{} },
+	"Crosspost":             func() interface{} { return &Crosspost{} },
+	"SendDirectMessage":     func() interface{} { return &SendDirectMessage{} },
+	"MarkMessageRead":       func() interface{} { return &MarkMessageRead{} },
+	"SetAvatar":             func() interface{} { return &SetAvatar{} },
+	"SetSaved":              func() interface{} { return &SetSaved{} },
+	"SetHidden":             func() interface{} { return &SetHidden{} },
+	"SetMuted":              func() interface{} { return &SetMuted{} },
+	"MarkNotificationsRead": func() interface{} { return &MarkNotificationsRead{} },
+	"karmaChanged":          retired,
+	"membershipChanged":     func() interface{} { return &membershipChanged{} },
+	"postCreated":           func() interface{} { return &postCreated{} },
+	"commentCreated":        func() interface{} { return &commentCreated{} },
+	"notify":                func() interface{} { return &notify{} },
+}
+
+// handle dispatches a message to its handler. It is shared by live traffic and journal replay.
+func (re *RedditEngine) handle(message interface{}, context actor.Context) {
+	switch msg := message.(type) {
 	case *RegisterUser:
-		re.registerUser(msg.Username, context)
+		re.registerUser(msg.Username, msg.PasswordHash, context)
+	case *GetPasswordHash:
+		re.getPasswordHash(msg.Username, context)
 	case *CreateSubreddit:
-		re.createSubreddit(msg.Name, msg.Description, context)
+		re.createSubreddit(msg.Name, msg.Description, msg.Creator, context)
 	case *JoinSubreddit:
 		re.joinSubreddit(msg.Username, msg.Subreddit, context)
 	case *LeaveSubreddit:
 		re.leaveSubreddit(msg.Username, msg.Subreddit, context)
 	case *CreatePost:
-		re.createPost(msg.Title, msg.Content, msg.Author, msg.Subreddit, context)
+		re.createPost(msg, context)
 	case *CreateComment:
-		re.createComment(msg.Content, msg.Author, msg.PostID, msg.ParentID, context)
+		re.createComment(msg, context)
+	case *Crosspost:
+		re.crosspost(msg, context)
+	case *crosspostCreated:
+		re.routeToPost(msg.OriginalID, context)
 	case *Upvote:
-		re.upvote(msg.UserID, msg.MediaType, msg.TargetID, context)
+		re.routeVote(msg.UserID, msg.MediaType, msg.TargetID, context)
 	case *Downvote:
-		re.downvote(msg.UserID, msg.MediaType, msg.TargetID, context)
+		re.routeVote(msg.UserID, msg.MediaType, msg.TargetID, context)
+	case *ClearVote:
+		re.routeVote(msg.UserID, msg.MediaType, msg.TargetID, context)
+	case *karmaChanged:
+		re.applyKarma(msg)
+	case *bannerChanged:
+		re.applyBanner(msg)
+	case *subredditLoaded:
+		re.loadSubreddit(msg)
+	case *retiredEvent:
+	case *membershipChanged:
+		re.applyMembership(msg)
+	case *postCreated:
+		re.postIndex[msg.ID] = msg.Subreddit
+	case *commentCreated:
+		re.commentIndex[msg.ID] = msg.PostID
+	case *notify:
+		re.notify(msg, context)
+	case *indexDocument:
+		re.index.add(msg.Doc)
+	case *unindexDocument:
+		re.index.remove(msg.Type, msg.ID)
+	case *documentScored:
+		re.index.setScore(msg.Type, msg.ID, msg.Score)
+	case *Search:
+		re.search(msg, context)
+	case *AddModerator:
+		re.routeToSubredditFor(msg.Subreddit, msg.Username, context)
+	case *RemoveModerator:
+		re.routeToSubreddit(msg.Subreddit, context)
+	case *BanUser:
+		re.routeToSubredditFor(msg.Subreddit, msg.Username, context)
+	case *UnbanUser:
+		re.routeToSubreddit(msg.Subreddit, context)
+	case *GetModerators:
+		re.routeToSubreddit(msg.Subreddit, context)
+	case *SetBanner:
+		re.routeToSubreddit(msg.Subreddit, context)
+	case *RemovePost:
+		re.routeToPost(msg.PostID, context)
+	case *RemoveComment:
+		re.routeToComment(msg.CommentID, context)
+	case *EditPost:
+		re.routeToPost(msg.PostID, context)
+	case *DeletePost:
+		re.routeToPost(msg.PostID, context)
+	case *GetPostRevisions:
+		re.routeToPost(msg.PostID, context)
+	case *GetPost:
+		re.routeToPost(msg.PostID, context)
+	case *EditComment:
+		re.routeToComment(msg.CommentID, context)
+	case *DeleteComment:
+		re.routeToComment(msg.CommentID, context)
+	case *GetCommentRevisions:
+		re.routeToComment(msg.CommentID, context)
 	case *SendDirectMessage:
-		re.sendDirectMessage(msg.From, msg.To, msg.Content, context)
+		re.sendDirectMessage(msg.From, msg.To, msg.Content, msg.ReplyTo, context)
+	case *GetMessages:
+		re.getMessages(msg, context)
+	case *MarkMessageRead:
+		re.markMessageRead(msg.Username, msg.MessageID, context)
+	case *GetPostComments:
+		msg.Hidden = re.hidden(msg.Viewer)
+		re.routeToPost(msg.PostID, context)
+	case *GetUserProfile:
+		re.getUserProfile(msg.Username, context)
+	case *SetAvatar:
+		re.setAvatar(msg, context)
+	case *SetSaved:
+		re.setSaved(msg, context)
+	case *SetHidden:
+		re.setHidden(msg, context)
+	case *GetSaved:
+		re.getSaved(msg, context)
+	case *GetNotifications:
+		re.getNotifications(msg, context)
+	case *MarkNotificationsRead:
+		re.markNotificationsRead(msg, context)
+	case *SetMuted:
+		re.setMuted(msg, context)
 	case *GetUserFeed:
-		re.getUserFeed(msg.Username, msg.writer, context)
+		re.getUserFeed(msg, context)
+	case *GetSubredditMembers:
+		re.routeToSubreddit(msg.Subreddit, context)
+	case *GetUserSubreddits:
+		re.getUserSubreddits(msg.Username, context)
+	case actor.SystemMessage, actor.AutoReceiveMessage:
+		// Lifecycle messages; recovery and the final snapshot are handled by Persistence.
 	default:
-		fmt.Println("Engine Initiallised")
+		warnf("Engine received unexpected message %T\n", message)
 	}
 }
 
-func (re *RedditEngine) registerUser(username string, context actor.Context) {
+func (re *RedditEngine) registerUser(username, passwordHash string, context actor.Context) {
 	if _, exists := re.users[username]; exists {
-		fmt.Printf("Username %s already taken\n", username)
-		context.Respond(false)
+		debugf("Username %s already taken\n", username)
+		context.Respond(failure(CodeUserExists, "Username already taken"))
 		return
 	}
-	user := &User{ID: username, Username: username}
+	user := &User{ID: username, Username: username, PasswordHash: passwordHash, CreatedAt: re.now}
 	re.users[username] = user
-	fmt.Printf("Registered new user: %s\n", username)
-	context.Respond(true)
+	debugf("Registered new user: %s\n", username)
+	context.Respond(success(nil))
+}
+
+func (re *RedditEngine) getPasswordHash(username string, context actor.Context) {
+	user, exists := re.users[username]
+	if !exists {
+		context.Respond(failure(CodeUserNotFound, "No such username"))
+		return
+	}
+	context.Respond(success(&Account{PasswordHash: user.PasswordHash, CreatedAt: user.CreatedAt}))
 }
 
-func (re *RedditEngine) createSubreddit(name, description string, context actor.Context) {
+// createSubreddit starts a subreddit owned by its creator.
+func (re *RedditEngine) createSubreddit(name, description, creator string, context actor.Context) {
 	if _, exists := re.subreddits[name]; exists {
-		fmt.Printf("Subreddit %s already exists\n", name)
-		context.Respond(false)
+		debugf("Subreddit %s already exists\n", name)
+		context.Respond(failure(CodeSubredditExists, "Subreddit already exists"))
 		return
 	}
-	subreddit := &Subreddit{
-		ID:          name,
-		Name:        name,
-		Description: description,
-		Members:     make(map[string]*User),
+	if _, userExists := re.users[creator]; !userExists {
+		debugf("No such user with username %s\n", creator)
+		context.Respond(failure(CodeUserNotFound, "No such username"))
+		return
+	}
+	re.spawnSubreddit(name, description, creator, re.now, context)
+	debugf("Created new subreddit: %s\n", name)
+	context.Respond(success(nil))
+}
+
+// spawnSubreddit starts the child actor for a subreddit. The actor recovers its
+// own posts, comments and members from its journal.
+func (re *RedditEngine) spawnSubreddit(name, description, owner string, createdAt time.Time, context actor.Context) {
+	props := actor.PropsFromProducer(func() actor.Actor {
+		return NewSubredditActor(name, description, owner, createdAt, re.provider)
+	}, actor.WithMailbox(actor.Unbounded(subredditMailboxes)))
+	pid, err := context.SpawnNamed(props, "r_"+name)
+	if err != nil {
+		errorf("Error starting actor for subreddit %s: %v\n", name, err)
+		return
 	}
-	re.subreddits[name] = subreddit
-	fmt.Printf("Created new subreddit: %s\n", name)
-	context.Respond(true)
+	re.subreddits[name] = &SubredditRef{Name: name, Description: description, Owner: owner, CreatedAt: createdAt, PID: pid}
+	re.index.add(searchDocument{
+		Type:      "subreddit",
+		ID:        name,
+		Title:     name,
+		Text:      description,
+		Subreddit: name,
+		Author:    owner,
+		CreatedAt: createdAt,
+	})
 }
 
 func (re *RedditEngine) joinSubreddit(username, subredditName string, context actor.Context) {
-	user, userExists := re.users[username]
-	if !userExists {
-		fmt.Printf("No such user with username %s\n", username)
-		context.Respond(301)
+	if _, userExists := re.users[username]; !userExists {
+		debugf("No such user with username %s\n", username)
+		context.Respond(failure(CodeUserNotFound, "No such username"))
 		return
 	}
 
 	subreddit, subExists := re.subreddits[subredditName]
 	if !subExists {
-		fmt.Printf("No such subreddit with name %s\n", subredditName)
-		context.Respond(302)
+		debugf("No such subreddit with name %s\n", subredditName)
+		context.Respond(failure(CodeSubredditNotFound, "No such subreddit"))
 		return
 	}
-
-	subreddit.Members[username] = user
-	fmt.Printf("User %s joined subreddit %s\n", username, subreddit.Name)
-	context.Respond(200)
+	context.Forward(subreddit.PID)
 }
 
 func (re *RedditEngine) leaveSubreddit(username, subredditName string, context actor.Context) {
+	if _, userExists := re.users[username]; !userExists {
+		debugf("No such user with username %s\n", username)
+		context.Respond(failure(CodeUserNotFound, "No such username"))
+		return
+	}
+
 	subreddit, exists := re.subreddits[subredditName]
 	if !exists {
-		fmt.Printf("No such subreddit with name %s\n", subredditName)
-		context.Respond(301)
+		debugf("No such subreddit with name %s\n", subredditName)
+		context.Respond(failure(CodeSubredditNotFound, "No such subreddit"))
 		return
 	}
-	delete(subreddit.Members, username)
-	fmt.Printf("User %s left subreddit %s\n", username, subreddit.Name)
-	context.Respond(200)
+	context.Forward(subreddit.PID)
 }
 
-func (re *RedditEngine) createPost(title, content, authorName, subredditName string, context actor.Context) {
-	user, userExists := re.users[authorName]
-	if !userExists {
-		fmt.Printf("No such user with username %s\n", authorName)
-		context.Respond(301)
+// createPost assigns the post an ID and hands it to its subreddit, which replies
+// to the sender and reports the post back with postCreated if it accepts it.
+func (re *RedditEngine) createPost(msg *CreatePost, context actor.Context) {
+	if _, userExists := re.users[msg.Author]; !userExists {
+		debugf("No such user with username %s\n", msg.Author)
+		context.Respond(failure(CodeUserNotFound, "No such username"))
 		return
 	}
 
-	subreddit, subExists := re.subreddits[subredditName]
+	subreddit, subExists := re.subreddits[msg.Subreddit]
 	if !subExists {
-		fmt.Printf("No such subreddit with name %s\n", subredditName)
-		context.Respond(302)
+		debugf("No such subreddit with name %s\n", msg.Subreddit)
+		context.Respond(failure(CodeSubredditNotFound, "No such subreddit"))
 		return
 	}
 
-	postId := fmt.Sprintf("%s_post_%d", authorName, len(re.posts)+1)
-	post := &Post{
-		ID:        postId,
-		Title:     title,
-		Content:   content,
-		Author:    user,
-		Subreddit: subreddit,
-		CreatedAt: time.Now(),
+	if rejected := validatePostKind(msg); rejected != nil {
+		context.Respond(rejected)
+		return
 	}
-	re.posts[postId] = post
-	fmt.Printf("Created new post in subreddit %s by user %s with id %s\n", subreddit.Name, authorName, postId)
-	context.Respond(200)
+
+	re.postSeq++
+	post := *msg
+	post.ID = fmt.Sprintf("%s_post_%d", msg.Author, re.postSeq)
+	context.RequestWithCustomSender(subreddit.PID, &post, context.Sender())
 }
 
-func (re *RedditEngine) createComment(content, authorName, postId, parentId string, context actor.Context) {
-	user, userExists := re.users[authorName]
-	if !userExists {
-		fmt.Printf("No such user with username %s\n", authorName)
-		context.Respond(301)
+// createComment validates the comment's parent, assigns the comment an ID and
+// hands it to the subreddit holding the post, which reports it back with
+// commentCreated if it accepts it.
+func (re *RedditEngine) createComment(msg *CreateComment, context actor.Context) {
+	if _, userExists := re.users[msg.Author]; !userExists {
+		debugf("No such user with username %s\n", msg.Author)
+		context.Respond(failure(CodeUserNotFound, "No such username"))
 		return
 	}
 
-	post, postExists := re.posts[postId]
-	if !postExists {
-		fmt.Printf("No such post with ID %s\n", postId)
-		context.Respond(302)
+	subreddit, rejected := re.postSubreddit(msg.PostID)
+	if rejected != nil {
+		context.Respond(rejected)
 		return
 	}
 
-	commentId := fmt.Sprintf("%s_comment_%d", authorName, len(re.comments)+1)
-	comment := &Comment{
-		ID:        commentId,
-		Content:   content,
-		Author:    user,
-		Post:      post,
-		CreatedAt: time.Now(),
+	if msg.ParentID != "" { // If it's a reply to another comment
+		parentPost, exists := re.commentIndex[msg.ParentID]
+		if !exists {
+			debugf("No such parent comment with ID %s\n", msg.ParentID)
+			context.Respond(failure(CodeCommentNotFound, "No such parent comment"))
+			return
+		}
+		if parentPost != msg.PostID {
+			debugf("Parent comment %s is not on post %s\n", msg.ParentID, msg.PostID)
+			context.Respond(failure(CodeInvalidRequest, "Parent comment belongs to a different post"))
+			return
+		}
+	}
+
+	re.commentSeq++
+	comment := *msg
+	comment.ID = fmt.Sprintf("%s_comment_%d", msg.Author, re.commentSeq)
+	context.RequestWithCustomSender(subreddit.PID, &comment, context.Sender())
+}
+
+// routeVote forwards a vote to the subreddit holding its target.
+func (re *RedditEngine) routeVote(userId, mediaType, targetId string, context actor.Context) {
+	if _, exists := re.users[userId]; !exists {
+		debugf("No such user with username %s\n", userId)
+		context.Respond(failure(CodeUserNotFound, "No such username"))
+		return
 	}
-	if parentId != "" { // If it's a reply to another comment
-		comment.ParentID = &parentId
+
+	subreddit, rejected := re.targetSubreddit(mediaType, targetId)
+	if rejected != nil {
+		context.Respond(rejected)
+		return
 	}
-	re.comments[commentId] = comment
-	fmt.Printf("Created new comment on post %s by user %s with id %s\n", postId, authorName, commentId)
-	context.Respond(200)
+	context.Forward(subreddit.PID)
 }
 
-func (re *RedditEngine) upvote(userId, mediaType string, targetId string, context actor.Context) {
-	if mediaType == "Post" {
-		if post, exists := re.posts[targetId]; exists { // Upvoting a post
-			post.Upvotes++
-			fmt.Printf("User %s upvoted post %s\n", userId, targetId)
-			context.Respond(201)
-			return
-		} else {
-			fmt.Printf("No such Post with ID %s for upvote\n", targetId)
-			context.Respond(301)
-		}
-	} else {
-		if mediaType == "Comment" {
-			if comment, exists := re.comments[targetId]; exists { // Upvoting a comment
-				comment.Upvotes++
-				fmt.Printf("User %s upvoted comment %s\n", userId, targetId)
-				context.Respond(202)
-				return
-			}
-		} else {
-			fmt.Printf("No such comment with ID %s for upvote\n", targetId)
-			context.Respond(302)
+// targetSubreddit returns the subreddit holding the post or comment that
+// mediaType and targetId name.
+func (re *RedditEngine) targetSubreddit(mediaType, targetId string) (*SubredditRef, *Result) {
+	switch mediaType {
+	case "Post":
+		return re.postSubreddit(targetId)
+	case "Comment":
+		postId, exists := re.commentIndex[targetId]
+		if !exists {
+			debugf("No such comment with ID %s\n", targetId)
+			return nil, failure(CodeCommentNotFound, "No such comment")
 		}
+		return re.postSubreddit(postId)
 	}
+	debugf("Unknown media type %s\n", mediaType)
+	return nil, failure(CodeInvalidRequest, "media_type must be Post or Comment")
 }
 
-func (re *RedditEngine) downvote(userId, mediaType string, targetId string, context actor.Context) {
-	if mediaType == "Post" {
-		if post, exists := re.posts[targetId]; exists { // Upvoting a post
-			post.Downvotes++
-			fmt.Printf("User %s downvoted post %s\n", userId, targetId)
-			context.Respond(201)
-			return
-		} else {
-			fmt.Printf("No such Post with ID %s for downvote\n", targetId)
-			context.Respond(301)
+// postSubreddit returns the subreddit holding the post with postId.
+func (re *RedditEngine) postSubreddit(postId string) (*SubredditRef, *Result) {
+	name, exists := re.postIndex[postId]
+	if !exists {
+		debugf("No such post with ID %s\n", postId)
+		return nil, failure(CodePostNotFound, "No such post")
+	}
+	subreddit, exists := re.subreddits[name]
+	if !exists {
+		debugf("No such subreddit with name %s for post %s\n", name, postId)
+		return nil, failure(CodeSubredditNotFound, "No such subreddit")
+	}
+	return subreddit, nil
+}
+
+// routeToSubreddit forwards a request about a subreddit to its actor.
+func (re *RedditEngine) routeToSubreddit(subredditName string, context actor.Context) {
+	subreddit, exists := re.subreddits[subredditName]
+	if !exists {
+		debugf("No such subreddit with name %s\n", subredditName)
+		context.Respond(failure(CodeSubredditNotFound, "No such subreddit"))
+		return
+	}
+	context.Forward(subreddit.PID)
+}
+
+// routeToSubredditFor forwards a request about username to a subreddit, once username is known to exist.
+func (re *RedditEngine) routeToSubredditFor(subredditName, username string, context actor.Context) {
+	if _, exists := re.users[username]; !exists {
+		debugf("No such user with username %s\n", username)
+		context.Respond(failure(CodeUserNotFound, "No such username"))
+		return
+	}
+	re.routeToSubreddit(subredditName, context)
+}
+
+// routeToComment forwards a request about a comment to the subreddit holding it.
+func (re *RedditEngine) routeToComment(commentId string, context actor.Context) {
+	postId, exists := re.commentIndex[commentId]
+	if !exists {
+		debugf("No such comment with ID %s\n", commentId)
+		context.Respond(failure(CodeCommentNotFound, "No such comment"))
+		return
+	}
+	re.routeToPost(postId, context)
+}
+
+// routeToPost forwards a request about a post to the subreddit holding it.
+func (re *RedditEngine) routeToPost(postId string, context actor.Context) {
+	subreddit, rejected := re.postSubreddit(postId)
+	if rejected != nil {
+		context.Respond(rejected)
+		return
+	}
+	context.Forward(subreddit.PID)
+}
+
+func (re *RedditEngine) applyKarma(msg *karmaChanged) {
+	totals := re.karma[msg.Subreddit]
+	if totals == nil {
+		totals = make(map[string]karmaTotals)
+		re.karma[msg.Subreddit] = totals
+	}
+	delta := karmaTotals{Post: msg.Delta}
+	if msg.Comment {
+		delta = karmaTotals{Comment: msg.Delta}
+	}
+	totals[msg.Username] = totals[msg.Username].plus(delta, 1)
+	re.addKarma(msg.Username, delta, 1)
+}
+
+// loadSubreddit routes to the posts and comments a subreddit reports on start,
+// takes its banner, and replaces the karma the engine counted from it with the
+// subreddit's totals. A restarted subreddit reports again, so its earlier
+// totals are taken back first.
+func (re *RedditEngine) loadSubreddit(msg *subredditLoaded) {
+	if subreddit, exists := re.subreddits[msg.Subreddit]; exists {
+		subreddit.Banner = msg.Banner
+	}
+	for _, id := range msg.Posts {
+		re.postIndex[id] = msg.Subreddit
+	}
+	for id, postId := range msg.Comments {
+		re.commentIndex[id] = postId
+	}
+	for author, totals := range re.karma[msg.Subreddit] {
+		re.addKarma(author, totals, -1)
+	}
+	re.karma[msg.Subreddit] = msg.Karma
+	for author, totals := range msg.Karma {
+		re.addKarma(author, totals, 1)
+	}
+	debugf("Loaded subreddit %s: %d posts, %d comments\n", msg.Subreddit, len(msg.Posts), len(msg.Comments))
+}
+
+// addKarma adds sign times totals to username's karma.
+func (re *RedditEngine) addKarma(username string, totals karmaTotals, sign int) {
+	if user, exists := re.users[username]; exists {
+		user.PostKarma += sign * totals.Post
+		user.CommentKarma += sign * totals.Comment
+	}
+}
+
+func (re *RedditEngine) applyMembership(msg *membershipChanged) {
+	user, exists := re.users[msg.Username]
+	if !exists {
+		return
+	}
+	if msg.Joined {
+		if user.Subreddits == nil {
+			user.Subreddits = make(map[string]bool)
 		}
+		user.Subreddits[msg.Subreddit] = true
 	} else {
-		if mediaType == "Comment" {
-			if comment, exists := re.comments[targetId]; exists { // Upvoting a comment
-				comment.Downvotes++
-				fmt.Printf("User %s downvoted comment %s\n", userId, targetId)
-				context.Respond(202)
-				return
-			}
-		} else {
-			fmt.Printf("No such comment with ID %s for upvote\n", targetId)
-			context.Respond(302)
-		}
+		delete(user.Subreddits, msg.Subreddit)
+	}
+	if subreddit, exists := re.subreddits[msg.Subreddit]; exists {
+		subreddit.Subscribers = msg.Subscribers
 	}
 }
 
-func (re *RedditEngine) sendDirectMessage(fromUsername, toUsername, content string, context actor.Context) {
-	toUser, exists := re.users[toUsername]
+func (re *RedditEngine) sendDirectMessage(fromUsername, toUsername, content, replyTo string, context actor.Context) {
+	fromUser, exists := re.users[fromUsername]
 	if !exists {
-		fmt.Printf("No such recipient with username %s\n", toUsername)
-		context.Respond(302)
+		debugf("No such sender with username %s\n", fromUsername)
+		context.Respond(failure(CodeUserNotFound, "Sender doesn't exist"))
 		return
 	}
-	fromUser, exists := re.users[fromUsername]
 
-	if !exists && fromUser == nil {
-		fmt.Printf("No such sender with username %s\n", fromUsername)
-		context.Respond(301)
+	threadId := ""
+	if replyTo != "" { // If it's a reply, it continues the thread with the other party
+		original, exists := re.messages[replyTo]
+		if !exists {
+			debugf("No such message with ID %s to reply to\n", replyTo)
+			context.Respond(failure(CodeMessageNotFound, "No such message to reply to"))
+			return
+		}
+		counterpart := original.counterpart(fromUsername)
+		if counterpart == "" || (toUsername != "" && toUsername != counterpart) {
+			debugf("User %s cannot reply to message %s\n", fromUsername, replyTo)
+			context.Respond(failure(CodeForbidden, "Cannot reply to a conversation you are not part of"))
+			return
+		}
+		toUsername = counterpart
+		threadId = original.ThreadID
+	}
+
+	toUser, exists := re.users[toUsername]
+	if !exists {
+		debugf("No such recipient with username %s\n", toUsername)
+		context.Respond(failure(CodeUserNotFound, "Receiver doesn't exist"))
 		return
 	}
 
-	message := fmt.Sprintf("From:% s -% s", fromUsername, content)
+	re.messageSeq++
+	messageId := fmt.Sprintf("%s_message_%d", fromUsername, re.messageSeq)
+	if threadId == "" {
+		threadId = messageId
+	}
+	message := &DirectMessage{
+		ID:       messageId,
+		From:     fromUser.Username,
+		To:       toUser.Username,
+		Body:     content,
+		SentAt:   re.now,
+		ReplyTo:  replyTo,
+		ThreadID: threadId,
+	}
+	re.messages[messageId] = message
+	fromUser.Sent = append(fromUser.Sent, message)
 	toUser.Inbox = append(toUser.Inbox, message)
-	fmt.Printf("Direct message sent from%s to%s \n", fromUsername, toUsername)
-	context.Respond(200)
+	publish(context, &UserEvent{Recipients: map[string]bool{toUser.Username: true}, Type: EventMessage, Data: *message})
+	debugf("Direct message %s sent from %s to %s\n", messageId, fromUsername, toUsername)
+	context.Respond(success(*message))
 }
 
-func (re *RedditEngine) getUserFeed(username string, w http.ResponseWriter, context actor.Context) {
+func (re *RedditEngine) getUserProfile(username string, context actor.Context) {
 	user, exists := re.users[username]
 	if !exists {
-		fmt.Printf("No such user with username%s \n", username)
-		jsonData := map[string]interface{}{
-			"error": "User doesn't exist",
-		}
-		JSONSuccess(w, jsonData)
-		context.Respond(200)
+		debugf("No such user with username %s\n", username)
+		context.Respond(failure(CodeUserNotFound, "No such username"))
 		return
 	}
+	context.Respond(success(userProfile(user)))
+}
 
-	fmt.Printf("Feed fetched for%s :\n", username)
-
-	// var posts []PostInfo
-
-	// for _, post := range re.posts {
-	// 	if _, member := post.Subreddit.Members[user.ID]; member {
-	// 		posts = append(posts, PostInfo{
-	// 			SubredditName: post.Subreddit.Name,
-	// 			Title:         post.Title,
-	// 			AuthorName:    post.Author.Username,
-	// 		})
-	// 	}
-	// }
-	result := make(map[string]interface{})
-	posts := []map[string]string{}
-
-	for _, post := range re.posts {
-		if _, member := post.Subreddit.Members[user.ID]; member {
-			postInfo := map[string]string{
-				"subreddit": post.Subreddit.Name,
-				"title":     post.Title,
-				"author":    post.Author.Username,
-			}
-			posts = append(posts, postInfo)
-		}
+func userProfile(user *User) *UserProfile {
+	profile := &UserProfile{
+		Username:     user.Username,
+		PostKarma:    user.PostKarma,
+		CommentKarma: user.CommentKarma,
+		Karma:        user.Karma(),
+	}
+	if user.Avatar != "" {
+		avatar := imageView(PostImage{Hash: user.Avatar})
+		profile.Avatar = &avatar
+	}
+	return profile
+}
+
+// setAvatar points the user's profile at an uploaded image. The HTTP layer has
+// checked that the image exists.
+func (re *RedditEngine) setAvatar(msg *SetAvatar, context actor.Context) {
+	user, exists := re.users[msg.Username]
+	if !exists {
+		debugf("No such user with username %s\n", msg.Username)
+		context.Respond(failure(CodeUserNotFound, "No such username"))
+		return
+	}
+	user.Avatar = msg.Avatar
+	debugf("User %s set avatar %q\n", user.Username, msg.Avatar)
+	context.Respond(success(userProfile(user)))
+}
+
+// getUserFeed ranks the posts of every subreddit the user has joined by
+// msg.Sort, with ties broken by creation time and then post ID, one page at a
+// time. The subreddits are asked in parallel by a feedCollector, which replies.
+func (re *RedditEngine) getUserFeed(msg *GetUserFeed, context actor.Context) {
+	user, exists := re.users[msg.Username]
+	if !exists {
+		debugf("No such user with username %s\n", msg.Username)
+		context.Respond(failure(CodeUserNotFound, "No such username"))
+		return
 	}
 
-	result["posts"] = posts
+	order, window := msg.Sort, msg.Time
+	if order == "" {
+		order = "hot"
+	}
+	if window == "" {
+		window = "all"
+	}
+	if !validFeedSort(order) {
+		context.Respond(failure(CodeInvalidRequest, "sort must be hot, new, top or controversial"))
+		return
+	}
+	maxAge, ok := timeWindow(window)
+	if !ok {
+		context.Respond(failure(CodeInvalidRequest, "t must be day, week or all"))
+		return
+	}
+	var since time.Time
+	if maxAge > 0 && (order == "top" || order == "controversial") {
+		since = re.now.Add(-maxAge)
+	}
 
-	// jsonData, err := json.Marshal(posts)
+	scope := fmt.Sprintf("feed/%s/%s/%s", user.Username, order, window)
+	bounds, ok := decodePage(scope, msg.Page)
+	if !ok {
+		context.Respond(failure(CodeInvalidCursor, "Invalid cursor"))
+		return
+	}
 
-	// if err != nil {
-	// 	fmt.Println("Error marshalling to JSON:", err)
-	// 	context.Respond(302)
-	// 	return
-	// }
-	JSONFeed(w, result)
-	context.Respond(200)
+	var subreddits []*actor.PID
+	for name := range user.Subreddits {
+		if subreddit, exists := re.subreddits[name]; exists {
+			subreddits = append(subreddits, subreddit.PID)
+		}
+	}
+	collector := &feedCollector{
+		feed:       &Feed{Username: user.Username, Sort: order, Time: window, Posts: []FeedItem{}},
+		request:    &GetSubredditPosts{Sort: order, Since: since, Bounds: bounds, Hidden: re.hidden(user.Username)},
+		scope:      scope,
+		subreddits: subreddits,
+		replyTo:    context.Sender(),
+		timeout:    re.feedTimeout,
+	}
+	context.Spawn(actor.PropsFromProducer(func() actor.Actor { return collector }))
 }
@@ -0,0 +1,135 @@
+package main
+
+import "testing"
+
+func TestVotesCast(t *testing.T) {
+	tests := []struct {
+		name         string
+		votes        []VoteDirection // Cast in order by the same user.
+		wantPrevious VoteDirection   // Returned by the last cast.
+		wantUp       int
+		wantDown     int
+		wantLedger   VoteDirection
+		wantInLedger bool
+	}{
+		{name: "upvote", votes: []VoteDirection{VoteUp}, wantPrevious: VoteNone, wantUp: 1, wantLedger: VoteUp, wantInLedger: true},
+		{name: "downvote", votes: []VoteDirection{VoteDown}, wantPrevious: VoteNone, wantDown: 1, wantLedger: VoteDown, wantInLedger: true},
+		{name: "repeated upvote counts once", votes: []VoteDirection{VoteUp, VoteUp}, wantPrevious: VoteUp, wantUp: 1, wantLedger: VoteUp, wantInLedger: true},
+		{name: "repeated downvote counts once", votes: []VoteDirection{VoteDown, VoteDown}, wantPrevious: VoteDown, wantDown: 1, wantLedger: VoteDown, wantInLedger: true},
+		{name: "switch up to down", votes: []VoteDirection{VoteUp, VoteDown}, wantPrevious: VoteUp, wantDown: 1, wantLedger: VoteDown, wantInLedger: true},
+		{name: "switch down to up", votes: []VoteDirection{VoteDown, VoteUp}, wantPrevious: VoteDown, wantUp: 1, wantLedger: VoteUp, wantInLedger: true},
+		{name: "clear upvote", votes: []VoteDirection{VoteUp, VoteNone}, wantPrevious: VoteUp},
+		{name: "clear without a vote", votes: []VoteDirection{VoteNone}, wantPrevious: VoteNone},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var v Votes
+			var previous VoteDirection
+			for _, vote := range tt.votes {
+				previous = v.cast("alice", vote)
+			}
+			if previous != tt.wantPrevious {
+				t.Errorf("last cast returned %v, want %v", previous, tt.wantPrevious)
+			}
+			if v.Upvotes != tt.wantUp || v.Downvotes != tt.wantDown {
+				t.Errorf("counters = %d up, %d down, want %d up, %d down", v.Upvotes, v.Downvotes, tt.wantUp, tt.wantDown)
+			}
+			if got, exists := v.Ledger["alice"]; exists != tt.wantInLedger || got != tt.wantLedger {
+				t.Errorf("ledger = %v (present %t), want %v (present %t)", got, exists, tt.wantLedger, tt.wantInLedger)
+			}
+			if score := v.Score(); score != tt.wantUp-tt.wantDown {
+				t.Errorf("Score() = %d, want %d", score, tt.wantUp-tt.wantDown)
+			}
+		})
+	}
+}
+
+func TestVotesCastKeepsUsersApart(t *testing.T) {
+	var v Votes
+	v.cast("alice", VoteUp)
+	v.cast("bob", VoteUp)
+	v.cast("carol", VoteDown)
+	v.cast("bob", VoteDown)
+	if v.Upvotes != 1 || v.Downvotes != 2 || v.Score() != -1 {
+		t.Errorf("counters = %d up, %d down, score %d, want 1 up, 2 down, score -1", v.Upvotes, v.Downvotes, v.Score())
+	}
+	if len(v.Ledger) != 3 {
+		t.Errorf("ledger has %d voters, want 3", len(v.Ledger))
+	}
+}
+
+func TestKarma(t *testing.T) {
+	re := NewRedditEngine(nil, 0)
+	re.users["alice"] = &User{Username: "alice"}
+	re.users["bob"] = &User{Username: "bob"}
+
+	steps := []struct {
+		name       string
+		apply      func()
+		wantAlice  karmaTotals
+		wantBob    karmaTotals
+		wantGolang karmaTotals // alice's totals from r/golang.
+	}{
+		{
+			name:       "post upvoted",
+			apply:      func() { re.applyKarma(&karmaChanged{Username: "alice", Subreddit: "golang", Delta: 1}) },
+			wantAlice:  karmaTotals{Post: 1},
+			wantGolang: karmaTotals{Post: 1},
+		},
+		{
+			name:       "vote switched to down",
+			apply:      func() { re.applyKarma(&karmaChanged{Username: "alice", Subreddit: "golang", Delta: -2}) },
+			wantAlice:  karmaTotals{Post: -1},
+			wantGolang: karmaTotals{Post: -1},
+		},
+		{
+			name:       "comment upvoted elsewhere",
+			apply:      func() { re.applyKarma(&karmaChanged{Username: "alice", Subreddit: "rust", Comment: true, Delta: 1}) },
+			wantAlice:  karmaTotals{Post: -1, Comment: 1},
+			wantGolang: karmaTotals{Post: -1},
+		},
+		{
+			name: "subreddit reloaded with its ledger totals",
+			apply: func() {
+				re.loadSubreddit(&subredditLoaded{Subreddit: "golang", Karma: map[string]karmaTotals{
+					"alice": {Post: 3},
+					"bob":   {Comment: 2},
+				}})
+			},
+			wantAlice:  karmaTotals{Post: 3, Comment: 1},
+			wantBob:    karmaTotals{Comment: 2},
+			wantGolang: karmaTotals{Post: 3},
+		},
+		{
+			name: "subreddit reloaded again is not counted twice",
+			apply: func() {
+				re.loadSubreddit(&subredditLoaded{Subreddit: "golang", Karma: map[string]karmaTotals{
+					"alice": {Post: 3},
+				}})
+			},
+			wantAlice:  karmaTotals{Post: 3, Comment: 1},
+			wantGolang: karmaTotals{Post: 3},
+		},
+		{
+			name:       "unknown author",
+			apply:      func() { re.applyKarma(&karmaChanged{Username: "nobody", Subreddit: "golang", Delta: 1}) },
+			wantAlice:  karmaTotals{Post: 3, Comment: 1},
+			wantGolang: karmaTotals{Post: 3},
+		},
+	}
+	for _, step := range steps {
+		step.apply()
+		for username, want := range map[string]karmaTotals{"alice": step.wantAlice, "bob": step.wantBob} {
+			user := re.users[username]
+			if got := (karmaTotals{Post: user.PostKarma, Comment: user.CommentKarma}); got != want {
+				t.Errorf("%s: %s's karma = %+v, want %+v", step.name, username, got, want)
+			}
+		}
+		if got := re.karma["golang"]["alice"]; got != step.wantGolang {
+			t.Errorf("%s: alice's r/golang totals = %+v, want %+v", step.name, got, step.wantGolang)
+		}
+	}
+	if got := re.users["alice"].Karma(); got != 4 {
+		t.Errorf("Karma() = %d, want 4", got)
+	}
+}
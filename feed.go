@@ -0,0 +1,85 @@
+package main
+
+import (
+	"sort"
+	"time"
+
+	"github.com/asynkron/protoactor-go/actor"
+)
+
+// feedCollector builds one page of a user's feed. It asks every subreddit the
+// user has joined for its share of the page in parallel, merges the replies by
+// sort key, sends the Feed to replyTo and stops. Subreddits that have not
+// replied within timeout are left out.
+type feedCollector struct {
+	feed       *Feed
+	request    *GetSubredditPosts
+	scope      string
+	subreddits []*actor.PID
+	replyTo    *actor.PID
+	timeout    time.Duration
+
+	pending   int
+	posts     []rankedPost
+	hasBefore bool
+	hasAfter  bool
+}
+
+func (fc *feedCollector) Receive(context actor.Context) {
+	switch msg := context.Message().(type) {
+	case *actor.Started:
+		fc.pending = len(fc.subreddits)
+		if fc.pending == 0 {
+			fc.finish(context)
+			return
+		}
+		for _, pid := range fc.subreddits {
+			context.Request(pid, fc.request)
+		}
+		context.SetReceiveTimeout(fc.timeout)
+	case *SubredditPosts:
+		fc.posts = append(fc.posts, msg.Posts...)
+		fc.hasBefore = fc.hasBefore || msg.HasBefore
+		fc.hasAfter = fc.hasAfter || msg.HasAfter
+		fc.pending--
+		if fc.pending == 0 {
+			fc.finish(context)
+		}
+	case *actor.ReceiveTimeout:
+		warnf("Feed for %s timed out waiting on %d subreddits\n", fc.feed.Username, fc.pending)
+		fc.finish(context)
+	}
+}
+
+// finish trims the merged posts to the page, replies and stops the collector.
+// Each subreddit returned up to a page of posts on the requested side of the
+// cursor, so the page is the first Limit merged posts when paging forwards and
+// the last Limit when paging backwards; anything trimmed means there is more.
+func (fc *feedCollector) finish(context actor.Context) {
+	context.CancelReceiveTimeout()
+	posts := fc.posts
+	sort.Slice(posts, func(i, j int) bool {
+		return posts[i].Key.before(posts[j].Key)
+	})
+
+	limit := fc.request.Bounds.Limit
+	if len(posts) > limit {
+		if fc.request.Bounds.Before != nil {
+			posts = posts[len(posts)-limit:]
+			fc.hasBefore = true
+		} else {
+			posts = posts[:limit]
+			fc.hasAfter = true
+		}
+	}
+
+	if len(posts) > 0 {
+		fc.feed.Before, fc.feed.After = pageCursors(fc.scope, posts[0].Key, posts[len(posts)-1].Key, fc.hasBefore, fc.hasAfter)
+	}
+	for _, post := range posts {
+		fc.feed.Posts = append(fc.feed.Posts, post.FeedItem)
+	}
+	debugf("Feed fetched for %s: %d posts\n", fc.feed.Username, len(fc.feed.Posts))
+	context.Send(fc.replyTo, success(fc.feed))
+	context.Stop(context.Self())
+}
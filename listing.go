@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	defaultPageLimit = 25
+	maxPageLimit     = 100
+)
+
+// sortKey positions an item in a listing. Items are ordered by Rank descending,
+// then by CreatedAt descending, then by ID descending, so the order is total.
+type sortKey struct {
+	Rank      float64 `json:"r"`
+	CreatedAt int64   `json:"t"` // Unix nanoseconds.
+	ID        string  `json:"i"`
+}
+
+// before reports whether a sorts ahead of b.
+func (a sortKey) before(b sortKey) bool {
+	if a.Rank != b.Rank {
+		return a.Rank > b.Rank
+	}
+	if a.CreatedAt != b.CreatedAt {
+		return a.CreatedAt > b.CreatedAt
+	}
+	return a.ID > b.ID
+}
+
+// controversy is Reddit's controversial score: high when there are many votes split evenly.
+func controversy(upvotes, downvotes int) float64 {
+	if upvotes <= 0 || downvotes <= 0 {
+		return 0
+	}
+	magnitude := float64(upvotes + downvotes)
+	balance := float64(downvotes) / float64(upvotes)
+	if upvotes < downvotes {
+		balance = float64(upvotes) / float64(downvotes)
+	}
+	return math.Pow(magnitude, balance)
+}
+
+// hotEpoch is the reference time for hot scoring (Reddit's own epoch).
+var hotEpoch = time.Unix(1134028003, 0)
+
+// hot is Reddit's hot ranking: the order of magnitude of the score plus a bonus
+// for recency, so a post needs ten times the votes to outrank one 12.5 hours newer.
+func hot(upvotes, downvotes int, createdAt time.Time) float64 {
+	score := upvotes - downvotes
+	order := math.Log10(math.Max(math.Abs(float64(score)), 1))
+	sign := 0.0
+	if score > 0 {
+		sign = 1
+	} else if score < 0 {
+		sign = -1
+	}
+	seconds := createdAt.Sub(hotEpoch).Seconds()
+	return math.Round((sign*order+seconds/45000)*1e7) / 1e7
+}
+
+func validFeedSort(order string) bool {
+	return order == "hot" || order == "new" || order == "top" || order == "controversial"
+}
+
+func postSortKey(post *Post, order string) sortKey {
+	key := sortKey{CreatedAt: post.CreatedAt.UnixNano(), ID: post.ID}
+	switch order {
+	case "hot":
+		key.Rank = hot(post.Upvotes, post.Downvotes, post.CreatedAt)
+	case "top":
+		key.Rank = float64(post.Score())
+	case "controversial":
+		key.Rank = controversy(post.Upvotes, post.Downvotes)
+	}
+	return key
+}
+
+// timeWindow returns how far back a "t" filter reaches; zero means no limit.
+func timeWindow(t string) (time.Duration, bool) {
+	switch t {
+	case "day":
+		return 24 * time.Hour, true
+	case "week":
+		return 7 * 24 * time.Hour, true
+	case "all":
+		return 0, true
+	}
+	return 0, false
+}
+
+// Page asks for one window of a listing: up to Limit items after the After
+// cursor, or before the Before cursor, or from the top when neither is set.
+type Page struct {
+	Limit  int
+	After  string
+	Before string
+}
+
+// listingCursor is the decoded form of an after/before token. Scope ties it to
+// the listing and sort order it was issued for. The cursor holds the sort key of
+// an item rather than an offset, so it stays valid when items are inserted or
+// when scores change; a page simply resumes from where that key now falls.
+type listingCursor struct {
+	Scope string  `json:"s"`
+	Key   sortKey `json:"k"`
+}
+
+// pageBounds is a Page with its cursor decoded.
+type pageBounds struct {
+	After  *sortKey
+	Before *sortKey
+	Limit  int
+}
+
+// decodePage checks page's cursors were issued for scope and decodes them.
+func decodePage(scope string, page Page) (pageBounds, bool) {
+	bounds := pageBounds{Limit: clamp(page.Limit, defaultPageLimit, maxPageLimit)}
+	if page.After != "" && page.Before != "" {
+		return bounds, false
+	}
+	decode := func(token string) (*sortKey, bool) {
+		if token == "" {
+			return nil, true
+		}
+		var cursor listingCursor
+		if decodeCursor(token, &cursor) != nil || cursor.Scope != scope {
+			return nil, false
+		}
+		return &cursor.Key, true
+	}
+	var afterOK, beforeOK bool
+	bounds.After, afterOK = decode(page.After)
+	bounds.Before, beforeOK = decode(page.Before)
+	return bounds, afterOK && beforeOK
+}
+
+// window returns the bounds of the items of a sorted listing of n items that fall in the page.
+func (b pageBounds) window(n int, keyAt func(i int) sortKey) (start, end int) {
+	switch {
+	case b.After != nil:
+		start = sort.Search(n, func(i int) bool { return b.After.before(keyAt(i)) })
+		end = start + b.Limit
+		if end > n {
+			end = n
+		}
+	case b.Before != nil:
+		end = sort.Search(n, func(i int) bool { return !keyAt(i).before(*b.Before) })
+		start = end - b.Limit
+		if start < 0 {
+			start = 0
+		}
+	default:
+		end = b.Limit
+		if end > n {
+			end = n
+		}
+	}
+	return start, end
+}
+
+// pageCursors returns the tokens for the pages either side of one running from first to last.
+func pageCursors(scope string, first, last sortKey, hasBefore, hasAfter bool) (before, after string) {
+	if hasBefore {
+		before = encodeCursor(listingCursor{Scope: scope, Key: first})
+	}
+	if hasAfter {
+		after = encodeCursor(listingCursor{Scope: scope, Key: last})
+	}
+	return before, after
+}
+
+// paginate returns the bounds of the window of a sorted listing of n items that
+// page asks for, and the cursors of the pages either side of it. ok is false if
+// a cursor is malformed or was issued for another scope.
+func paginate(n int, keyAt func(i int) sortKey, scope string, page Page) (start, end int, before, after string, ok bool) {
+	bounds, ok := decodePage(scope, page)
+	if !ok {
+		return 0, 0, "", "", false
+	}
+	start, end = bounds.window(n, keyAt)
+	if start < end {
+		before, after = pageCursors(scope, keyAt(start), keyAt(end-1), start > 0, end < n)
+	}
+	return start, end, before, after, true
+}
+
+func encodeCursor(cursor interface{}) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(token string, cursor interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, cursor)
+}
+
+// clamp returns fallback for non-positive values and caps the rest at max.
+func clamp(value, fallback, max int) int {
+	if value <= 0 {
+		return fallback
+	}
+	if value > max {
+		return max
+	}
+	return value
+}
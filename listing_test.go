@@ -0,0 +1,166 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestControversy(t *testing.T) {
+	tests := []struct {
+		name      string
+		upvotes   int
+		downvotes int
+		want      float64
+	}{
+		{name: "no votes", want: 0},
+		{name: "only upvotes", upvotes: 10, want: 0},
+		{name: "only downvotes", downvotes: 10, want: 0},
+		{name: "even split", upvotes: 5, downvotes: 5, want: 10},
+		{name: "mostly up", upvotes: 9, downvotes: 1, want: math.Pow(10, 1.0/9)},
+		{name: "mostly down", upvotes: 1, downvotes: 9, want: math.Pow(10, 1.0/9)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := controversy(tt.upvotes, tt.downvotes); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("controversy(%d, %d) = %v, want %v", tt.upvotes, tt.downvotes, got, tt.want)
+			}
+		})
+	}
+
+	if controversy(50, 50) <= controversy(5, 5) {
+		t.Error("a larger even split should be more controversial")
+	}
+	if controversy(50, 50) <= controversy(90, 10) {
+		t.Error("an even split should be more controversial than a lopsided one of the same size")
+	}
+}
+
+func TestHot(t *testing.T) {
+	at := hotEpoch.Add(1000 * time.Hour)
+	tests := []struct {
+		name      string
+		upvotes   int
+		downvotes int
+		createdAt time.Time
+		want      float64
+	}{
+		{name: "at the epoch with no votes", createdAt: hotEpoch, want: 0},
+		{name: "score of one counts as none", upvotes: 1, createdAt: hotEpoch, want: 0},
+		{name: "positive score", upvotes: 100, createdAt: hotEpoch, want: 2},
+		{name: "negative score", upvotes: 1, downvotes: 11, createdAt: hotEpoch, want: -1},
+		{name: "recency", createdAt: at, want: 80},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hot(tt.upvotes, tt.downvotes, tt.createdAt); math.Abs(got-tt.want) > 1e-7 {
+				t.Errorf("hot(%d, %d, %v) = %v, want %v", tt.upvotes, tt.downvotes, tt.createdAt, got, tt.want)
+			}
+		})
+	}
+
+	// Ten times the score is worth 12.5 hours of recency.
+	older := hot(101, 1, at)
+	newer := hot(11, 1, at.Add(12*time.Hour+30*time.Minute))
+	if math.Abs(older-newer) > 1e-7 {
+		t.Errorf("score 100 at t = %v, score 10 12.5 hours later = %v, want equal", older, newer)
+	}
+}
+
+func TestSortKeyBefore(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b sortKey
+		want bool
+	}{
+		{name: "higher rank first", a: sortKey{Rank: 2}, b: sortKey{Rank: 1, CreatedAt: 9}, want: true},
+		{name: "lower rank after", a: sortKey{Rank: 1, CreatedAt: 9}, b: sortKey{Rank: 2}, want: false},
+		{name: "newer first on equal rank", a: sortKey{CreatedAt: 2}, b: sortKey{CreatedAt: 1, ID: "z"}, want: true},
+		{name: "higher ID first on equal rank and time", a: sortKey{ID: "b"}, b: sortKey{ID: "a"}, want: true},
+		{name: "equal keys", a: sortKey{Rank: 1, CreatedAt: 1, ID: "a"}, b: sortKey{Rank: 1, CreatedAt: 1, ID: "a"}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.a.before(tt.b); got != tt.want {
+				t.Errorf("%+v.before(%+v) = %t, want %t", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodePage(t *testing.T) {
+	key := sortKey{Rank: 1, CreatedAt: 2, ID: "post"}
+	cursor := encodeCursor(listingCursor{Scope: "feed/alice/hot", Key: key})
+	tests := []struct {
+		name      string
+		page      Page
+		wantOK    bool
+		wantLimit int
+		wantAfter bool
+	}{
+		{name: "first page", page: Page{}, wantOK: true, wantLimit: defaultPageLimit},
+		{name: "limit capped", page: Page{Limit: 1000}, wantOK: true, wantLimit: maxPageLimit},
+		{name: "after cursor", page: Page{Limit: 5, After: cursor}, wantOK: true, wantLimit: 5, wantAfter: true},
+		{name: "before and after", page: Page{After: cursor, Before: cursor}, wantOK: false},
+		{name: "malformed cursor", page: Page{After: "not a cursor!"}, wantOK: false},
+		{name: "cursor for another scope", page: Page{Before: encodeCursor(listingCursor{Scope: "feed/bob/hot", Key: key})}, wantOK: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bounds, ok := decodePage("feed/alice/hot", tt.page)
+			if ok != tt.wantOK {
+				t.Fatalf("ok = %t, want %t", ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if bounds.Limit != tt.wantLimit {
+				t.Errorf("Limit = %d, want %d", bounds.Limit, tt.wantLimit)
+			}
+			if (bounds.After != nil) != tt.wantAfter || (tt.wantAfter && *bounds.After != key) {
+				t.Errorf("After = %+v, want %+v", bounds.After, key)
+			}
+		})
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	// Ten items already in listing order: newest first.
+	keys := make([]sortKey, 10)
+	for i := range keys {
+		keys[i] = sortKey{CreatedAt: int64(100 - i), ID: string(rune('a' + i))}
+	}
+	keyAt := func(i int) sortKey { return keys[i] }
+	const scope = "subreddit/golang/new"
+
+	start, end, before, after, ok := paginate(len(keys), keyAt, scope, Page{Limit: 4})
+	if !ok || start != 0 || end != 4 || before != "" || after == "" {
+		t.Fatalf("first page = [%d, %d) before %q after %q ok %t, want [0, 4) with only an after cursor", start, end, before, after, ok)
+	}
+
+	start, end, before, next, ok := paginate(len(keys), keyAt, scope, Page{Limit: 4, After: after})
+	if !ok || start != 4 || end != 8 || before == "" || next == "" {
+		t.Fatalf("second page = [%d, %d) ok %t, want [4, 8) with both cursors", start, end, ok)
+	}
+
+	start, end, _, _, ok = paginate(len(keys), keyAt, scope, Page{Limit: 4, Before: before})
+	if !ok || start != 0 || end != 4 {
+		t.Errorf("page before the second = [%d, %d) ok %t, want [0, 4)", start, end, ok)
+	}
+
+	start, end, _, last, ok := paginate(len(keys), keyAt, scope, Page{Limit: 4, After: next})
+	if !ok || start != 8 || end != 10 || last != "" {
+		t.Errorf("last page = [%d, %d) after %q ok %t, want [8, 10) with no after cursor", start, end, last, ok)
+	}
+
+	// A new item at the top does not shift the pages a cursor points at.
+	keys = append([]sortKey{{CreatedAt: 200, ID: "new"}}, keys...)
+	start, end, _, _, ok = paginate(len(keys), keyAt, scope, Page{Limit: 4, After: after})
+	if !ok || keys[start].ID != "e" || end-start != 4 {
+		t.Errorf("second page after an insert starts at %q with %d items, want e with 4", keys[start].ID, end-start)
+	}
+
+	if _, _, _, _, ok := paginate(len(keys), keyAt, "subreddit/golang/top", Page{After: after}); ok {
+		t.Error("a cursor was accepted for a different sort of the same listing")
+	}
+}
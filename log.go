@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// logLevel is the least severe level that is printed. Per-request messages
+// are logged at debug, so the default of info keeps busy servers quiet.
+var logLevel = slog.LevelInfo
+
+// parseLogLevel turns "debug", "info", "warn" or "error" into a level.
+func parseLogLevel(name string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(strings.ToUpper(name))); err != nil {
+		return 0, fmt.Errorf("log level must be debug, info, warn or error")
+	}
+	return level, nil
+}
+
+func logf(level slog.Level, format string, args ...interface{}) {
+	if level >= logLevel {
+		fmt.Printf(format, args...)
+	}
+}
+
+func debugf(format string, args ...interface{}) { logf(slog.LevelDebug, format, args...) }
+func infof(format string, args ...interface{})  { logf(slog.LevelInfo, format, args...) }
+func warnf(format string, args ...interface{})  { logf(slog.LevelWarn, format, args...) }
+func errorf(format string, args ...interface{}) { logf(slog.LevelError, format, args...) }
@@ -1,40 +1,152 @@
 package main
 
 import (
-	"fmt"
+	"context"
+	"errors"
+	"flag"
 	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"RedditAPI/simulator"
 	"github.com/asynkron/protoactor-go/actor"
 	"github.com/gorilla/mux"
 )
 
 type RedditSystem struct {
-	system *actor.ActorSystem
+	system  *actor.ActorSystem
+	auth    *TokenSigner
+	limiter *RateLimiter
+	media   *MediaStore
+	timeout time.Duration // How long handlers wait for the engine's reply.
+	done    chan struct{} // Closed when the server starts shutting down.
 }
 
 // Initialize the global engine actor system
 var engineActor *actor.PID
 
 func main() {
-	// Initialize ProtoActor system and the RedditEngine actor
-	system := actor.NewActorSystem()
-	engineActor = system.Root.Spawn(actor.PropsFromProducer(func() actor.Actor {
-		return &RedditEngine{
-			users:      make(map[string]*User),
-			subreddits: make(map[string]*Subreddit),
-			posts:      make(map[string]*Post),
-			comments:   make(map[string]*Comment),
+	cfg, err := LoadConfig(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	logLevel = cfg.level()
+
+	// A simulation journals into a directory of its own, which is removed when
+	// it ends, so simulated users never reach the real data.
+	dataDir := cfg.DataDir
+	if cfg.Simulate {
+		if dataDir, err = os.MkdirTemp("", "reddit-simulation-"); err != nil {
+			log.Fatal(err)
 		}
+		defer os.RemoveAll(dataDir)
+	}
+	provider, err := NewFileProvider(dataDir, cfg.SnapshotInterval)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Initialize ProtoActor system and the RedditEngine actor
+	system := actor.NewActorSystem(actor.WithLoggerFactory(func(system *actor.ActorSystem) *slog.Logger {
+		handler := slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: cfg.level()})
+		return slog.New(handler).With("lib", "Proto.Actor", "system", system.ID)
 	}))
+	// Feeds give up on slow subreddits before the handler gives up on the engine,
+	// so that a partial feed is returned rather than none.
+	feedTimeout := cfg.RequestTimeout * 4 / 5
+	engineActor, err = system.Root.SpawnNamed(actor.PropsFromProducer(func() actor.Actor {
+		return NewRedditEngine(provider, feedTimeout)
+	}, actor.WithMailbox(actor.Unbounded(newMailboxGauge("engine")))), "engine")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if cfg.Simulate {
+		report, err := simulator.Run(cfg.Simulator, &engineDriver{system: system, timeout: cfg.RequestTimeout}, os.Stdout)
+		stopEngine(system, provider)
+		if err != nil {
+			os.RemoveAll(dataDir)
+			log.Fatal(err)
+		}
+		report.Print(os.Stdout)
+		return
+	}
 
-	rs := RedditSystem{system: system}
+	signer, err := NewTokenSigner(cfg.AuthSecret, cfg.TokenTTL)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if cfg.AuthSecret == "" {
+		warnf("No auth secret configured; issued tokens will not survive a restart\n")
+	}
+
+	media, err := NewMediaStore(cfg.MediaDir, cfg.MaxUploadSize)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	rs := RedditSystem{
+		system:  system,
+		auth:    signer,
+		limiter: NewRateLimiter(cfg.RateLimits),
+		media:   media,
+		timeout: cfg.RequestTimeout,
+		done:    make(chan struct{}),
+	}
 
 	// Initialize HTTP server with routes
 	router := mux.NewRouter()
 	InitializeRoutes(router, &rs)
+	server := &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           router,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+	// Event streams never finish on their own, so they are told to end when shutdown begins.
+	server.RegisterOnShutdown(func() { close(rs.done) })
+
+	// Start the server and wait for it to fail or for SIGINT or SIGTERM
+	signals, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	served := make(chan error, 1)
+	go func() {
+		infof("Starting server on %s\n", cfg.Addr)
+		served <- server.ListenAndServe()
+	}()
+	select {
+	case err := <-served:
+		log.Fatal(err)
+	case <-signals.Done():
+	}
+	stop() // A second signal kills the process at once.
+
+	infof("Shutting down; draining requests for up to %s\n", cfg.ShutdownTimeout)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		errorf("Error draining HTTP requests: %v\n", err)
+	}
+	stopEngine(system, provider)
+	infof("Shutdown complete\n")
+}
 
-	// Start the server
-	fmt.Println("Starting server on :8080")
-	log.Fatal(http.ListenAndServe(":8080", router))
+// stopEngine stops the engine once it has handled the messages already queued.
+// Its subreddit actors stop with it, each writing a final snapshot, and the
+// journals are then synced and closed.
+func stopEngine(system *actor.ActorSystem, provider *FileProvider) {
+	if err := system.Root.PoisonFuture(engineActor).Wait(); err != nil {
+		errorf("Error stopping the engine: %v\n", err)
+	}
+	if err := provider.Close(); err != nil {
+		errorf("Error closing journals: %v\n", err)
+	}
+	system.Shutdown()
 }
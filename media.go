@@ -0,0 +1,378 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif" // Registers the GIF decoder with image.Decode.
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	thumbnailSize  = 320        // Thumbnails fit in a square this many pixels wide.
+	maxImagePixels = 25_000_000 // Larger images would take too much memory to decode.
+
+	// thumbnailSlots is how many images may be decoded for thumbnails at once.
+	// A decoded image can take a hundred megabytes or more.
+	thumbnailSlots = 2
+)
+
+// mediaFormats maps the content types uploads may have to the name image.Decode
+// gives their format. Anything else is refused.
+var mediaFormats = map[string]string{
+	"image/png":  "png",
+	"image/jpeg": "jpeg",
+	"image/gif":  "gif",
+}
+
+// unsupportedMediaError explains why an upload is not an image the store accepts.
+type unsupportedMediaError struct {
+	reason string
+}
+
+func (e *unsupportedMediaError) Error() string {
+	return e.reason
+}
+
+func unsupportedMedia(format string, args ...interface{}) error {
+	return &unsupportedMediaError{reason: fmt.Sprintf(format, args...)}
+}
+
+// MediaStore keeps uploaded images on disk, each named by the SHA-256 of its
+// content, so an upload is stored once however often it is sent. Files are
+// never changed once written, and the engine refers to them by hash alone.
+// Thumbnails are made on upload and kept beside the original.
+type MediaStore struct {
+	dir     string
+	maxSize int64 // The largest upload accepted, in bytes.
+
+	slots  chan struct{} // Held while decoding an image for a thumbnail.
+	mu     sync.Mutex
+	making map[string]*thumbnailJob // Thumbnails being made, by hash.
+}
+
+// thumbnailJob is one making of a thumbnail, which requests for the same
+// thumbnail wait on rather than making their own.
+type thumbnailJob struct {
+	done chan struct{}
+	err  error
+}
+
+func NewMediaStore(dir string, maxSize int64) (*MediaStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &MediaStore{
+		dir:     dir,
+		maxSize: maxSize,
+		slots:   make(chan struct{}, thumbnailSlots),
+		making:  make(map[string]*thumbnailJob),
+	}, nil
+}
+
+// Media is the reply to an upload.
+type Media struct {
+	Hash         string `json:"hash"`
+	URL          string `json:"url"`
+	ThumbnailURL string `json:"thumbnail_url"`
+	ContentType  string `json:"content_type"`
+	Size         int64  `json:"size"`
+	Width        int    `json:"width"`
+	Height       int    `json:"height"`
+}
+
+func mediaURL(hash string) string {
+	return "/media/" + hash
+}
+
+func thumbnailURL(hash string) string {
+	return "/media/" + hash + "/thumb"
+}
+
+// path returns where the file with hash is kept, spread over subdirectories by
+// its first two characters. It reports false if hash is not a SHA-256 in hex.
+func (ms *MediaStore) path(hash string) (string, bool) {
+	if decoded, err := hex.DecodeString(hash); err != nil || len(decoded) != sha256.Size || hex.EncodeToString(decoded) != hash {
+		return "", false
+	}
+	return filepath.Join(ms.dir, hash[:2], hash), true
+}
+
+// Has reports whether a file with hash has been stored.
+func (ms *MediaStore) Has(hash string) bool {
+	path, valid := ms.path(hash)
+	if !valid {
+		return false
+	}
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// Put stores the content of r and returns its hash. The content is written to
+// a temporary file and checked to be a PNG, JPEG or GIF image before it is
+// renamed into place, so a file under a hash is always a complete image. Its
+// thumbnail is made before Put returns.
+func (ms *MediaStore) Put(r io.Reader) (*Media, error) {
+	temp, err := os.CreateTemp(ms.dir, "upload-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(temp.Name())
+	defer temp.Close()
+
+	digest := sha256.New()
+	size, err := io.Copy(io.MultiWriter(temp, digest), r)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := temp.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	media, err := inspectImage(temp)
+	if err != nil {
+		return nil, err
+	}
+	if err := temp.Sync(); err != nil {
+		return nil, err
+	}
+	hash := hex.EncodeToString(digest.Sum(nil))
+	path, _ := ms.path(hash)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(temp.Name(), path); err != nil {
+		return nil, err
+	}
+	if err := ms.ensureThumbnail(hash, path); err != nil {
+		// The original is stored; the thumbnail is tried again when it is asked for.
+		errorf("Error making thumbnail of %s: %v\n", hash, err)
+	}
+	media.Hash, media.URL, media.ThumbnailURL, media.Size = hash, mediaURL(hash), thumbnailURL(hash), size
+	return media, nil
+}
+
+// inspectImage checks that file holds an image of an accepted type whose
+// header decodes, and returns its type and dimensions.
+func inspectImage(file io.ReadSeeker) (*Media, error) {
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, unsupportedMedia("The upload is empty")
+	}
+	contentType := http.DetectContentType(head[:n])
+	format, accepted := mediaFormats[contentType]
+	if !accepted {
+		return nil, unsupportedMedia("Uploads must be PNG, JPEG or GIF images, not %s", strings.Split(contentType, ";")[0])
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	config, decoded, err := image.DecodeConfig(file)
+	if err != nil || decoded != format {
+		return nil, unsupportedMedia("The %s image is corrupt", format)
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > maxImagePixels {
+		return nil, unsupportedMedia("Images are limited to %d megapixels", maxImagePixels/1_000_000)
+	}
+	return &Media{ContentType: contentType, Width: config.Width, Height: config.Height}, nil
+}
+
+// Open returns the stored file with hash.
+func (ms *MediaStore) Open(hash string) (*os.File, error) {
+	path, valid := ms.path(hash)
+	if !valid {
+		return nil, os.ErrNotExist
+	}
+	return os.Open(path)
+}
+
+// OpenThumbnail returns the thumbnail of the stored image with hash. Uploads
+// get theirs when they are stored; one that is missing, such as for an image
+// stored before thumbnails were made on upload, is made now.
+func (ms *MediaStore) OpenThumbnail(hash string) (*os.File, error) {
+	path, valid := ms.path(hash)
+	if !valid {
+		return nil, os.ErrNotExist
+	}
+	if file, err := os.Open(path + ".thumb"); err == nil {
+		return file, nil
+	}
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	if err := ms.ensureThumbnail(hash, path); err != nil {
+		return nil, err
+	}
+	return os.Open(path + ".thumb")
+}
+
+// ensureThumbnail makes the thumbnail of the image at path unless it exists.
+// Requests for the same thumbnail share one making of it, and at most
+// thumbnailSlots images are decoded at once.
+func (ms *MediaStore) ensureThumbnail(hash, path string) error {
+	ms.mu.Lock()
+	if job, exists := ms.making[hash]; exists {
+		ms.mu.Unlock()
+		<-job.done
+		return job.err
+	}
+	job := &thumbnailJob{done: make(chan struct{})}
+	ms.making[hash] = job
+	ms.mu.Unlock()
+
+	if _, err := os.Stat(path + ".thumb"); err != nil {
+		ms.slots <- struct{}{}
+		job.err = writeThumbnail(path)
+		<-ms.slots
+	}
+
+	ms.mu.Lock()
+	delete(ms.making, hash)
+	ms.mu.Unlock()
+	close(job.done)
+	return job.err
+}
+
+// writeThumbnail decodes the image at path and writes its thumbnail beside it.
+// JPEG images get JPEG thumbnails and the others PNG ones, which keep
+// transparency.
+func writeThumbnail(path string) error {
+	original, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	img, format, err := image.Decode(original)
+	original.Close()
+	if err != nil {
+		return err
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(path), "thumb-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+	defer temp.Close()
+	if format == "jpeg" {
+		err = jpeg.Encode(temp, thumbnail(img), &jpeg.Options{Quality: 85})
+	} else {
+		err = png.Encode(temp, thumbnail(img))
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), path+".thumb")
+}
+
+// thumbnail scales img down to fit in a square thumbnailSize pixels wide, each
+// pixel the average of the ones it covers. Smaller images are kept as they are.
+// Only the band of source rows under one row of the thumbnail is converted to
+// RGBA at a time.
+func thumbnail(img image.Image) image.Image {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w <= thumbnailSize && h <= thumbnailSize {
+		return img
+	}
+	tw, th := thumbnailSize, thumbnailSize
+	if w > h {
+		th = max(1, h*thumbnailSize/w)
+	} else {
+		tw = max(1, w*thumbnailSize/h)
+	}
+
+	band := image.NewRGBA(image.Rect(0, 0, w, (h+th-1)/th))
+	dst := image.NewRGBA(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		y0, y1 := y*h/th, (y+1)*h/th
+		draw.Draw(band, image.Rect(0, 0, w, y1-y0), img, image.Pt(bounds.Min.X, bounds.Min.Y+y0), draw.Src)
+		for x := 0; x < tw; x++ {
+			x0, x1 := x*w/tw, (x+1)*w/tw
+			var sum [4]int
+			for sy := 0; sy < y1-y0; sy++ {
+				row := band.Pix[band.PixOffset(x0, sy):band.PixOffset(x1, sy)]
+				for i := 0; i < len(row); i += 4 {
+					sum[0] += int(row[i])
+					sum[1] += int(row[i+1])
+					sum[2] += int(row[i+2])
+					sum[3] += int(row[i+3])
+				}
+			}
+			n := (x1 - x0) * (y1 - y0)
+			out := dst.Pix[dst.PixOffset(x, y):]
+			for i := range sum {
+				out[i] = uint8(sum[i] / n)
+			}
+		}
+	}
+	return dst
+}
+
+// Handle uploading an image to the media store. The request body is the file itself.
+func UploadMediaHandler(rs *RedditSystem) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		media, err := rs.media.Put(http.MaxBytesReader(w, r.Body, rs.media.maxSize))
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			JSONError(w, CodeTooLarge, fmt.Sprintf("Uploads are limited to %d bytes", rs.media.maxSize))
+			return
+		}
+		var unsupported *unsupportedMediaError
+		if errors.As(err, &unsupported) {
+			JSONError(w, CodeUnsupportedMedia, unsupported.reason)
+			return
+		}
+		if err != nil {
+			errorf("Error storing upload: %v\n", err)
+			JSONError(w, CodeInternal, "The upload could not be stored")
+			return
+		}
+		debugf("User %s uploaded %s (%s, %d bytes)\n", actingUser(r), media.Hash, media.ContentType, media.Size)
+		JSONCreated(w, media)
+	}
+}
+
+// Handle serving a stored image or its thumbnail
+func GetMediaHandler(rs *RedditSystem, thumb bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		hash := mux.Vars(r)["hash"]
+		open, etag := rs.media.Open, hash
+		if thumb {
+			open, etag = rs.media.OpenThumbnail, hash+"-thumb"
+		}
+		file, err := open(hash)
+		if errors.Is(err, os.ErrNotExist) {
+			JSONError(w, CodeMediaNotFound, "No such media")
+			return
+		}
+		if err != nil {
+			errorf("Error reading %s: %v\n", hash, err)
+			JSONError(w, CodeInternal, "The file could not be read")
+			return
+		}
+		defer file.Close()
+		info, err := file.Stat()
+		if err != nil {
+			JSONError(w, CodeInternal, "The file could not be read")
+			return
+		}
+
+		// What is stored under a hash never changes, so it may be cached for good.
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		w.Header().Set("ETag", `"`+etag+`"`)
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		http.ServeContent(w, r, "", info.ModTime(), file)
+	}
+}
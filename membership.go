@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/asynkron/protoactor-go/actor"
+)
+
+type GetSubredditMembers struct {
+	Subreddit string
+	Page
+}
+
+type GetUserSubreddits struct {
+	Username string
+}
+
+// SetBanner sets or clears a subreddit's banner. Only the owner may.
+type SetBanner struct {
+	Subreddit string
+	By        string
+	Banner    string // Hash of an uploaded image, or empty to clear the banner.
+}
+
+// bannerChanged reports a subreddit's new banner to the engine, which shows it
+// in subreddit lists. It is not journaled: each subreddit reports its banner
+// again when it starts.
+type bannerChanged struct {
+	Subreddit string
+	Banner    string
+}
+
+// Member is one user in a subreddit's member list.
+type Member struct {
+	Username string    `json:"username"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+// MemberList is a subreddit actor's reply to GetSubredditMembers, newest member first.
+type MemberList struct {
+	Subreddit   string   `json:"subreddit"`
+	Subscribers int      `json:"subscribers"`
+	Members     []Member `json:"members"`
+	Before      string   `json:"before,omitempty"`
+	After       string   `json:"after,omitempty"`
+}
+
+// SubredditSummary describes a subreddit in a user's list of subreddits.
+type SubredditSummary struct {
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Subscribers int        `json:"subscribers"`
+	CreatedAt   time.Time  `json:"created_at"`
+	Banner      *ImageView `json:"banner,omitempty"`
+}
+
+// UserSubreddits is the engine's reply to GetUserSubreddits, in name order.
+type UserSubreddits struct {
+	Username   string             `json:"username"`
+	Subreddits []SubredditSummary `json:"subreddits"`
+}
+
+func (sa *SubredditActor) getMembers(msg *GetSubredditMembers, context actor.Context) {
+	members := make([]Member, 0, len(sa.subreddit.Members))
+	for username, joinedAt := range sa.subreddit.Members {
+		members = append(members, Member{Username: username, JoinedAt: joinedAt})
+	}
+	keyAt := func(i int) sortKey {
+		return sortKey{CreatedAt: members[i].JoinedAt.UnixNano(), ID: members[i].Username}
+	}
+	sort.Slice(members, func(i, j int) bool {
+		return keyAt(i).before(keyAt(j))
+	})
+
+	scope := fmt.Sprintf("members/%s", sa.subreddit.Name)
+	start, end, before, after, ok := paginate(len(members), keyAt, scope, msg.Page)
+	if !ok {
+		context.Respond(failure(CodeInvalidCursor, "Invalid cursor"))
+		return
+	}
+	context.Respond(success(&MemberList{
+		Subreddit:   sa.subreddit.Name,
+		Subscribers: sa.subreddit.Subscribers,
+		Members:     members[start:end],
+		Before:      before,
+		After:       after,
+	}))
+}
+
+func (re *RedditEngine) getUserSubreddits(username string, context actor.Context) {
+	user, exists := re.users[username]
+	if !exists {
+		debugf("No such user with username %s\n", username)
+		context.Respond(failure(CodeUserNotFound, "No such username"))
+		return
+	}
+
+	list := &UserSubreddits{Username: user.Username, Subreddits: []SubredditSummary{}}
+	for name := range user.Subreddits {
+		subreddit, exists := re.subreddits[name]
+		if !exists {
+			continue
+		}
+		list.Subreddits = append(list.Subreddits, SubredditSummary{
+			Name:        subreddit.Name,
+			Description: subreddit.Description,
+			Subscribers: subreddit.Subscribers,
+			CreatedAt:   subreddit.CreatedAt,
+			Banner:      bannerView(subreddit.Banner),
+		})
+	}
+	sort.Slice(list.Subreddits, func(i, j int) bool {
+		return list.Subreddits[i].Name < list.Subreddits[j].Name
+	})
+	context.Respond(success(list))
+}
+
+// setBanner points the subreddit at an uploaded banner image. The HTTP layer
+// has checked that the image exists.
+func (sa *SubredditActor) setBanner(msg *SetBanner, context actor.Context) {
+	if msg.By != sa.subreddit.Owner {
+		debugf("User %s cannot change the banner of subreddit %s\n", msg.By, sa.subreddit.Name)
+		context.Respond(failure(CodeForbidden, "Only the owner can change the banner"))
+		return
+	}
+	sa.subreddit.Banner = msg.Banner
+	context.Send(context.Parent(), &bannerChanged{Subreddit: sa.subreddit.Name, Banner: msg.Banner})
+	debugf("Subreddit %s set banner %q\n", sa.subreddit.Name, msg.Banner)
+	context.Respond(success(&SubredditSummary{
+		Name:        sa.subreddit.Name,
+		Description: sa.subreddit.Description,
+		Subscribers: sa.subreddit.Subscribers,
+		CreatedAt:   sa.subreddit.CreatedAt,
+		Banner:      bannerView(sa.subreddit.Banner),
+	}))
+}
+
+func (re *RedditEngine) applyBanner(msg *bannerChanged) {
+	if subreddit, exists := re.subreddits[msg.Subreddit]; exists {
+		subreddit.Banner = msg.Banner
+	}
+}
+
+// bannerView renders a banner image, or nil if there is none.
+func bannerView(hash string) *ImageView {
+	if hash == "" {
+		return nil
+	}
+	banner := imageView(PostImage{Hash: hash})
+	return &banner
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/asynkron/protoactor-go/actor"
+)
+
+type GetMessages struct {
+	Username string
+	Box      string // "inbox", "sent" or "conversation".
+	With     string // The other user, for the "conversation" box.
+	Page
+}
+
+type MarkMessageRead struct {
+	Username  string
+	MessageID string
+}
+
+// DirectMessage is a private message between two users.
+type DirectMessage struct {
+	ID       string    `json:"id"`
+	From     string    `json:"from"`
+	To       string    `json:"to"`
+	Body     string    `json:"body"`
+	SentAt   time.Time `json:"sent_at"`
+	Read     bool      `json:"read"`
+	ReplyTo  string    `json:"reply_to,omitempty"` // ID of the message this one answers.
+	ThreadID string    `json:"thread_id"`          // ID of the first message in the reply chain.
+}
+
+// counterpart returns the other party of the message for username, or "" if username is not part of it.
+func (dm *DirectMessage) counterpart(username string) string {
+	switch username {
+	case dm.From:
+		return dm.To
+	case dm.To:
+		return dm.From
+	}
+	return ""
+}
+
+func (dm *DirectMessage) sortKey() sortKey {
+	return sortKey{CreatedAt: dm.SentAt.UnixNano(), ID: dm.ID}
+}
+
+// MessageList is the engine's reply to GetMessages, newest message first.
+type MessageList struct {
+	Box      string          `json:"box"`
+	With     string          `json:"with,omitempty"`
+	Unread   int             `json:"unread"` // Unread messages received, across the whole list.
+	Messages []DirectMessage `json:"messages"`
+	Before   string          `json:"before,omitempty"`
+	After    string          `json:"after,omitempty"`
+}
+
+func (re *RedditEngine) getMessages(msg *GetMessages, context actor.Context) {
+	user, exists := re.users[msg.Username]
+	if !exists {
+		debugf("No such user with username %s\n", msg.Username)
+		context.Respond(failure(CodeUserNotFound, "No such username"))
+		return
+	}
+
+	var messages []*DirectMessage
+	switch msg.Box {
+	case "inbox":
+		messages = append(messages, user.Inbox...)
+	case "sent":
+		messages = append(messages, user.Sent...)
+	case "conversation":
+		if _, exists := re.users[msg.With]; !exists {
+			debugf("No such user with username %s\n", msg.With)
+			context.Respond(failure(CodeUserNotFound, "No such user to converse with"))
+			return
+		}
+		for _, message := range user.Inbox {
+			if message.From == msg.With {
+				messages = append(messages, message)
+			}
+		}
+		for _, message := range user.Sent {
+			if message.To == msg.With && message.From != message.To {
+				messages = append(messages, message)
+			}
+		}
+	}
+	sort.Slice(messages, func(i, j int) bool {
+		return messages[i].sortKey().before(messages[j].sortKey())
+	})
+
+	scope := fmt.Sprintf("messages/%s/%s/%s", user.Username, msg.Box, msg.With)
+	start, end, before, after, ok := paginate(len(messages), func(i int) sortKey {
+		return messages[i].sortKey()
+	}, scope, msg.Page)
+	if !ok {
+		context.Respond(failure(CodeInvalidCursor, "Invalid cursor"))
+		return
+	}
+
+	list := &MessageList{Box: msg.Box, With: msg.With, Messages: []DirectMessage{}, Before: before, After: after}
+	for _, message := range messages {
+		if message.To == user.Username && !message.Read {
+			list.Unread++
+		}
+	}
+	for _, message := range messages[start:end] {
+		list.Messages = append(list.Messages, *message)
+	}
+	context.Respond(success(list))
+}
+
+// markMessageRead marks a received message as read. Only the recipient may do so.
+func (re *RedditEngine) markMessageRead(username, messageId string, context actor.Context) {
+	message, exists := re.messages[messageId]
+	if !exists {
+		debugf("No such message with ID %s\n", messageId)
+		context.Respond(failure(CodeMessageNotFound, "No such message"))
+		return
+	}
+	if message.To != username {
+		debugf("User %s is not the recipient of message %s\n", username, messageId)
+		context.Respond(failure(CodeForbidden, "Only the recipient can mark a message as read"))
+		return
+	}
+	message.Read = true
+	context.Respond(success(*message))
+}
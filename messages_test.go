@@ -0,0 +1,85 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func messageIDs(list *MessageList) []string {
+	var ids []string
+	for _, message := range list.Messages {
+		ids = append(ids, message.ID)
+	}
+	return ids
+}
+
+func TestDirectMessages(t *testing.T) {
+	e := startCommunity(t)
+	send := func(from, to, content, replyTo string) DirectMessage {
+		return e.request(&SendDirectMessage{From: from, To: to, Content: content, ReplyTo: replyTo}).Data.(DirectMessage)
+	}
+	hello := send("alice", "bob", "Hello", "")
+	reply := send("bob", "", "Hi alice", hello.ID)
+	fromCarol := send("carol", "bob", "Hey", "")
+	toCarol := send("alice", "carol", "Lunch?", "")
+	again := send("alice", "", "How are you?", reply.ID)
+
+	if reply.To != "alice" || reply.ReplyTo != hello.ID || reply.ThreadID != hello.ID {
+		t.Errorf("reply to %s, answering %q in thread %q, want to alice answering %s in thread %s", reply.To, reply.ReplyTo, reply.ThreadID, hello.ID, hello.ID)
+	}
+	if again.To != "bob" || again.ThreadID != hello.ID {
+		t.Errorf("reply to the reply went to %s in thread %q, want bob in thread %s", again.To, again.ThreadID, hello.ID)
+	}
+	if fromCarol.ThreadID != fromCarol.ID {
+		t.Errorf("new message's thread = %q, want its own ID %s", fromCarol.ThreadID, fromCarol.ID)
+	}
+
+	tests := []struct {
+		name       string
+		msg        GetMessages
+		want       []string
+		wantUnread int
+	}{
+		{name: "inbox", msg: GetMessages{Username: "bob", Box: "inbox"}, want: []string{again.ID, fromCarol.ID, hello.ID}, wantUnread: 3},
+		{name: "sent", msg: GetMessages{Username: "alice", Box: "sent"}, want: []string{again.ID, toCarol.ID, hello.ID}, wantUnread: 0},
+		{name: "conversation", msg: GetMessages{Username: "bob", Box: "conversation", With: "alice"}, want: []string{again.ID, reply.ID, hello.ID}, wantUnread: 2},
+		{name: "conversation from the other side", msg: GetMessages{Username: "alice", Box: "conversation", With: "bob"}, want: []string{again.ID, reply.ID, hello.ID}, wantUnread: 1},
+		{name: "empty conversation", msg: GetMessages{Username: "bob", Box: "conversation", With: "bob"}, wantUnread: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list := e.request(&tt.msg).Data.(*MessageList)
+			if got := messageIDs(list); !reflect.DeepEqual(got, tt.want) || list.Unread != tt.wantUnread {
+				t.Errorf("messages = %v with %d unread, want %v with %d unread", got, list.Unread, tt.want, tt.wantUnread)
+			}
+		})
+	}
+
+	t.Run("pages", func(t *testing.T) {
+		first := e.request(&GetMessages{Username: "bob", Box: "inbox", Page: Page{Limit: 2}}).Data.(*MessageList)
+		rest := e.request(&GetMessages{Username: "bob", Box: "inbox", Page: Page{Limit: 2, After: first.After}}).Data.(*MessageList)
+		if got := append(messageIDs(first), messageIDs(rest)...); !reflect.DeepEqual(got, []string{again.ID, fromCarol.ID, hello.ID}) || rest.After != "" {
+			t.Errorf("pages = %v, then after %q, want the whole inbox and no further page", got, rest.After)
+		}
+		e.refuse(&GetMessages{Username: "bob", Box: "sent", Page: Page{After: first.After}}, CodeInvalidCursor)
+	})
+
+	t.Run("mark read", func(t *testing.T) {
+		e.refuse(&MarkMessageRead{Username: "alice", MessageID: hello.ID}, CodeForbidden)
+		read := e.request(&MarkMessageRead{Username: "bob", MessageID: hello.ID}).Data.(DirectMessage)
+		if !read.Read {
+			t.Error("message not marked read")
+		}
+		list := e.request(&GetMessages{Username: "bob", Box: "inbox"}).Data.(*MessageList)
+		if list.Unread != 2 || !list.Messages[2].Read {
+			t.Errorf("inbox has %d unread with %s read %t, want 2 unread with it read", list.Unread, hello.ID, list.Messages[2].Read)
+		}
+		e.refuse(&MarkMessageRead{Username: "bob", MessageID: "nobody_message_9"}, CodeMessageNotFound)
+	})
+
+	e.refuse(&SendDirectMessage{From: "carol", Content: "Butting in", ReplyTo: hello.ID}, CodeForbidden)
+	e.refuse(&SendDirectMessage{From: "alice", To: "carol", Content: "Wrong person", ReplyTo: hello.ID}, CodeForbidden)
+	e.refuse(&SendDirectMessage{From: "alice", Content: "Into the void", ReplyTo: "nobody_message_9"}, CodeMessageNotFound)
+	e.refuse(&SendDirectMessage{From: "alice", To: "nobody", Content: "Anyone?"}, CodeUserNotFound)
+	e.refuse(&GetMessages{Username: "bob", Box: "conversation", With: "nobody"}, CodeUserNotFound)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Metrics exported at /metrics. Routes are labelled by their template, such as
+// /post/{id}/comments, so the number of series stays bounded.
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "reddit_http_requests_total",
+		Help: "HTTP requests handled, by route, method and status code.",
+	}, []string{"route", "method", "status"})
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "reddit_http_request_duration_seconds",
+		Help:    "Time taken to handle HTTP requests, by route and method.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method"})
+	engineTimeouts = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "reddit_engine_request_timeouts_total",
+		Help: "Requests to the engine actor that timed out waiting for a reply.",
+	})
+	actorMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "reddit_actor_messages_total",
+		Help: "Messages handled by the engine and subreddit actors, by actor and message type.",
+	}, []string{"actor", "type"})
+	actorDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "reddit_actor_message_duration_seconds",
+		Help:    "Time taken to handle a message, including journaling, by actor and message type.",
+		Buckets: []float64{.00001, .00005, .0001, .0005, .001, .005, .01, .05, .1, .5, 1},
+	}, []string{"actor", "type"})
+	mailboxDepth = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "reddit_actor_mailbox_depth",
+		Help: "Messages waiting in actor mailboxes, summed over the actors of each kind.",
+	}, []string{"actor"})
+	entityCount = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "reddit_entities",
+		Help: "Users, subreddits, posts and comments known to the engine. Posts and comments include removed and deleted ones.",
+	}, []string{"kind"})
+)
+
+// observeMessage records an actor handling message, which began at began.
+func observeMessage(actorKind string, message interface{}, began time.Time) {
+	messageType := strings.TrimPrefix(fmt.Sprintf("%T", message), "*")
+	messageType = strings.TrimPrefix(messageType, "main.")
+	actorMessages.WithLabelValues(actorKind, messageType).Inc()
+	actorDuration.WithLabelValues(actorKind, messageType).Observe(time.Since(began).Seconds())
+}
+
+// mailboxGauge tracks the depth of the mailboxes of one kind of actor. It is
+// installed as mailbox middleware with actor.WithMailbox(actor.Unbounded(...)).
+type mailboxGauge struct {
+	depth prometheus.Gauge
+}
+
+func newMailboxGauge(actorKind string) *mailboxGauge {
+	return &mailboxGauge{depth: mailboxDepth.WithLabelValues(actorKind)}
+}
+
+// subredditMailboxes is shared by every subreddit actor's mailbox.
+var subredditMailboxes = newMailboxGauge("subreddit")
+
+func (m *mailboxGauge) MailboxStarted()                     {}
+func (m *mailboxGauge) MessagePosted(message interface{})   { m.depth.Inc() }
+func (m *mailboxGauge) MessageReceived(message interface{}) { m.depth.Dec() }
+func (m *mailboxGauge) MailboxEmpty()                       {}
+
+// updateEntityCounts publishes the engine's entity counts. It runs on the engine
+// actor after each message, since the maps it reads are not safe to share.
+func (re *RedditEngine) updateEntityCounts() {
+	entityCount.WithLabelValues("users").Set(float64(len(re.users)))
+	entityCount.WithLabelValues("subreddits").Set(float64(len(re.subreddits)))
+	entityCount.WithLabelValues("posts").Set(float64(len(re.postIndex)))
+	entityCount.WithLabelValues("comments").Set(float64(len(re.commentIndex)))
+}
+
+// statusRecorder remembers the status code a handler wrote.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, so streaming still flushes.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// MetricsMiddleware counts and times every request by the route it matched.
+func MetricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := r.URL.Path
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+		began := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		httpRequests.WithLabelValues(route, r.Method, strconv.Itoa(recorder.status)).Inc()
+		httpDuration.WithLabelValues(route, r.Method).Observe(time.Since(began).Seconds())
+	})
+}
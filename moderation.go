@@ -0,0 +1,280 @@
+package main
+
+import (
+	"sort"
+	"time"
+
+	"github.com/asynkron/protoactor-go/actor"
+)
+
+// Moderator permissions. The owner of a subreddit holds all of them and is the
+// only one who can add or remove moderators.
+const (
+	PermissionPosts = "posts" // Remove posts and comments.
+	PermissionBans  = "bans"  // Ban and unban users.
+)
+
+var allPermissions = []string{PermissionPosts, PermissionBans}
+
+type AddModerator struct {
+	Subreddit   string
+	By          string   // The acting user, who must own the subreddit.
+	Username    string   // The user being made a moderator.
+	Permissions []string // Empty grants every permission.
+}
+
+type RemoveModerator struct {
+	Subreddit string
+	By        string
+	Username  string
+}
+
+type BanUser struct {
+	Subreddit string
+	By        string
+	Username  string
+	Reason    string
+	Until     time.Time // Zero bans permanently.
+}
+
+type UnbanUser struct {
+	Subreddit string
+	By        string
+	Username  string
+}
+
+type RemovePost struct {
+	By     string
+	PostID string
+	Reason string
+}
+
+type RemoveComment struct {
+	By        string
+	CommentID string
+	Reason    string
+}
+
+type GetModerators struct {
+	Subreddit string
+}
+
+// Moderator is a user allowed to moderate a subreddit.
+type Moderator struct {
+	Username    string    `json:"username"`
+	Permissions []string  `json:"permissions"`
+	AddedAt     time.Time `json:"added_at"`
+}
+
+// Ban keeps a user from posting, commenting in or joining a subreddit.
+type Ban struct {
+	Username string     `json:"username"`
+	By       string     `json:"by"`
+	Reason   string     `json:"reason,omitempty"`
+	BannedAt time.Time  `json:"banned_at"`
+	Until    *time.Time `json:"until,omitempty"` // Nil for a permanent ban.
+}
+
+// activeAt reports whether the ban is in force at t.
+func (b *Ban) activeAt(t time.Time) bool {
+	return b.Until == nil || t.Before(*b.Until)
+}
+
+// Removal records a moderator taking down a post or comment.
+type Removal struct {
+	By        string    `json:"by"`
+	Reason    string    `json:"reason,omitempty"`
+	RemovedAt time.Time `json:"removed_at"`
+}
+
+// ModeratorList is a subreddit actor's reply to GetModerators.
+type ModeratorList struct {
+	Subreddit  string       `json:"subreddit"`
+	Owner      string       `json:"owner"`
+	Moderators []*Moderator `json:"moderators"`
+}
+
+// can reports whether username holds permission in the subreddit.
+func (sa *SubredditActor) can(username, permission string) bool {
+	if username == sa.subreddit.Owner {
+		return true
+	}
+	moderator, exists := sa.subreddit.Moderators[username]
+	if !exists {
+		return false
+	}
+	for _, held := range moderator.Permissions {
+		if held == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// banned reports whether username is banned from the subreddit at the time of the current message.
+func (sa *SubredditActor) banned(username string) bool {
+	ban, exists := sa.subreddit.Bans[username]
+	return exists && ban.activeAt(sa.now)
+}
+
+// addModerator makes a user a moderator, or replaces the permissions of an existing one.
+func (sa *SubredditActor) addModerator(msg *AddModerator, context actor.Context) {
+	if msg.By != sa.subreddit.Owner {
+		debugf("User %s cannot add moderators to subreddit %s\n", msg.By, sa.subreddit.Name)
+		context.Respond(failure(CodeForbidden, "Only the owner can add moderators"))
+		return
+	}
+	if msg.Username == sa.subreddit.Owner {
+		context.Respond(failure(CodeInvalidRequest, "The owner is already a moderator"))
+		return
+	}
+
+	permissions := msg.Permissions
+	if len(permissions) == 0 {
+		permissions = allPermissions
+	}
+	for _, permission := range permissions {
+		if permission != PermissionPosts && permission != PermissionBans {
+			context.Respond(failure(CodeInvalidRequest, "permissions must be posts or bans"))
+			return
+		}
+	}
+
+	moderator := &Moderator{Username: msg.Username, Permissions: permissions, AddedAt: sa.now}
+	if existing, exists := sa.subreddit.Moderators[msg.Username]; exists {
+		moderator.AddedAt = existing.AddedAt
+	}
+	sa.subreddit.Moderators[msg.Username] = moderator
+	debugf("User %s is now a moderator of subreddit %s\n", msg.Username, sa.subreddit.Name)
+	context.Respond(success(moderator))
+}
+
+func (sa *SubredditActor) removeModerator(msg *RemoveModerator, context actor.Context) {
+	if msg.By != sa.subreddit.Owner {
+		debugf("User %s cannot remove moderators from subreddit %s\n", msg.By, sa.subreddit.Name)
+		context.Respond(failure(CodeForbidden, "Only the owner can remove moderators"))
+		return
+	}
+	if _, exists := sa.subreddit.Moderators[msg.Username]; !exists {
+		context.Respond(failure(CodeUserNotFound, "No such moderator"))
+		return
+	}
+	delete(sa.subreddit.Moderators, msg.Username)
+	debugf("User %s is no longer a moderator of subreddit %s\n", msg.Username, sa.subreddit.Name)
+	context.Respond(success(nil))
+}
+
+// banUser bans a user, replacing any earlier ban. Only the owner can ban a moderator,
+// and the owner cannot be banned.
+func (sa *SubredditActor) banUser(msg *BanUser, context actor.Context) {
+	if !sa.can(msg.By, PermissionBans) {
+		debugf("User %s cannot ban users from subreddit %s\n", msg.By, sa.subreddit.Name)
+		context.Respond(failure(CodeForbidden, "You do not have permission to ban users here"))
+		return
+	}
+	if msg.Username == sa.subreddit.Owner {
+		context.Respond(failure(CodeForbidden, "The owner cannot be banned"))
+		return
+	}
+	if _, moderator := sa.subreddit.Moderators[msg.Username]; moderator && msg.By != sa.subreddit.Owner {
+		context.Respond(failure(CodeForbidden, "Only the owner can ban a moderator"))
+		return
+	}
+	if !msg.Until.IsZero() && !msg.Until.After(sa.now) {
+		context.Respond(failure(CodeInvalidRequest, "until must be in the future"))
+		return
+	}
+
+	ban := &Ban{Username: msg.Username, By: msg.By, Reason: msg.Reason, BannedAt: sa.now}
+	if !msg.Until.IsZero() {
+		until := msg.Until
+		ban.Until = &until
+	}
+	sa.subreddit.Bans[msg.Username] = ban
+	debugf("User %s banned from subreddit %s by %s\n", msg.Username, sa.subreddit.Name, msg.By)
+	context.Respond(success(ban))
+}
+
+func (sa *SubredditActor) unbanUser(msg *UnbanUser, context actor.Context) {
+	if !sa.can(msg.By, PermissionBans) {
+		debugf("User %s cannot unban users from subreddit %s\n", msg.By, sa.subreddit.Name)
+		context.Respond(failure(CodeForbidden, "You do not have permission to unban users here"))
+		return
+	}
+	// An expired ban is still on record until it is lifted.
+	if _, exists := sa.subreddit.Bans[msg.Username]; !exists {
+		context.Respond(failure(CodeUserNotFound, "User is not banned"))
+		return
+	}
+	delete(sa.subreddit.Bans, msg.Username)
+	debugf("User %s unbanned from subreddit %s by %s\n", msg.Username, sa.subreddit.Name, msg.By)
+	context.Respond(success(nil))
+}
+
+// removePost takes a post out of feeds. Its comments stay readable.
+func (sa *SubredditActor) removePost(msg *RemovePost, context actor.Context) {
+	post, exists := sa.posts[msg.PostID]
+	if !exists {
+		context.Respond(failure(CodePostNotFound, "No such post"))
+		return
+	}
+	if !sa.can(msg.By, PermissionPosts) {
+		debugf("User %s cannot remove posts from subreddit %s\n", msg.By, sa.subreddit.Name)
+		context.Respond(failure(CodeForbidden, "You do not have permission to remove posts here"))
+		return
+	}
+	if post.Removal == nil {
+		post.Removal = &Removal{By: msg.By, Reason: msg.Reason, RemovedAt: sa.now}
+		context.Send(context.Parent(), &unindexDocument{Type: "post", ID: post.ID})
+		sa.notifyRemoval(post.Author, msg.By, msg.Reason, post.ID, "", context)
+	}
+	debugf("Post %s removed from subreddit %s by %s\n", post.ID, sa.subreddit.Name, msg.By)
+	context.Respond(success(post.Removal))
+}
+
+// removeComment hides a comment's content. It stays in the tree so replies still render.
+func (sa *SubredditActor) removeComment(msg *RemoveComment, context actor.Context) {
+	comment, exists := sa.comments[msg.CommentID]
+	if !exists {
+		context.Respond(failure(CodeCommentNotFound, "No such comment"))
+		return
+	}
+	if !sa.can(msg.By, PermissionPosts) {
+		debugf("User %s cannot remove comments from subreddit %s\n", msg.By, sa.subreddit.Name)
+		context.Respond(failure(CodeForbidden, "You do not have permission to remove comments here"))
+		return
+	}
+	if comment.Removal == nil {
+		comment.Removal = &Removal{By: msg.By, Reason: msg.Reason, RemovedAt: sa.now}
+		context.Send(context.Parent(), &unindexDocument{Type: "comment", ID: comment.ID})
+		sa.notifyRemoval(comment.Author, msg.By, msg.Reason, comment.Post.ID, comment.ID, context)
+	}
+	debugf("Comment %s removed from subreddit %s by %s\n", comment.ID, sa.subreddit.Name, msg.By)
+	context.Respond(success(comment.Removal))
+}
+
+// notifyRemoval tells an author a moderator removed their post or comment. The
+// notification names the subreddit's moderators rather than the one who acted.
+func (sa *SubredditActor) notifyRemoval(author, by, reason, postId, commentId string, context actor.Context) {
+	if author == by {
+		return
+	}
+	context.Send(context.Parent(), &notify{Recipients: []string{author}, Notification: Notification{
+		Type:      NotificationRemoval,
+		Subreddit: sa.subreddit.Name,
+		PostID:    postId,
+		CommentID: commentId,
+		Body:      reason,
+	}})
+}
+
+func (sa *SubredditActor) getModerators(context actor.Context) {
+	list := &ModeratorList{Subreddit: sa.subreddit.Name, Owner: sa.subreddit.Owner, Moderators: []*Moderator{}}
+	for _, moderator := range sa.subreddit.Moderators {
+		list.Moderators = append(list.Moderators, moderator)
+	}
+	sort.Slice(list.Moderators, func(i, j int) bool {
+		return list.Moderators[i].Username < list.Moderators[j].Username
+	})
+	context.Respond(success(list))
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestModeratorPermissions(t *testing.T) {
+	e := startCommunity(t)
+	e.request(&RegisterUser{Username: "dave", PasswordHash: "hash"})
+	e.request(&JoinSubreddit{Username: "dave", Subreddit: "golang"})
+	post := e.request(&CreatePost{Title: "Hello", Content: "World", Author: "carol", Subreddit: "golang"}).Data.(*FeedItem)
+	comment := e.request(&CreateComment{Content: "Hi", Author: "carol", PostID: post.ID}).Data.(*CommentNode)
+
+	e.request(&AddModerator{Subreddit: "golang", By: "alice", Username: "bob", Permissions: []string{PermissionBans}})
+	e.request(&AddModerator{Subreddit: "golang", By: "alice", Username: "dave", Permissions: []string{PermissionPosts}})
+	e.refuse(&AddModerator{Subreddit: "golang", By: "bob", Username: "carol"}, CodeForbidden)
+	e.refuse(&AddModerator{Subreddit: "golang", By: "alice", Username: "carol", Permissions: []string{"everything"}}, CodeInvalidRequest)
+	e.refuse(&AddModerator{Subreddit: "golang", By: "alice", Username: "alice"}, CodeInvalidRequest)
+
+	// Each moderator can do only what they were given.
+	e.refuse(&RemoveComment{By: "bob", CommentID: comment.ID}, CodeForbidden)
+	e.refuse(&RemovePost{By: "carol", PostID: post.ID}, CodeForbidden)
+	e.refuse(&BanUser{Subreddit: "golang", By: "dave", Username: "carol"}, CodeForbidden)
+	e.request(&RemoveComment{By: "dave", CommentID: comment.ID, Reason: "Off topic"})
+	tree := e.request(&GetPostComments{PostID: post.ID}).Data.(*CommentTree)
+	if node := tree.Comments[0]; !node.Removed || node.Content != "[removed]" {
+		t.Errorf("removed comment shows %q, removed %t, want its content withheld", node.Content, node.Removed)
+	}
+
+	// Only the owner bans moderators, and nobody bans the owner.
+	e.refuse(&BanUser{Subreddit: "golang", By: "bob", Username: "dave"}, CodeForbidden)
+	e.refuse(&BanUser{Subreddit: "golang", By: "bob", Username: "alice"}, CodeForbidden)
+	e.request(&BanUser{Subreddit: "golang", By: "alice", Username: "dave"})
+
+	e.refuse(&RemoveModerator{Subreddit: "golang", By: "bob", Username: "dave"}, CodeForbidden)
+	e.request(&RemoveModerator{Subreddit: "golang", By: "alice", Username: "dave"})
+	e.refuse(&RemoveModerator{Subreddit: "golang", By: "alice", Username: "dave"}, CodeUserNotFound)
+	e.refuse(&RemovePost{By: "dave", PostID: post.ID}, CodeForbidden)
+
+	moderators := e.request(&GetModerators{Subreddit: "golang"}).Data.(*ModeratorList)
+	if len(moderators.Moderators) != 1 || moderators.Moderators[0].Username != "bob" {
+		t.Errorf("moderators = %+v, want only bob", moderators.Moderators)
+	}
+}
+
+func TestBans(t *testing.T) {
+	e := startCommunity(t)
+	post := e.request(&CreatePost{Title: "Hello", Content: "World", Author: "alice", Subreddit: "golang"}).Data.(*FeedItem)
+
+	e.request(&BanUser{Subreddit: "golang", By: "alice", Username: "carol", Reason: "Spam"})
+	e.refuse(&CreatePost{Title: "Buy", Content: "Now", Author: "carol", Subreddit: "golang"}, CodeBanned)
+	e.refuse(&CreateComment{Content: "Buy now", Author: "carol", PostID: post.ID}, CodeBanned)
+	e.request(&LeaveSubreddit{Username: "carol", Subreddit: "golang"})
+	e.refuse(&JoinSubreddit{Username: "carol", Subreddit: "golang"}, CodeBanned)
+
+	e.request(&UnbanUser{Subreddit: "golang", By: "alice", Username: "carol"})
+	e.refuse(&UnbanUser{Subreddit: "golang", By: "alice", Username: "carol"}, CodeUserNotFound)
+	e.request(&JoinSubreddit{Username: "carol", Subreddit: "golang"})
+	e.request(&CreateComment{Content: "Sorry", Author: "carol", PostID: post.ID})
+
+	e.refuse(&BanUser{Subreddit: "golang", By: "alice", Username: "bob", Until: time.Now().Add(-time.Minute)}, CodeInvalidRequest)
+}
+
+func TestBanExpiry(t *testing.T) {
+	e := startCommunity(t)
+	post := e.request(&CreatePost{Title: "Hello", Content: "World", Author: "alice", Subreddit: "golang"}).Data.(*FeedItem)
+
+	until := time.Now().Add(200 * time.Millisecond)
+	ban := e.request(&BanUser{Subreddit: "golang", By: "alice", Username: "bob", Until: until}).Data.(*Ban)
+	if ban.Until == nil || !ban.Until.Equal(until) {
+		t.Errorf("ban until %v, want %v", ban.Until, until)
+	}
+	e.refuse(&CreateComment{Content: "Hi", Author: "bob", PostID: post.ID}, CodeBanned)
+
+	time.Sleep(time.Until(until))
+	e.request(&CreateComment{Content: "Back", Author: "bob", PostID: post.ID})
+
+	// The expired ban is still on record until a moderator lifts it.
+	e.request(&UnbanUser{Subreddit: "golang", By: "alice", Username: "bob"})
+	e.refuse(&UnbanUser{Subreddit: "golang", By: "alice", Username: "bob"}, CodeUserNotFound)
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/asynkron/protoactor-go/actor"
+)
+
+// maxNotifications is how many notifications a user keeps; older ones are dropped.
+const maxNotifications = 500
+
+// Notification types.
+const (
+	NotificationReply   = "reply"   // A comment on the user's post or a reply to their comment.
+	NotificationMention = "mention" // A post or comment naming the user as u/username.
+	NotificationRemoval = "removal" // A moderator removed the user's post or comment.
+)
+
+// mentionPattern matches u/username where it is not part of a longer word or path.
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w/])u/([\w-]+)`)
+
+type GetNotifications struct {
+	Username string
+	Unread   bool // Only list unread notifications.
+	Page
+}
+
+// MarkNotificationsRead marks one of the user's notifications as read, or all
+// of them if NotificationID is empty.
+type MarkNotificationsRead struct {
+	Username       string
+	NotificationID string
+}
+
+// SetMuted stops or restarts the user's notifications about a post and its comments.
+type SetMuted struct {
+	Username string
+	PostID   string
+	Muted    bool
+}
+
+// Notification tells a user about a reply, a mention or a moderator's removal.
+type Notification struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	From      string    `json:"from,omitempty"` // Author of the reply or mention; empty for removals.
+	Subreddit string    `json:"subreddit"`
+	PostID    string    `json:"post_id"`
+	CommentID string    `json:"comment_id,omitempty"` // The reply, the mentioning comment or the removed comment.
+	Body      string    `json:"body"`                 // The reply or mention itself, or the removal reason.
+	CreatedAt time.Time `json:"created_at"`
+	Read      bool      `json:"read"`
+}
+
+func (n *Notification) sortKey() sortKey {
+	return sortKey{CreatedAt: n.CreatedAt.UnixNano(), ID: n.ID}
+}
+
+// NotificationList is the engine's reply to GetNotifications, newest first.
+type NotificationList struct {
+	Unread        int            `json:"unread"` // Unread notifications, across the whole list.
+	Notifications []Notification `json:"notifications"`
+	Before        string         `json:"before,omitempty"`
+	After         string         `json:"after,omitempty"`
+}
+
+// NotificationsRead is the engine's reply to MarkNotificationsRead.
+type NotificationsRead struct {
+	Marked int `json:"marked"` // Notifications that were unread before the request.
+	Unread int `json:"unread"`
+}
+
+// MuteResult is the engine's reply to SetMuted.
+type MuteResult struct {
+	PostID string `json:"post_id"`
+	Muted  bool   `json:"muted"`
+}
+
+// notify asks the engine to send a notification to some users. The engine
+// assigns each copy its ID and time, and skips the notification's own author,
+// unknown users and users who have muted the post.
+type notify struct {
+	Recipients   []string
+	Notification Notification
+}
+
+// mentions returns the users named as u/username in content, once each, in
+// the order they first appear. Whether they exist is up to the engine.
+func mentions(content string) []string {
+	var usernames []string
+	seen := make(map[string]bool)
+	for _, match := range mentionPattern.FindAllStringSubmatch(content, -1) {
+		if username := match[1]; !seen[username] {
+			seen[username] = true
+			usernames = append(usernames, username)
+		}
+	}
+	return usernames
+}
+
+// notifyMentions asks the engine to notify the users mentioned in content,
+// except skip, who is being told about it some other way.
+func notifyMentions(content, skip string, notification Notification, context actor.Context) {
+	var recipients []string
+	for _, username := range mentions(content) {
+		if username != skip {
+			recipients = append(recipients, username)
+		}
+	}
+	if len(recipients) > 0 {
+		notification.Type = NotificationMention
+		context.Send(context.Parent(), &notify{Recipients: recipients, Notification: notification})
+	}
+}
+
+func (re *RedditEngine) notify(msg *notify, context actor.Context) {
+	for _, username := range msg.Recipients {
+		user, exists := re.users[username]
+		if !exists || username == msg.Notification.From || user.Muted[msg.Notification.PostID] {
+			continue
+		}
+		re.notificationSeq++
+		notification := msg.Notification
+		notification.ID = fmt.Sprintf("%s_notification_%d", username, re.notificationSeq)
+		notification.CreatedAt = re.now
+		user.Notifications = append(user.Notifications, &notification)
+		if excess := len(user.Notifications) - maxNotifications; excess > 0 {
+			user.Notifications = append([]*Notification(nil), user.Notifications[excess:]...)
+		}
+		publish(context, &UserEvent{Recipients: map[string]bool{username: true}, Type: EventNotification, Data: notification})
+		debugf("Notified %s of %s on %s\n", username, notification.Type, notification.PostID)
+	}
+}
+
+func (re *RedditEngine) getNotifications(msg *GetNotifications, context actor.Context) {
+	user, exists := re.users[msg.Username]
+	if !exists {
+		debugf("No such user with username %s\n", msg.Username)
+		context.Respond(failure(CodeUserNotFound, "No such username"))
+		return
+	}
+
+	list := &NotificationList{Notifications: []Notification{}}
+	var notifications []*Notification
+	for i := len(user.Notifications) - 1; i >= 0; i-- { // Newest first
+		notification := user.Notifications[i]
+		if !notification.Read {
+			list.Unread++
+		}
+		if !msg.Unread || !notification.Read {
+			notifications = append(notifications, notification)
+		}
+	}
+	scope := fmt.Sprintf("notifications/%s/%t", user.Username, msg.Unread)
+	start, end, before, after, ok := paginate(len(notifications), func(i int) sortKey {
+		return notifications[i].sortKey()
+	}, scope, msg.Page)
+	if !ok {
+		context.Respond(failure(CodeInvalidCursor, "Invalid cursor"))
+		return
+	}
+	list.Before, list.After = before, after
+	for _, notification := range notifications[start:end] {
+		list.Notifications = append(list.Notifications, *notification)
+	}
+	context.Respond(success(list))
+}
+
+func (re *RedditEngine) markNotificationsRead(msg *MarkNotificationsRead, context actor.Context) {
+	user, exists := re.users[msg.Username]
+	if !exists {
+		debugf("No such user with username %s\n", msg.Username)
+		context.Respond(failure(CodeUserNotFound, "No such username"))
+		return
+	}
+
+	result := &NotificationsRead{}
+	found := msg.NotificationID == ""
+	for _, notification := range user.Notifications {
+		if msg.NotificationID == "" || notification.ID == msg.NotificationID {
+			found = true
+			if !notification.Read {
+				notification.Read = true
+				result.Marked++
+			}
+		}
+		if !notification.Read {
+			result.Unread++
+		}
+	}
+	if !found {
+		debugf("No such notification %s for user %s\n", msg.NotificationID, msg.Username)
+		context.Respond(failure(CodeNotificationNotFound, "No such notification"))
+		return
+	}
+	context.Respond(success(result))
+}
+
+func (re *RedditEngine) setMuted(msg *SetMuted, context actor.Context) {
+	user, exists := re.users[msg.Username]
+	if !exists {
+		debugf("No such user with username %s\n", msg.Username)
+		context.Respond(failure(CodeUserNotFound, "No such username"))
+		return
+	}
+	if _, exists := re.postIndex[msg.PostID]; !exists {
+		debugf("No such post with ID %s\n", msg.PostID)
+		context.Respond(failure(CodePostNotFound, "No such post"))
+		return
+	}
+
+	if msg.Muted {
+		if user.Muted == nil {
+			user.Muted = make(map[string]bool)
+		}
+		user.Muted[msg.PostID] = true
+	} else {
+		delete(user.Muted, msg.PostID)
+	}
+	debugf("User %s set muted %v on post %s\n", user.Username, msg.Muted, msg.PostID)
+	context.Respond(success(&MuteResult{PostID: msg.PostID, Muted: msg.Muted}))
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMentions(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{name: "none", content: "no mentions here"},
+		{name: "at the start", content: "u/alice look", want: []string{"alice"}},
+		{name: "after a space", content: "thanks u/alice!", want: []string{"alice"}},
+		{name: "after punctuation", content: "(u/alice), \"u/bob\"", want: []string{"alice", "bob"}},
+		{name: "on a new line", content: "first\nu/alice", want: []string{"alice"}},
+		{name: "dashes and underscores", content: "u/some-user_1 and u/x", want: []string{"some-user_1", "x"}},
+		{name: "repeated", content: "u/alice u/bob u/alice", want: []string{"alice", "bob"}},
+		{name: "order of first appearance", content: "u/bob then u/alice", want: []string{"bob", "alice"}},
+		{name: "inside a word", content: "menu/alice and emu/bob", want: nil},
+		{name: "inside a path", content: "see /u/alice or example.com/u/bob", want: nil},
+		{name: "no name", content: "u/ alone", want: nil},
+		{name: "case kept", content: "u/Alice", want: []string{"Alice"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mentions(tt.content); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mentions(%q) = %q, want %q", tt.content, got, tt.want)
+			}
+		})
+	}
+}
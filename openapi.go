@@ -0,0 +1,367 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// apiParam is a query parameter of a documented route.
+type apiParam struct {
+	Name        string
+	Description string
+	Integer     bool
+	Enum        []string
+}
+
+// apiOperation documents one route. Request and Response are values of the
+// JSON request body's type and of the response's data, from which schemas are
+// generated; a string Response is an acknowledgement message.
+type apiOperation struct {
+	Summary     string
+	Query       []apiParam
+	Request     interface{}
+	Response    interface{}
+	RequestType string // Set for routes whose body is a file rather than JSON.
+	ContentType string // Set for routes that do not answer with the JSON envelope.
+	Created     bool   // Set for routes that answer 201 with what they created.
+}
+
+var pageQuery = []apiParam{
+	{Name: "limit", Description: "Page size; default 25, at most 100", Integer: true},
+	{Name: "after", Description: "Cursor of the next page"},
+	{Name: "before", Description: "Cursor of the previous page"},
+}
+
+// apiOperations documents every route in InitializeRoutes, keyed by method and path template.
+var apiOperations = map[string]apiOperation{
+	"POST /register":                         {Summary: "Register a new user", Request: Credentials{}, Response: ""},
+	"POST /login":                            {Summary: "Get a bearer token", Request: Credentials{}, Response: LoginToken{}},
+	"POST /subreddit/create":                 {Summary: "Create a subreddit", Request: CreateSubredditRequest{}, Response: ""},
+	"POST /subreddit/join":                   {Summary: "Join a subreddit", Request: MembershipRequest{}, Response: ""},
+	"POST /subreddit/leave":                  {Summary: "Leave a subreddit", Request: MembershipRequest{}, Response: ""},
+	"GET /subreddit/{name}/members":          {Summary: "List a subreddit's members, newest first", Query: pageQuery, Response: MemberList{}},
+	"GET /subreddit/{name}/moderators":       {Summary: "List a subreddit's owner and moderators", Response: ModeratorList{}},
+	"POST /subreddit/moderators/add":         {Summary: "Make a user a moderator (owner only)", Request: AddModeratorRequest{}, Response: Moderator{}},
+	"POST /subreddit/moderators/remove":      {Summary: "Remove a moderator (owner only)", Request: RemoveModeratorRequest{}, Response: ""},
+	"POST /subreddit/ban":                    {Summary: "Ban a user (bans permission)", Request: BanRequest{}, Response: Ban{}},
+	"POST /subreddit/unban":                  {Summary: "Lift a ban (bans permission)", Request: UnbanRequest{}, Response: ""},
+	"POST /subreddit/banner":                 {Summary: "Set or clear a subreddit's banner (owner only)", Request: SetBannerRequest{}, Response: SubredditSummary{}},
+	"POST /post/remove":                      {Summary: "Remove a post (posts permission)", Request: RemovePostRequest{}, Response: Removal{}},
+	"POST /comment/remove":                   {Summary: "Remove a comment (posts permission)", Request: RemoveCommentRequest{}, Response: Removal{}},
+	"POST /post/edit":                        {Summary: "Edit your post", Request: EditPostRequest{}, Response: History{}},
+	"POST /post/delete":                      {Summary: "Delete your post", Request: DeletePostRequest{}, Response: History{}},
+	"GET /post/{id}":                         {Summary: "Get a post with its content, link or images", Response: PostDetail{}},
+	"GET /post/{id}/revisions":               {Summary: "Get a post's edit history", Response: History{}},
+	"POST /comment/edit":                     {Summary: "Edit your comment", Request: EditCommentRequest{}, Response: History{}},
+	"POST /comment/delete":                   {Summary: "Delete your comment", Request: DeleteCommentRequest{}, Response: History{}},
+	"GET /comment/{id}/revisions":            {Summary: "Get a comment's edit history", Response: History{}},
+	"POST /post/create":                      {Summary: "Create a post", Request: CreatePostRequest{}, Response: FeedItem{}, Created: true},
+	"POST /post/crosspost":                   {Summary: "Share a post into another subreddit you have joined", Request: CrosspostRequest{}, Response: FeedItem{}, Created: true},
+	"POST /comment/create":                   {Summary: "Comment on a post or reply to a comment", Request: CreateCommentRequest{}, Response: CommentNode{}, Created: true},
+	"POST /post/upvote":                      {Summary: "Upvote a post or comment", Request: VoteRequest{}, Response: VoteResult{}},
+	"POST /post/downvote":                    {Summary: "Downvote a post or comment", Request: VoteRequest{}, Response: VoteResult{}},
+	"POST /post/clearvote":                   {Summary: "Remove a vote from a post or comment", Request: VoteRequest{}, Response: VoteResult{}},
+	"POST /message/send":                     {Summary: "Send a direct message", Request: SendMessageRequest{}, Response: DirectMessage{}},
+	"GET /messages/inbox":                    {Summary: "List received messages", Query: pageQuery, Response: MessageList{}},
+	"GET /messages/sent":                     {Summary: "List sent messages", Query: pageQuery, Response: MessageList{}},
+	"GET /messages/conversation/{otherUser}": {Summary: "List messages exchanged with one user", Query: pageQuery, Response: MessageList{}},
+	"POST /messages/read":                    {Summary: "Mark a received message as read", Request: MarkReadRequest{}, Response: DirectMessage{}},
+	"POST /notifications/read":               {Summary: "Mark one or all of your notifications read", Request: MarkNotificationsReadRequest{}, Response: NotificationsRead{}},
+	"POST /notifications/mute":               {Summary: "Stop notifications about a post and its comments", Request: MuteRequest{}, Response: MuteResult{}},
+	"POST /notifications/unmute":             {Summary: "Restart notifications about a post", Request: MuteRequest{}, Response: MuteResult{}},
+	"GET /user/{username}":                   {Summary: "Get a user's avatar and karma", Response: UserProfile{}},
+	"POST /user/avatar":                      {Summary: "Set or clear your avatar", Request: SetAvatarRequest{}, Response: UserProfile{}},
+	"GET /user/{username}/saved":             {Summary: "List your saved posts and comments, most recently saved first", Query: pageQuery, Response: SavedList{}},
+	"POST /save":                             {Summary: "Save a post or comment", Request: SaveRequest{}, Response: SaveResult{}},
+	"POST /unsave":                           {Summary: "Unsave a post or comment", Request: SaveRequest{}, Response: SaveResult{}},
+	"POST /hide":                             {Summary: "Hide a post from your feed or a comment from threads you read", Request: SaveRequest{}, Response: SaveResult{}},
+	"POST /unhide":                           {Summary: "Show a hidden post or comment again", Request: SaveRequest{}, Response: SaveResult{}},
+	"GET /user/{username}/subreddits":        {Summary: "List the subreddits a user has joined", Response: UserSubreddits{}},
+	"GET /post/{id}/comments": {Summary: "Get a post's comment tree", Response: CommentTree{}, Query: []apiParam{
+		{Name: "sort", Enum: []string{"top", "new", "controversial"}},
+		{Name: "depth", Description: "Levels of replies to include", Integer: true},
+		{Name: "limit", Description: "Comments per level", Integer: true},
+		{Name: "continuation", Description: "Token from a \"more\" placeholder"},
+	}},
+	"GET /notifications": {Summary: "List your notifications of replies, mentions and removals, newest first", Response: NotificationList{}, Query: append([]apiParam{
+		{Name: "unread", Description: "Only list unread notifications", Enum: []string{"true", "false"}},
+	}, pageQuery...)},
+	"GET /feed/{username}": {Summary: "Get your feed of posts from joined subreddits", Response: Feed{}, Query: append([]apiParam{
+		{Name: "sort", Enum: []string{"hot", "new", "top", "controversial"}},
+		{Name: "t", Description: "Time window of top and controversial", Enum: []string{"day", "week", "all"}},
+	}, pageQuery...)},
+	"GET /search": {Summary: "Search subreddits, posts and comments", Response: SearchResults{}, Query: append([]apiParam{
+		{Name: "q", Description: "Words to match, and subreddit:, author:, type: and domain: filters"},
+		{Name: "sort", Enum: []string{"relevance", "score", "new"}},
+	}, pageQuery...)},
+	"POST /media":             {Summary: "Upload an image; the body is the file", RequestType: "application/octet-stream", Response: Media{}, Created: true},
+	"GET /media/{hash}":       {Summary: "Get an uploaded image", ContentType: "application/octet-stream"},
+	"GET /media/{hash}/thumb": {Summary: "Get a thumbnail of an uploaded image", ContentType: "application/octet-stream"},
+	"GET /stream":             {Summary: "Stream the acting user's post, reply and message events", ContentType: "text/event-stream"},
+	"GET /metrics":            {Summary: "Prometheus metrics", ContentType: "text/plain"},
+	"GET /openapi.json":       {Summary: "This OpenAPI description", ContentType: "application/json"},
+}
+
+var pathParamPattern = regexp.MustCompile(`\{([^}:]+)`)
+
+// apiSpec serves the OpenAPI description of a router's routes.
+type apiSpec struct {
+	document []byte
+}
+
+// build describes the routes of router, which must all have been added. Routes
+// missing from apiOperations are logged, so that they are not forgotten.
+func (s *apiSpec) build(router *mux.Router) error {
+	schemas := schemaBuilder{components: make(map[string]interface{})}
+	paths := make(map[string]map[string]interface{})
+	err := router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+		for _, method := range methods {
+			if method == http.MethodHead {
+				continue // Described by the route's GET.
+			}
+			op, documented := apiOperations[method+" "+path]
+			if !documented {
+				warnf("Route %s %s is missing from the OpenAPI description\n", method, path)
+				continue
+			}
+			if paths[path] == nil {
+				paths[path] = make(map[string]interface{})
+			}
+			paths[path][strings.ToLower(method)] = schemas.operation(method, path, op)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	codes := make([]string, 0, len(errorCodeNames))
+	for code, name := range errorCodeNames {
+		if code != CodeOK {
+			codes = append(codes, name)
+		}
+	}
+	sort.Strings(codes)
+	schemas.components["Error"] = map[string]interface{}{
+		"type":     "object",
+		"required": []string{"status", "code", "message"},
+		"properties": map[string]interface{}{
+			"status":  map[string]interface{}{"type": "string", "enum": []string{"error"}},
+			"code":    map[string]interface{}{"type": "string", "enum": codes},
+			"message": map[string]interface{}{"type": "string"},
+		},
+	}
+
+	s.document, err = json.MarshalIndent(map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "RedditAPI",
+			"version": "1.0.0",
+			"description": "Successful responses are {\"status\": \"success\", \"data\": ...}; " +
+				"failures carry an error code whose HTTP status is fixed.",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": schemas.components,
+			"responses": map[string]interface{}{
+				"Error": map[string]interface{}{
+					"description": "The request failed",
+					"content":     jsonContent(ref("Error")),
+				},
+			},
+			"securitySchemes": map[string]interface{}{
+				"bearer": map[string]interface{}{"type": "http", "scheme": "bearer"},
+			},
+		},
+	}, "", "  ")
+	return err
+}
+
+func (s *apiSpec) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(s.document)
+}
+
+// schemaBuilder generates JSON schemas from Go types, collecting named structs as components.
+type schemaBuilder struct {
+	components map[string]interface{}
+}
+
+func (b *schemaBuilder) operation(method, path string, op apiOperation) map[string]interface{} {
+	var parameters []interface{}
+	for _, match := range pathParamPattern.FindAllStringSubmatch(path, -1) {
+		parameters = append(parameters, map[string]interface{}{
+			"name": match[1], "in": "path", "required": true, "schema": map[string]interface{}{"type": "string"},
+		})
+	}
+	for _, param := range op.Query {
+		schema := map[string]interface{}{"type": "string"}
+		if param.Integer {
+			schema["type"] = "integer"
+		}
+		if param.Enum != nil {
+			schema["enum"] = param.Enum
+		}
+		parameter := map[string]interface{}{"name": param.Name, "in": "query", "schema": schema}
+		if param.Description != "" {
+			parameter["description"] = param.Description
+		}
+		parameters = append(parameters, parameter)
+	}
+
+	status, success := "200", map[string]interface{}{"description": "Success"}
+	if op.Created {
+		status, success["description"] = "201", "Created"
+	}
+	if op.ContentType != "" {
+		success["content"] = map[string]interface{}{op.ContentType: map[string]interface{}{}}
+	} else {
+		success["content"] = jsonContent(map[string]interface{}{
+			"type":     "object",
+			"required": []string{"status", "data"},
+			"properties": map[string]interface{}{
+				"status": map[string]interface{}{"type": "string", "enum": []string{"success"}},
+				"data":   b.schema(reflect.TypeOf(op.Response)),
+			},
+		})
+	}
+	operation := map[string]interface{}{
+		"summary": op.Summary,
+		"responses": map[string]interface{}{
+			status:    success,
+			"default": map[string]interface{}{"$ref": "#/components/responses/Error"},
+		},
+	}
+	if _, limited := limitedRoutes[path]; limited {
+		operation["responses"].(map[string]interface{})["429"] = map[string]interface{}{
+			"description": "The acting user's or client IP's budget for the action is spent",
+			"headers": map[string]interface{}{
+				"Retry-After": map[string]interface{}{
+					"description": "Seconds until the request may be retried",
+					"schema":      map[string]interface{}{"type": "integer"},
+				},
+			},
+			"content": jsonContent(ref("Error")),
+		}
+	}
+	if parameters != nil {
+		operation["parameters"] = parameters
+	}
+	if op.Request != nil {
+		operation["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content":  jsonContent(b.schema(reflect.TypeOf(op.Request))),
+		}
+	}
+	if op.RequestType != "" {
+		operation["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content": map[string]interface{}{
+				op.RequestType: map[string]interface{}{"schema": map[string]interface{}{"type": "string", "format": "binary"}},
+			},
+		}
+	}
+	probe, _ := http.NewRequest(method, path, nil)
+	if requiresAuth(probe) {
+		operation["security"] = []interface{}{map[string]interface{}{"bearer": []string{}}}
+	}
+	return operation
+}
+
+func (b *schemaBuilder) schema(t reflect.Type) map[string]interface{} {
+	if t == reflect.TypeOf(time.Time{}) {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return b.schema(t.Elem())
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": b.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": b.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.object(t)
+		}
+		if _, seen := b.components[t.Name()]; !seen {
+			b.components[t.Name()] = nil // Placeholder, so that recursive types terminate.
+			b.components[t.Name()] = b.object(t)
+		}
+		return ref(t.Name())
+	}
+	return map[string]interface{}{}
+}
+
+// object describes a struct as encoding/json encodes it. Fields without
+// omitempty are required.
+func (b *schemaBuilder) object(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	required := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if !field.IsExported() || tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			// encoding/json promotes an embedded struct's fields.
+			embedded := b.object(field.Type)
+			for name, schema := range embedded["properties"].(map[string]interface{}) {
+				properties[name] = schema
+			}
+			if fields, ok := embedded["required"].([]string); ok {
+				required = append(required, fields...)
+			}
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		schema := b.schema(field.Type)
+		if enum := field.Tag.Get("enum"); enum != "" {
+			schema["enum"] = strings.Split(enum, ",")
+		}
+		properties[name] = schema
+		if !strings.Contains(options, "omitempty") {
+			required = append(required, name)
+		}
+	}
+	object := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		object["required"] = required
+	}
+	return object
+}
+
+func ref(name string) map[string]interface{} {
+	return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+}
+
+func jsonContent(schema map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{"application/json": map[string]interface{}{"schema": schema}}
+}
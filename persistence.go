@@ -0,0 +1,680 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/asynkron/protoactor-go/actor"
+)
+
+// eventRegistry maps the journal type name of each state-changing message an
+// actor handles to a constructor used to decode it on replay.
+type eventRegistry map[string]func() interface{}
+
+// eventName returns the journal type name for msg, or "" if msg is not in
+// registry. Retired names decode to retiredEvent, so messages of the same
+// name are no longer journaled.
+func (registry eventRegistry) eventName(msg interface{}) string {
+	t := reflect.TypeOf(msg)
+	if t == nil || t.Kind() != reflect.Ptr {
+		return ""
+	}
+	name := t.Elem().Name()
+	newEvent, ok := registry[name]
+	if !ok || reflect.TypeOf(newEvent()) != t {
+		return ""
+	}
+	return name
+}
+
+// retiredEvent stands in for a message that used to be journaled, so that
+// journals written before it was retired still replay. Handlers ignore it.
+type retiredEvent struct{}
+
+func retired() interface{} {
+	return &retiredEvent{}
+}
+
+// journalEntry is one line of an actor's event journal.
+type journalEntry struct {
+	Index int             `json:"index"`
+	Type  string          `json:"type"`
+	Time  time.Time       `json:"time"` // When the message was first handled, reused on replay.
+	Event json.RawMessage `json:"event"`
+}
+
+// snapshotFile is the on-disk form of an actor's latest snapshot.
+type snapshotFile struct {
+	EventIndex int             `json:"event_index"` // Index of the first event not covered by the snapshot.
+	State      json.RawMessage `json:"state"`
+}
+
+// FileProvider is a local persistence provider following protoactor-go's
+// persistence.ProviderState model: an append-only event journal and a periodic
+// snapshot per actor name, stored as JSON files under a directory. Each write
+// is synced to disk before it returns, so a change the engine has acknowledged
+// survives the machine crashing, not just the process. That costs a flush per
+// change; syncing on a timer instead could lose the last ones acknowledged.
+type FileProvider struct {
+	dir              string
+	snapshotInterval int
+	mu               sync.Mutex
+	journals         map[string]*os.File // Open journal files by actor name.
+}
+
+func NewFileProvider(dir string, snapshotInterval int) (*FileProvider, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	if snapshotInterval <= 0 {
+		snapshotInterval = 1000
+	}
+	return &FileProvider{
+		dir:              dir,
+		snapshotInterval: snapshotInterval,
+		journals:         make(map[string]*os.File),
+	}, nil
+}
+
+func (fp *FileProvider) GetSnapshotInterval() int {
+	return fp.snapshotInterval
+}
+
+// Actor names such as "engine/r_golang" are escaped so each actor gets one flat file.
+func (fp *FileProvider) journalPath(actorName string) string {
+	return filepath.Join(fp.dir, url.PathEscape(actorName)+".journal")
+}
+
+func (fp *FileProvider) snapshotPath(actorName string) string {
+	return filepath.Join(fp.dir, url.PathEscape(actorName)+".snapshot")
+}
+
+// GetSnapshot loads the latest snapshot for actorName into state.
+func (fp *FileProvider) GetSnapshot(actorName string, state interface{}) (eventIndex int, ok bool, err error) {
+	data, err := os.ReadFile(fp.snapshotPath(actorName))
+	if os.IsNotExist(err) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	var snap snapshotFile
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return 0, false, err
+	}
+	if err := json.Unmarshal(snap.State, state); err != nil {
+		return 0, false, err
+	}
+	return snap.EventIndex, true, nil
+}
+
+// PersistSnapshot atomically replaces the snapshot for actorName.
+func (fp *FileProvider) PersistSnapshot(actorName string, eventIndex int, state interface{}) error {
+	raw, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(snapshotFile{EventIndex: eventIndex, State: raw})
+	if err != nil {
+		return err
+	}
+	tmp := fp.snapshotPath(actorName) + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := out.Write(data); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, fp.snapshotPath(actorName))
+}
+
+// GetEvents calls callback for every journaled event with index >= eventIndexStart.
+func (fp *FileProvider) GetEvents(actorName string, eventIndexStart int, registry eventRegistry, callback func(entry journalEntry, event interface{})) error {
+	var decodeErr error
+	err := fp.scanJournal(actorName, func(entry journalEntry, line []byte) {
+		if decodeErr != nil || entry.Index < eventIndexStart {
+			return
+		}
+		newEvent, known := registry[entry.Type]
+		if !known {
+			decodeErr = fmt.Errorf("unknown event type %q in journal", entry.Type)
+			return
+		}
+		event := newEvent()
+		if decodeErr = json.Unmarshal(entry.Event, event); decodeErr != nil {
+			return
+		}
+		callback(entry, event)
+	})
+	if err != nil {
+		return err
+	}
+	return decodeErr
+}
+
+// PersistEvent appends event to the journal for actorName.
+func (fp *FileProvider) PersistEvent(actorName string, eventIndex int, at time.Time, eventType string, event interface{}) error {
+	raw, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	line, err := json.Marshal(journalEntry{Index: eventIndex, Type: eventType, Time: at, Event: raw})
+	if err != nil {
+		return err
+	}
+
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+	f, err := fp.journal(actorName)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// DeleteEvents drops journaled events with index <= inclusiveToIndex, once they are covered by a snapshot.
+func (fp *FileProvider) DeleteEvents(actorName string, inclusiveToIndex int) error {
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+
+	var kept [][]byte
+	err := fp.scanJournal(actorName, func(entry journalEntry, line []byte) {
+		if entry.Index > inclusiveToIndex {
+			kept = append(kept, append([]byte(nil), line...))
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	if f, open := fp.journals[actorName]; open {
+		f.Close()
+		delete(fp.journals, actorName)
+	}
+	tmp := fp.journalPath(actorName) + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(out)
+	for _, line := range kept {
+		w.Write(line)
+		w.WriteByte('\n')
+	}
+	if err := w.Flush(); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, fp.journalPath(actorName))
+}
+
+// Close flushes and closes all open journals.
+func (fp *FileProvider) Close() error {
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+	var firstErr error
+	for name, f := range fp.journals {
+		if err := f.Sync(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		if err := f.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(fp.journals, name)
+	}
+	return firstErr
+}
+
+// journal returns the open append handle for actorName. Callers hold fp.mu.
+func (fp *FileProvider) journal(actorName string) (*os.File, error) {
+	if f, ok := fp.journals[actorName]; ok {
+		return f, nil
+	}
+	f, err := os.OpenFile(fp.journalPath(actorName), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	fp.journals[actorName] = f
+	return f, nil
+}
+
+func (fp *FileProvider) scanJournal(actorName string, fn func(entry journalEntry, line []byte)) error {
+	f, err := os.Open(fp.journalPath(actorName))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var entry journalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// A torn write at the tail of the journal; everything before it is intact.
+			warnf("Skipping unreadable journal entry for %s: %v\n", actorName, err)
+			continue
+		}
+		fn(entry, scanner.Bytes())
+	}
+	return scanner.Err()
+}
+
+// replayContext is handed to handlers while recovering so that replayed
+// messages update state without responding or messaging other actors, which
+// keep journals of their own.
+type replayContext struct {
+	actor.Context
+}
+
+func (replayContext) Respond(response interface{})                {}
+func (replayContext) Send(pid *actor.PID, message interface{})    {}
+func (replayContext) Request(pid *actor.PID, message interface{}) {}
+func (replayContext) Forward(pid *actor.PID)                      {}
+func (replayContext) RequestWithCustomSender(pid *actor.PID, message interface{}, sender *actor.PID) {
+}
+
+// journaled is implemented by actors that embed Persistence.
+type journaled interface {
+	events() eventRegistry
+	handle(message interface{}, context actor.Context)
+	newSnapshot() interface{} // An empty snapshot to decode into.
+	snapshot() interface{}
+	restore(snapshot interface{}, context actor.Context)
+}
+
+// Persistence is embedded by actors whose state survives restarts. Like
+// protoactor-go's persistence.Mixin, it journals state-changing messages as
+// they arrive and, when the actor starts, restores the latest snapshot and
+// replays the events journaled after it.
+type Persistence struct {
+	provider   *FileProvider // Event journal and snapshot store; nil disables persistence.
+	eventIndex int           // Index of the next event to journal.
+	now        time.Time     // Time the current message was handled, taken from the journal on replay.
+}
+
+// receive journals and then handles the current message.
+func (p *Persistence) receive(owner journaled, context actor.Context) {
+	switch context.Message().(type) {
+	case *actor.Started:
+		p.recover(owner, context)
+	case *actor.Stopping:
+		// A final snapshot lets the next start skip replaying the journal.
+		if p.provider != nil && p.eventIndex > 0 {
+			p.saveSnapshot(owner, context)
+		}
+	}
+	p.now = time.Now()
+	journaled := p.persistEvent(owner, context, context.Message())
+	owner.handle(context.Message(), context)
+	if journaled {
+		p.maybeSnapshot(owner, context)
+	}
+}
+
+// recover rebuilds state from the latest snapshot and the events journaled after it.
+func (p *Persistence) recover(owner journaled, context actor.Context) {
+	if p.provider == nil {
+		return
+	}
+	name := context.Self().Id
+
+	snap := owner.newSnapshot()
+	eventIndex, ok, err := p.provider.GetSnapshot(name, snap)
+	if err != nil {
+		errorf("Error loading snapshot for %s: %v\n", name, err)
+	} else if ok {
+		owner.restore(snap, context)
+		p.eventIndex = eventIndex
+	}
+
+	replayed := 0
+	ctx := replayContext{context}
+	err = p.provider.GetEvents(name, p.eventIndex, owner.events(), func(entry journalEntry, event interface{}) {
+		p.now = entry.Time
+		owner.handle(event, ctx)
+		p.eventIndex = entry.Index + 1
+		replayed++
+	})
+	if err != nil {
+		errorf("Error replaying journal for %s: %v\n", name, err)
+	}
+	infof("Recovered %s (snapshot: %t, %d events replayed)\n", name, ok, replayed)
+}
+
+// persistEvent journals msg if it changes state and reports whether it did.
+func (p *Persistence) persistEvent(owner journaled, context actor.Context, msg interface{}) bool {
+	eventType := owner.events().eventName(msg)
+	if p.provider == nil || eventType == "" {
+		return false
+	}
+	name := context.Self().Id
+	if err := p.provider.PersistEvent(name, p.eventIndex, p.now, eventType, msg); err != nil {
+		errorf("Error journaling event %d for %s: %v\n", p.eventIndex, name, err)
+	}
+	p.eventIndex++
+	return true
+}
+
+// maybeSnapshot writes a snapshot once every snapshot interval and truncates the journal it covers.
+func (p *Persistence) maybeSnapshot(owner journaled, context actor.Context) {
+	if p.provider == nil || p.eventIndex == 0 || p.eventIndex%p.provider.GetSnapshotInterval() != 0 {
+		return
+	}
+	p.saveSnapshot(owner, context)
+}
+
+func (p *Persistence) saveSnapshot(owner journaled, context actor.Context) {
+	name := context.Self().Id
+	if err := p.provider.PersistSnapshot(name, p.eventIndex, owner.snapshot()); err != nil {
+		errorf("Error writing snapshot for %s: %v\n", name, err)
+		return
+	}
+	if err := p.provider.DeleteEvents(name, p.eventIndex-1); err != nil {
+		errorf("Error compacting journal for %s: %v\n", name, err)
+	}
+}
+
+// Snapshot records. Pointers between entities are stored as IDs and relinked on restore.
+
+type subredditRecord struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Owner       string    `json:"owner,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	Subscribers int       `json:"subscribers"`
+}
+
+type postRecord struct {
+	ID          string                   `json:"id"`
+	Title       string                   `json:"title"`
+	Content     string                   `json:"content"`
+	Author      string                   `json:"author"`
+	Kind        string                   `json:"kind,omitempty"`
+	URL         string                   `json:"url,omitempty"`
+	Images      []PostImage              `json:"images,omitempty"`
+	Votes       map[string]VoteDirection `json:"votes,omitempty"`
+	CreatedAt   time.Time                `json:"created_at"`
+	Removal     *Removal                 `json:"removal,omitempty"`
+	Revisions   []Revision               `json:"revisions,omitempty"`
+	EditedAt    *time.Time               `json:"edited_at,omitempty"`
+	Deleted     bool                     `json:"deleted,omitempty"`
+	CrosspostOf *CrosspostOrigin         `json:"crosspost_of,omitempty"`
+	Crossposts  []CrosspostRef           `json:"crossposts,omitempty"`
+}
+
+type commentRecord struct {
+	ID        string                   `json:"id"`
+	Content   string                   `json:"content"`
+	Author    string                   `json:"author"`
+	PostID    string                   `json:"post_id"`
+	ParentID  *string                  `json:"parent_id,omitempty"`
+	Votes     map[string]VoteDirection `json:"votes,omitempty"`
+	CreatedAt time.Time                `json:"created_at"`
+	Removal   *Removal                 `json:"removal,omitempty"`
+	Revisions []Revision               `json:"revisions,omitempty"`
+	EditedAt  *time.Time               `json:"edited_at,omitempty"`
+	Deleted   bool                     `json:"deleted,omitempty"`
+}
+
+// engineSnapshot is the state owned by the RedditEngine actor.
+type engineSnapshot struct {
+	Users           []*User           `json:"users"`
+	Subreddits      []subredditRecord `json:"subreddits"`
+	Messages        []*DirectMessage  `json:"messages"`
+	PostIndex       map[string]string `json:"post_index"`
+	CommentIndex    map[string]string `json:"comment_index"`
+	PostSeq         int               `json:"post_seq"`
+	CommentSeq      int               `json:"comment_seq"`
+	MessageSeq      int               `json:"message_seq"`
+	NotificationSeq int               `json:"notification_seq"`
+}
+
+func (re *RedditEngine) newSnapshot() interface{} {
+	return &engineSnapshot{}
+}
+
+func (re *RedditEngine) snapshot() interface{} {
+	snap := &engineSnapshot{
+		PostIndex:       re.postIndex,
+		CommentIndex:    re.commentIndex,
+		PostSeq:         re.postSeq,
+		CommentSeq:      re.commentSeq,
+		MessageSeq:      re.messageSeq,
+		NotificationSeq: re.notificationSeq,
+	}
+	for _, user := range re.users {
+		snap.Users = append(snap.Users, user)
+	}
+	for _, sub := range re.subreddits {
+		snap.Subreddits = append(snap.Subreddits, subredditRecord{
+			Name:        sub.Name,
+			Description: sub.Description,
+			Owner:       sub.Owner,
+			CreatedAt:   sub.CreatedAt,
+			Subscribers: sub.Subscribers,
+		})
+	}
+	for _, message := range re.messages {
+		snap.Messages = append(snap.Messages, message)
+	}
+	return snap
+}
+
+func (re *RedditEngine) restore(snapshot interface{}, context actor.Context) {
+	snap := snapshot.(*engineSnapshot)
+	for _, user := range snap.Users {
+		re.users[user.Username] = user
+	}
+	for _, rec := range snap.Subreddits {
+		re.spawnSubreddit(rec.Name, rec.Description, rec.Owner, rec.CreatedAt, context)
+		if subreddit, ok := re.subreddits[rec.Name]; ok {
+			subreddit.Subscribers = rec.Subscribers
+		}
+	}
+	for id, name := range snap.PostIndex {
+		re.postIndex[id] = name
+	}
+	for id, name := range snap.CommentIndex {
+		re.commentIndex[id] = name
+	}
+	re.postSeq, re.commentSeq, re.notificationSeq = snap.PostSeq, snap.CommentSeq, snap.NotificationSeq
+	re.messageSeq = snap.MessageSeq
+	if re.messageSeq == 0 { // Snapshots older than the field numbered messages by count.
+		re.messageSeq = len(snap.Messages)
+	}
+	sort.Slice(snap.Messages, func(i, j int) bool {
+		return snap.Messages[i].sortKey().before(snap.Messages[j].sortKey())
+	})
+	for i := len(snap.Messages) - 1; i >= 0; i-- { // Oldest first
+		message := snap.Messages[i]
+		from, fromExists := re.users[message.From]
+		to, toExists := re.users[message.To]
+		if !fromExists || !toExists {
+			warnf("Skipping message %s from %s to %s: no such user\n", message.ID, message.From, message.To)
+			continue
+		}
+		re.messages[message.ID] = message
+		from.Sent = append(from.Sent, message)
+		to.Inbox = append(to.Inbox, message)
+	}
+}
+
+// subredditSnapshot is the state owned by one SubredditActor.
+type subredditSnapshot struct {
+	Members    map[string]time.Time  `json:"members"`
+	Moderators map[string]*Moderator `json:"moderators,omitempty"`
+	Bans       map[string]*Ban       `json:"bans,omitempty"`
+	Banner     string                `json:"banner,omitempty"`
+	Posts      []postRecord          `json:"posts"`
+	Comments   []commentRecord       `json:"comments"`
+}
+
+func (sa *SubredditActor) newSnapshot() interface{} {
+	return &subredditSnapshot{}
+}
+
+func (sa *SubredditActor) snapshot() interface{} {
+	snap := &subredditSnapshot{
+		Members:    sa.subreddit.Members,
+		Moderators: sa.subreddit.Moderators,
+		Bans:       sa.subreddit.Bans,
+		Banner:     sa.subreddit.Banner,
+	}
+	for _, post := range sa.posts {
+		snap.Posts = append(snap.Posts, postRecord{
+			ID:          post.ID,
+			Title:       post.Title,
+			Content:     post.Content,
+			Author:      post.Author,
+			Kind:        post.Kind,
+			URL:         post.URL,
+			Images:      post.Images,
+			Votes:       post.Ledger,
+			CreatedAt:   post.CreatedAt,
+			Removal:     post.Removal,
+			Revisions:   post.Revisions,
+			EditedAt:    post.EditedAt,
+			Deleted:     post.Deleted,
+			CrosspostOf: post.CrosspostOf,
+			Crossposts:  post.Crossposts,
+		})
+	}
+	for _, comment := range sa.comments {
+		snap.Comments = append(snap.Comments, commentRecord{
+			ID:        comment.ID,
+			Content:   comment.Content,
+			Author:    comment.Author,
+			PostID:    comment.Post.ID,
+			ParentID:  comment.ParentID,
+			Votes:     comment.Ledger,
+			CreatedAt: comment.CreatedAt,
+			Removal:   comment.Removal,
+			Revisions: comment.Revisions,
+			EditedAt:  comment.EditedAt,
+			Deleted:   comment.Deleted,
+		})
+	}
+	return snap
+}
+
+func (sa *SubredditActor) restore(snapshot interface{}, context actor.Context) {
+	snap := snapshot.(*subredditSnapshot)
+	for username, joinedAt := range snap.Members {
+		sa.subreddit.Members[username] = joinedAt
+	}
+	sa.subreddit.Subscribers = len(sa.subreddit.Members)
+	for username, moderator := range snap.Moderators {
+		sa.subreddit.Moderators[username] = moderator
+	}
+	for username, ban := range snap.Bans {
+		sa.subreddit.Bans[username] = ban
+	}
+	sa.subreddit.Banner = snap.Banner
+	// Relink in creation order so reply and post lists keep that order.
+	sort.Slice(snap.Posts, func(i, j int) bool {
+		return snap.Posts[j].CreatedAt.After(snap.Posts[i].CreatedAt)
+	})
+	sort.Slice(snap.Comments, func(i, j int) bool {
+		return snap.Comments[j].CreatedAt.After(snap.Comments[i].CreatedAt)
+	})
+	for _, rec := range snap.Posts {
+		post := &Post{
+			ID:          rec.ID,
+			Title:       rec.Title,
+			Content:     rec.Content,
+			Author:      rec.Author,
+			Subreddit:   sa.subreddit,
+			Kind:        rec.Kind,
+			URL:         rec.URL,
+			Images:      rec.Images,
+			Votes:       restoreVotes(rec.Votes),
+			CreatedAt:   rec.CreatedAt,
+			Removal:     rec.Removal,
+			Edits:       Edits{Revisions: rec.Revisions, EditedAt: rec.EditedAt, Deleted: rec.Deleted},
+			CrosspostOf: rec.CrosspostOf,
+			Crossposts:  rec.Crossposts,
+		}
+		if post.Kind == "" { // Snapshotted before posts had kinds.
+			post.Kind = KindText
+		}
+		post.Domain, _ = linkDomain(post.URL)
+		sa.posts[rec.ID] = post
+		sa.subreddit.Posts = append(sa.subreddit.Posts, post)
+	}
+	for _, rec := range snap.Comments {
+		post, exists := sa.posts[rec.PostID]
+		if !exists {
+			warnf("Skipping comment %s in %s: no such post %s\n", rec.ID, sa.subreddit.Name, rec.PostID)
+			continue
+		}
+		sa.comments[rec.ID] = &Comment{
+			ID:        rec.ID,
+			Content:   rec.Content,
+			Author:    rec.Author,
+			Post:      post,
+			ParentID:  rec.ParentID,
+			Votes:     restoreVotes(rec.Votes),
+			CreatedAt: rec.CreatedAt,
+			Removal:   rec.Removal,
+			Edits:     Edits{Revisions: rec.Revisions, EditedAt: rec.EditedAt, Deleted: rec.Deleted},
+		}
+	}
+	// A reply comes after its parent, so the replies under a skipped comment are skipped too.
+	for _, rec := range snap.Comments {
+		comment, exists := sa.comments[rec.ID]
+		if !exists {
+			continue
+		}
+		if comment.ParentID != nil {
+			parent, exists := sa.comments[*comment.ParentID]
+			if !exists {
+				warnf("Skipping comment %s in %s: no such parent comment %s\n", rec.ID, sa.subreddit.Name, *comment.ParentID)
+				delete(sa.comments, rec.ID)
+				continue
+			}
+			parent.Replies = append(parent.Replies, comment)
+		} else {
+			comment.Post.Comments = append(comment.Post.Comments, comment)
+		}
+		comment.Post.CommentCount++
+	}
+}
+
+// restoreVotes rebuilds the vote counters from a ledger. Karma is restored with the users.
+func restoreVotes(ledger map[string]VoteDirection) Votes {
+	votes := Votes{}
+	for username, vote := range ledger {
+		votes.cast(username, vote)
+	}
+	return votes
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/asynkron/protoactor-go/actor"
+)
+
+// testEngine is an engine actor journaling into a test's directory.
+type testEngine struct {
+	t        *testing.T
+	system   *actor.ActorSystem
+	provider *FileProvider
+}
+
+func startTestEngine(t *testing.T, dir string) *testEngine {
+	t.Helper()
+	provider, err := NewFileProvider(dir, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	system := actor.NewActorSystem()
+	engineActor, err = system.Root.SpawnNamed(actor.PropsFromProducer(func() actor.Actor {
+		return NewRedditEngine(provider, time.Second)
+	}), "engine")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testEngine{t: t, system: system, provider: provider}
+}
+
+// request sends msg to the engine and fails the test if it is not handled successfully.
+func (e *testEngine) request(msg interface{}) *Result {
+	e.t.Helper()
+	result := engineResult(e.system.Root.RequestFuture(engineActor, msg, time.Second))
+	if !result.OK() {
+		e.t.Fatalf("%T: %s: %s", msg, result.Code, result.Message)
+	}
+	return result
+}
+
+// refuse sends msg to the engine and fails the test unless it is refused with code.
+func (e *testEngine) refuse(msg interface{}, code ErrorCode) {
+	e.t.Helper()
+	result := engineResult(e.system.Root.RequestFuture(engineActor, msg, time.Second))
+	if result.Code != code {
+		e.t.Fatalf("%T: %s: %s, want %s", msg, result.Code, result.Message, code)
+	}
+}
+
+// crash stops the engine without letting it snapshot, so a restart replays the journals.
+func (e *testEngine) crash() {
+	e.provider.Close()
+	e.system.Shutdown()
+}
+
+// eventually fails the test unless check holds within a second. Subreddits
+// report to the engine as they start, a moment after it does.
+func (e *testEngine) eventually(what string, check func() bool) {
+	e.t.Helper()
+	for deadline := time.Now().Add(time.Second); !check(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			e.t.Fatalf("%s: not true within a second", what)
+		}
+	}
+}
+
+// startCommunity starts an engine for one test, stopped when the test ends,
+// with users alice, bob and carol and r/golang, which alice owns and all three
+// have joined.
+func startCommunity(t *testing.T) *testEngine {
+	t.Helper()
+	e := startTestEngine(t, t.TempDir())
+	t.Cleanup(func() { stopEngine(e.system, e.provider) })
+	for _, username := range []string{"alice", "bob", "carol"} {
+		e.request(&RegisterUser{Username: username, PasswordHash: "hash"})
+	}
+	e.request(&CreateSubreddit{Name: "golang", Description: "Go", Creator: "alice"})
+	for _, username := range []string{"alice", "bob", "carol"} {
+		e.request(&JoinSubreddit{Username: username, Subreddit: "golang"})
+	}
+	return e
+}
+
+// dropJournalEntries rewrites an actor's journal without the entries of the given event types.
+func dropJournalEntries(t *testing.T, dir, actorName string, eventTypes ...string) {
+	t.Helper()
+	path := filepath.Join(dir, actorName+".journal")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var kept []string
+	scanner := bufio.NewScanner(strings.NewReader(string(data)))
+	for scanner.Scan() {
+		line, drop := scanner.Text(), false
+		for _, eventType := range eventTypes {
+			drop = drop || strings.Contains(line, `"type":"`+eventType+`"`)
+		}
+		if !drop {
+			kept = append(kept, line)
+		}
+	}
+	if len(kept) == strings.Count(string(data), "\n") {
+		t.Fatalf("no %v entries in %s", eventTypes, path)
+	}
+	if err := os.WriteFile(path, []byte(strings.Join(kept, "\n")+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRestartRestoresState(t *testing.T) {
+	tests := []struct {
+		name string
+		stop func(e *testEngine, dir string)
+	}{
+		{name: "from snapshots after a clean stop", stop: func(e *testEngine, dir string) {
+			stopEngine(e.system, e.provider)
+		}},
+		{name: "from journals after a crash", stop: func(e *testEngine, dir string) {
+			e.crash()
+		}},
+		{name: "with the engine's routes to posts and comments lost", stop: func(e *testEngine, dir string) {
+			e.crash()
+			dropJournalEntries(t, dir, "engine", "postCreated", "commentCreated")
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			e := startTestEngine(t, dir)
+			e.request(&RegisterUser{Username: "alice", PasswordHash: "hash"})
+			e.request(&RegisterUser{Username: "bob", PasswordHash: "hash"})
+			e.request(&CreateSubreddit{Name: "golang", Description: "Go", Creator: "alice"})
+			e.request(&JoinSubreddit{Username: "alice", Subreddit: "golang"})
+			e.request(&JoinSubreddit{Username: "bob", Subreddit: "golang"})
+			post := e.request(&CreatePost{Title: "Hello", Content: "World", Author: "alice", Subreddit: "golang"}).Data.(*FeedItem)
+			comment := e.request(&CreateComment{Content: "Hi", Author: "bob", PostID: post.ID}).Data.(*CommentNode)
+			e.request(&Upvote{UserID: "bob", MediaType: "Post", TargetID: post.ID})
+			e.request(&Downvote{UserID: "alice", MediaType: "Comment", TargetID: comment.ID})
+			e.request(&SendDirectMessage{From: "alice", To: "bob", Content: "First"})
+			tt.stop(e, dir)
+
+			e = startTestEngine(t, dir)
+			defer stopEngine(e.system, e.provider)
+			e.eventually("karma rebuilt", func() bool {
+				alice := e.request(&GetUserProfile{Username: "alice"}).Data.(*UserProfile)
+				bob := e.request(&GetUserProfile{Username: "bob"}).Data.(*UserProfile)
+				return alice.PostKarma == 1 && alice.CommentKarma == 0 && bob.PostKarma == 0 && bob.CommentKarma == -1
+			})
+
+			detail := e.request(&GetPost{PostID: post.ID}).Data.(*PostDetail)
+			if detail.Title != "Hello" || detail.Score != 1 || detail.CommentCount != 1 {
+				t.Errorf("post = %q with score %d and %d comments, want Hello with score 1 and 1 comment", detail.Title, detail.Score, detail.CommentCount)
+			}
+
+			// The restored vote ledger keeps votes idempotent, and the comment is still routed to.
+			e.request(&Upvote{UserID: "bob", MediaType: "Post", TargetID: post.ID})
+			e.request(&Upvote{UserID: "alice", MediaType: "Comment", TargetID: comment.ID})
+			e.request(&CreateComment{Content: "Reply", Author: "alice", PostID: post.ID, ParentID: comment.ID})
+			alice := e.request(&GetUserProfile{Username: "alice"}).Data.(*UserProfile)
+			bob := e.request(&GetUserProfile{Username: "bob"}).Data.(*UserProfile)
+			if alice.PostKarma != 1 || bob.CommentKarma != 1 {
+				t.Errorf("after voting again: alice post karma %d, bob comment karma %d, want 1 and 1", alice.PostKarma, bob.CommentKarma)
+			}
+
+			// Numbering carries on from before the restart.
+			next := e.request(&CreatePost{Title: "Again", Content: "More", Author: "alice", Subreddit: "golang"}).Data.(*FeedItem)
+			if next.ID == post.ID {
+				t.Errorf("new post reused ID %s", post.ID)
+			}
+			message := e.request(&SendDirectMessage{From: "alice", To: "bob", Content: "Second"}).Data.(DirectMessage)
+			if message.ID != "alice_message_2" {
+				t.Errorf("second message ID = %s, want alice_message_2", message.ID)
+			}
+		})
+	}
+}
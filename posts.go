@@ -0,0 +1,166 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/asynkron/protoactor-go/actor"
+)
+
+// Post kinds.
+const (
+	KindText    = "text"
+	KindLink    = "link"
+	KindImage   = "image"
+	KindGallery = "gallery"
+)
+
+const (
+	maxGalleryImages = 20
+	maxCaptionLength = 180
+	maxURLLength     = 2048
+)
+
+// PostImage is an uploaded image in an image or gallery post, referenced by
+// the hash the media store filed it under.
+type PostImage struct {
+	Hash    string `json:"hash"`
+	Caption string `json:"caption,omitempty"`
+}
+
+type GetPost struct {
+	PostID string
+}
+
+// LinkView is the target of a link post as responses show it.
+type LinkView struct {
+	URL    string `json:"url"`
+	Domain string `json:"domain"`
+}
+
+// ImageView is an image as responses show it.
+type ImageView struct {
+	Hash         string `json:"hash"`
+	URL          string `json:"url"`
+	ThumbnailURL string `json:"thumbnail_url"`
+	Caption      string `json:"caption,omitempty"`
+}
+
+// GalleryView is a gallery as responses show it. Feeds carry only the first
+// image as a cover; the post itself carries all of them in order.
+type GalleryView struct {
+	Count  int         `json:"count"`
+	Images []ImageView `json:"images"`
+}
+
+// PostDetail is a subreddit actor's reply to GetPost.
+type PostDetail struct {
+	FeedItem
+	Content    string         `json:"content"`
+	Removed    bool           `json:"removed,omitempty"` // Removed by a moderator; the content is withheld.
+	Deleted    bool           `json:"deleted,omitempty"`
+	Crossposts []CrosspostRef `json:"crossposts,omitempty"`
+}
+
+// validatePostKind checks that a new post carries what its kind needs, filling
+// in the text kind when none is given.
+func validatePostKind(msg *CreatePost) *Result {
+	if msg.Kind == "" {
+		msg.Kind = KindText
+	}
+	if msg.Kind != KindLink && msg.URL != "" {
+		return failure(CodeInvalidRequest, "Only link posts have a url")
+	}
+	if msg.Kind != KindImage && msg.Kind != KindGallery && len(msg.Images) > 0 {
+		return failure(CodeInvalidRequest, "Only image and gallery posts have images")
+	}
+	switch msg.Kind {
+	case KindText:
+	case KindLink:
+		if _, err := linkDomain(msg.URL); err != nil {
+			return failure(CodeInvalidRequest, "%s", err.Error())
+		}
+	case KindImage:
+		if len(msg.Images) != 1 {
+			return failure(CodeInvalidRequest, "An image post has exactly one image")
+		}
+	case KindGallery:
+		if len(msg.Images) < 2 || len(msg.Images) > maxGalleryImages {
+			return failure(CodeInvalidRequest, "A gallery has between 2 and %d images", maxGalleryImages)
+		}
+	default:
+		return failure(CodeInvalidRequest, "kind must be text, link, image or gallery")
+	}
+	for _, image := range msg.Images {
+		if image.Hash == "" {
+			return failure(CodeInvalidRequest, "Every image needs the hash of an upload")
+		}
+		if len(image.Caption) > maxCaptionLength {
+			return failure(CodeInvalidRequest, "Captions are limited to %d characters", maxCaptionLength)
+		}
+	}
+	return nil
+}
+
+// linkDomain checks that rawURL is an absolute http or https URL and returns
+// its host name in lower case, without a leading "www.".
+func linkDomain(rawURL string) (string, error) {
+	if len(rawURL) > maxURLLength {
+		return "", fmt.Errorf("url is limited to %d characters", maxURLLength)
+	}
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Hostname() == "" {
+		return "", errors.New("url must be an absolute http or https URL")
+	}
+	return strings.TrimPrefix(strings.ToLower(parsed.Hostname()), "www."), nil
+}
+
+func imageView(image PostImage) ImageView {
+	return ImageView{Hash: image.Hash, URL: mediaURL(image.Hash), ThumbnailURL: thumbnailURL(image.Hash), Caption: image.Caption}
+}
+
+// renderKind fills in the kind-specific fields of item from post. A gallery is
+// cut down to its cover unless full is set.
+func renderKind(item *FeedItem, post *Post, full bool) {
+	item.Kind = post.Kind
+	switch post.Kind {
+	case KindLink:
+		item.Link = &LinkView{URL: post.URL, Domain: post.Domain}
+	case KindImage:
+		if len(post.Images) > 0 {
+			view := imageView(post.Images[0])
+			item.Image = &view
+		}
+	case KindGallery:
+		images := post.Images
+		if !full && len(images) > 1 {
+			images = images[:1]
+		}
+		gallery := &GalleryView{Count: len(post.Images)}
+		for _, image := range images {
+			gallery.Images = append(gallery.Images, imageView(image))
+		}
+		item.Gallery = gallery
+	}
+}
+
+// postDetail renders a post with its content and every gallery image. The
+// content and media of removed and deleted posts are withheld.
+func postDetail(post *Post) *PostDetail {
+	detail := &PostDetail{FeedItem: feedItem(post), Content: post.Content, Removed: post.Removal != nil, Deleted: post.Deleted, Crossposts: post.Crossposts}
+	if detail.Removed || detail.Deleted {
+		detail.Content = ""
+		detail.Link, detail.Image, detail.Gallery = nil, nil, nil
+		return detail
+	}
+	renderKind(&detail.FeedItem, post, true)
+	return detail
+}
+
+func (sa *SubredditActor) getPost(msg *GetPost, context actor.Context) {
+	if post, exists := sa.post(msg.PostID, context); exists {
+		context.Respond(success(postDetail(post)))
+	}
+}
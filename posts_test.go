@@ -0,0 +1,105 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLinkDomain(t *testing.T) {
+	tests := []struct {
+		url     string
+		want    string
+		wantErr bool
+	}{
+		{url: "https://go.dev/blog", want: "go.dev"},
+		{url: "http://www.Example.COM/a?b=c", want: "example.com"},
+		{url: "https://sub.www.example.com", want: "sub.www.example.com"},
+		{url: "https://example.com:8443/path", want: "example.com"},
+		{url: "ftp://example.com/file", wantErr: true},
+		{url: "example.com", wantErr: true},
+		{url: "/relative/path", wantErr: true},
+		{url: "https://", wantErr: true},
+		{url: "https://example.com/" + strings.Repeat("a", maxURLLength), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url[:min(len(tt.url), 40)], func(t *testing.T) {
+			got, err := linkDomain(tt.url)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("linkDomain(%q) error = %v, want error %t", tt.url, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("linkDomain(%q) = %q, want %q", tt.url, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidatePostKind(t *testing.T) {
+	images := func(n int) []PostImage {
+		list := make([]PostImage, n)
+		for i := range list {
+			list[i] = PostImage{Hash: "hash"}
+		}
+		return list
+	}
+	tests := []struct {
+		name    string
+		msg     CreatePost
+		wantErr bool
+	}{
+		{name: "text by default", msg: CreatePost{}},
+		{name: "link", msg: CreatePost{Kind: KindLink, URL: "https://go.dev"}},
+		{name: "link without a url", msg: CreatePost{Kind: KindLink}, wantErr: true},
+		{name: "link to a relative url", msg: CreatePost{Kind: KindLink, URL: "/r/golang"}, wantErr: true},
+		{name: "text with a url", msg: CreatePost{URL: "https://go.dev"}, wantErr: true},
+		{name: "image", msg: CreatePost{Kind: KindImage, Images: images(1)}},
+		{name: "image with two images", msg: CreatePost{Kind: KindImage, Images: images(2)}, wantErr: true},
+		{name: "gallery", msg: CreatePost{Kind: KindGallery, Images: images(maxGalleryImages)}},
+		{name: "gallery of one", msg: CreatePost{Kind: KindGallery, Images: images(1)}, wantErr: true},
+		{name: "gallery too large", msg: CreatePost{Kind: KindGallery, Images: images(maxGalleryImages + 1)}, wantErr: true},
+		{name: "text with images", msg: CreatePost{Images: images(1)}, wantErr: true},
+		{name: "image without a hash", msg: CreatePost{Kind: KindImage, Images: []PostImage{{}}}, wantErr: true},
+		{name: "caption too long", msg: CreatePost{Kind: KindImage, Images: []PostImage{{Hash: "hash", Caption: strings.Repeat("a", maxCaptionLength+1)}}}, wantErr: true},
+		{name: "unknown kind", msg: CreatePost{Kind: "poll"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rejected := validatePostKind(&tt.msg)
+			if (rejected != nil) != tt.wantErr {
+				t.Fatalf("validatePostKind() = %+v, want rejected %t", rejected, tt.wantErr)
+			}
+			if rejected != nil && rejected.Code != CodeInvalidRequest {
+				t.Errorf("rejected with %s, want %s", rejected.Code, CodeInvalidRequest)
+			}
+			if !tt.wantErr && tt.msg.Kind == "" {
+				t.Error("kind left empty")
+			}
+		})
+	}
+}
+
+func TestPostKinds(t *testing.T) {
+	e := startCommunity(t)
+	link := e.request(&CreatePost{Title: "Go 1.23", Author: "alice", Subreddit: "golang", Kind: KindLink, URL: "https://www.Go.dev/blog/go1.23"}).Data.(*FeedItem)
+	if link.Kind != KindLink || link.Link == nil || link.Link.Domain != "go.dev" {
+		t.Errorf("link post = %s with %+v, want a link to go.dev", link.Kind, link.Link)
+	}
+	image := e.request(&CreatePost{Title: "Gopher", Author: "alice", Subreddit: "golang", Kind: KindImage, Images: []PostImage{{Hash: "one", Caption: "Hi"}}}).Data.(*FeedItem)
+	if image.Image == nil || image.Image.URL != mediaURL("one") || image.Image.Caption != "Hi" {
+		t.Errorf("image post shows %+v, want image one captioned Hi", image.Image)
+	}
+	gallery := e.request(&CreatePost{Title: "Gophers", Author: "alice", Subreddit: "golang", Kind: KindGallery, Images: []PostImage{{Hash: "one"}, {Hash: "two"}, {Hash: "three"}}}).Data.(*FeedItem)
+	if gallery.Gallery == nil || gallery.Gallery.Count != 3 || len(gallery.Gallery.Images) != 1 || gallery.Gallery.Images[0].Hash != "one" {
+		t.Errorf("gallery in a listing = %+v, want the first of 3 images as its cover", gallery.Gallery)
+	}
+	detail := e.request(&GetPost{PostID: gallery.ID}).Data.(*PostDetail)
+	if detail.Gallery == nil || len(detail.Gallery.Images) != 3 || detail.Gallery.Images[2].Hash != "three" {
+		t.Errorf("gallery post = %+v, want all 3 images in order", detail.Gallery)
+	}
+	e.refuse(&CreatePost{Title: "Broken", Author: "alice", Subreddit: "golang", Kind: KindLink, URL: "go.dev"}, CodeInvalidRequest)
+
+	results := e.request(&Search{Query: "domain:go.dev"}).Data.(*SearchResults)
+	if len(results.Hits) != 1 || results.Hits[0].ID != link.ID {
+		t.Errorf("domain:go.dev found %+v, want only %s", results.Hits, link.ID)
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"fmt"
+	"hash/maphash"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Rate-limited actions, each with its own budget.
+const (
+	ActionPost    = "post"
+	ActionComment = "comment"
+	ActionVote    = "vote"
+	ActionMessage = "message"
+)
+
+// limitedRoutes maps the routes that spend a budget to their action.
+var limitedRoutes = map[string]string{
+	"/post/create":    ActionPost,
+	"/post/crosspost": ActionPost,
+	"/comment/create": ActionComment,
+	"/post/upvote":    ActionVote,
+	"/post/downvote":  ActionVote,
+	"/post/clearvote": ActionVote,
+	"/message/send":   ActionMessage,
+}
+
+var rateLimited = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "reddit_rate_limited_total",
+	Help: "Requests rejected by rate limits, by action and by whether the user or IP budget ran out.",
+}, []string{"action", "scope"})
+
+// Limit is a token bucket: up to Burst requests at once, refilled at Burst per
+// Period. A zero Limit allows everything.
+type Limit struct {
+	Burst  int
+	Period time.Duration
+}
+
+// ParseLimit reads a limit written as "burst/period", such as "10/1m", or "off".
+func ParseLimit(text string) (Limit, error) {
+	if text == "off" || text == "0" {
+		return Limit{}, nil
+	}
+	burst, period, found := strings.Cut(text, "/")
+	n, err := strconv.Atoi(burst)
+	if !found || err != nil || n <= 0 {
+		return Limit{}, fmt.Errorf("limit %q must be a count and a period, such as 10/1m, or off", text)
+	}
+	d, err := time.ParseDuration(period)
+	if err != nil || d <= 0 {
+		return Limit{}, fmt.Errorf("limit %q must be a count and a period, such as 10/1m, or off", text)
+	}
+	return Limit{Burst: n, Period: d}, nil
+}
+
+func (l Limit) String() string {
+	if l.Burst == 0 {
+		return "off"
+	}
+	return fmt.Sprintf("%d/%s", l.Burst, l.Period)
+}
+
+// Set parses text with ParseLimit, making *Limit a flag.Value.
+func (l *Limit) Set(text string) error {
+	limit, err := ParseLimit(text)
+	if err == nil {
+		*l = limit
+	}
+	return err
+}
+
+// scaled returns l with its burst multiplied by factor, keeping at least one request.
+func (l Limit) scaled(factor float64) Limit {
+	if l.Burst == 0 {
+		return l
+	}
+	return Limit{Burst: max(1, int(float64(l.Burst)*factor)), Period: l.Period}
+}
+
+// RateLimits are the budgets of each action.
+type RateLimits struct {
+	Actions         map[string]*Limit // Per-user budget of each action.
+	IPFactor        float64           // Multiplies the user budgets for each client IP, which several users may share.
+	NewAccountAge   time.Duration     // Accounts younger than this are new.
+	NewAccountShare float64           // Multiplies the user budgets of new accounts.
+	TrustProxy      bool              // Take the client IP from X-Forwarded-For.
+}
+
+// bucket is a token bucket's state at a point in time.
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// refill brings the bucket up to now and reports whether it is full.
+func (b *bucket) refill(limit Limit, now time.Time) bool {
+	rate := float64(limit.Burst) / limit.Period.Seconds()
+	b.tokens = math.Min(float64(limit.Burst), b.tokens+now.Sub(b.updated).Seconds()*rate)
+	b.updated = now
+	return b.tokens >= float64(limit.Burst)
+}
+
+const limiterShards = 64
+
+// limiterSweep is how often a shard drops buckets that have refilled, which
+// would behave the same as new ones.
+const limiterSweep = time.Minute
+
+type limiterShard struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	limits  map[string]Limit // The limit each bucket was last used with, for sweeping.
+	swept   time.Time
+}
+
+// RateLimiter holds the token buckets of every user and client IP. Buckets
+// are sharded by key under their own locks, so limiting neither goes through
+// the engine actor nor makes requests wait on one lock.
+type RateLimiter struct {
+	limits RateLimits
+	seed   maphash.Seed
+	shards [limiterShards]limiterShard
+}
+
+func NewRateLimiter(limits RateLimits) *RateLimiter {
+	rl := &RateLimiter{limits: limits, seed: maphash.MakeSeed()}
+	for i := range rl.shards {
+		rl.shards[i].buckets = make(map[string]*bucket)
+		rl.shards[i].limits = make(map[string]Limit)
+	}
+	return rl
+}
+
+func (rl *RateLimiter) shard(key string) *limiterShard {
+	return &rl.shards[maphash.String(rl.seed, key)%limiterShards]
+}
+
+// take spends a token from the bucket named key. If none is left it returns
+// how long until one will be.
+func (rl *RateLimiter) take(key string, limit Limit, now time.Time) (time.Duration, bool) {
+	shard := rl.shard(key)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	if now.Sub(shard.swept) >= limiterSweep {
+		for k, b := range shard.buckets {
+			if b.refill(shard.limits[k], now) {
+				delete(shard.buckets, k)
+				delete(shard.limits, k)
+			}
+		}
+		shard.swept = now
+	}
+
+	b, exists := shard.buckets[key]
+	if !exists {
+		b = &bucket{tokens: float64(limit.Burst), updated: now}
+		shard.buckets[key] = b
+	}
+	shard.limits[key] = limit
+	b.refill(limit, now)
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) * float64(limit.Period) / float64(limit.Burst))
+		return wait, false
+	}
+	b.tokens--
+	return 0, true
+}
+
+// refund returns a token taken from the bucket named key.
+func (rl *RateLimiter) refund(key string, limit Limit) {
+	shard := rl.shard(key)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	if b, exists := shard.buckets[key]; exists {
+		b.tokens = math.Min(float64(limit.Burst), b.tokens+1)
+	}
+}
+
+// Allow spends one of username's and ip's tokens for action. When either
+// budget is spent nothing is taken, and it returns how long to wait and which
+// budget, "user" or "ip", ran out.
+func (rl *RateLimiter) Allow(action, username, ip string, registered time.Time) (time.Duration, string, bool) {
+	limit, limited := rl.limits.Actions[action]
+	if !limited || limit.Burst == 0 {
+		return 0, "", true
+	}
+	now := time.Now()
+	userLimit := *limit
+	if !registered.IsZero() && now.Sub(registered) < rl.limits.NewAccountAge {
+		userLimit = userLimit.scaled(rl.limits.NewAccountShare)
+	}
+	ipLimit := limit.scaled(rl.limits.IPFactor)
+
+	userKey := action + "/user/" + username
+	if wait, ok := rl.take(userKey, userLimit, now); !ok {
+		return wait, "user", false
+	}
+	if wait, ok := rl.take(action+"/ip/"+ip, ipLimit, now); !ok {
+		rl.refund(userKey, userLimit)
+		return wait, "ip", false
+	}
+	return 0, "", true
+}
+
+// clientIP returns the address a request came from.
+func (rl *RateLimiter) clientIP(r *http.Request) string {
+	if rl.limits.TrustProxy {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			first, _, _ := strings.Cut(forwarded, ",")
+			return strings.TrimSpace(first)
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// RateLimitMiddleware rejects posts, comments, votes and messages beyond the
+// acting user's or client IP's budget with 429 Too Many Requests and a
+// Retry-After header. It runs after AuthMiddleware, which sets the acting user.
+func RateLimitMiddleware(rl *RateLimiter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			action, limited := limitedRoutes[r.URL.Path]
+			if !limited || r.Method != http.MethodPost {
+				next.ServeHTTP(w, r)
+				return
+			}
+			username := actingUser(r)
+			wait, scope, ok := rl.Allow(action, username, rl.clientIP(r), registeredAt(r))
+			if !ok {
+				rateLimited.WithLabelValues(action, scope).Inc()
+				debugf("Rate limited %s by %s (%s budget)\n", action, username, scope)
+				retry := max(1, int(math.Ceil(wait.Seconds())))
+				w.Header().Set("Retry-After", strconv.Itoa(retry))
+				JSONError(w, CodeRateLimited, fmt.Sprintf("Too many %s requests; retry in %d seconds", action, retry))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
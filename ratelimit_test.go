@@ -0,0 +1,120 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		text    string
+		want    Limit
+		wantErr bool
+	}{
+		{text: "10/1m", want: Limit{Burst: 10, Period: time.Minute}},
+		{text: "5/30s", want: Limit{Burst: 5, Period: 30 * time.Second}},
+		{text: "off", want: Limit{}},
+		{text: "0", want: Limit{}},
+		{text: "10", wantErr: true},
+		{text: "-1/1m", wantErr: true},
+		{text: "10/0s", wantErr: true},
+		{text: "ten/1m", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			got, err := ParseLimit(tt.text)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseLimit(%q) error = %v, want error %t", tt.text, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseLimit(%q) = %+v, want %+v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTakeRefills(t *testing.T) {
+	limit := Limit{Burst: 2, Period: time.Minute} // One token every 30 seconds.
+	start := time.Unix(1700000000, 0)
+	steps := []struct {
+		after    time.Duration
+		wantOK   bool
+		wantWait time.Duration
+	}{
+		{after: 0, wantOK: true},
+		{after: 0, wantOK: true},
+		{after: 0, wantWait: 30 * time.Second},
+		{after: 10 * time.Second, wantWait: 20 * time.Second},
+		{after: 30 * time.Second, wantOK: true},
+		{after: 30 * time.Second, wantWait: 30 * time.Second},
+		{after: 10 * time.Minute, wantOK: true}, // Refills to the burst, no further.
+		{after: 10 * time.Minute, wantOK: true},
+		{after: 10 * time.Minute, wantWait: 30 * time.Second},
+	}
+	rl := NewRateLimiter(RateLimits{})
+	for i, step := range steps {
+		wait, ok := rl.take("post/user/alice", limit, start.Add(step.after))
+		if ok != step.wantOK || wait.Round(time.Millisecond) != step.wantWait {
+			t.Errorf("step %d at +%s: take() = %s, %t, want %s, %t", i, step.after, wait, ok, step.wantWait, step.wantOK)
+		}
+	}
+}
+
+func TestAllow(t *testing.T) {
+	limits := RateLimits{
+		Actions: map[string]*Limit{
+			ActionPost: {Burst: 4, Period: time.Hour},
+			ActionVote: {},
+		},
+		IPFactor:        1.5,
+		NewAccountAge:   24 * time.Hour,
+		NewAccountShare: 0.5,
+	}
+	allowed := func(rl *RateLimiter, action, username, ip string, registered time.Time, n int) (int, string) {
+		for i := 0; i < n; i++ {
+			if _, scope, ok := rl.Allow(action, username, ip, registered); !ok {
+				return i, scope
+			}
+		}
+		return n, ""
+	}
+	old, recent := time.Now().Add(-48*time.Hour), time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		name       string
+		action     string
+		registered time.Time
+		wantCount  int
+		wantScope  string
+	}{
+		{name: "established account", action: ActionPost, registered: old, wantCount: 4, wantScope: "user"},
+		{name: "unknown registration time", action: ActionPost, wantCount: 4, wantScope: "user"},
+		{name: "new account gets its share", action: ActionPost, registered: recent, wantCount: 2, wantScope: "user"},
+		{name: "disabled limit", action: ActionVote, registered: recent, wantCount: 10},
+		{name: "unlimited action", action: ActionMessage, registered: recent, wantCount: 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rl := NewRateLimiter(limits)
+			count, scope := allowed(rl, tt.action, "alice", "10.0.0.1", tt.registered, 10)
+			if count != tt.wantCount || scope != tt.wantScope {
+				t.Errorf("allowed %d before the %q budget ran out, want %d before %q", count, scope, tt.wantCount, tt.wantScope)
+			}
+		})
+	}
+
+	t.Run("shared IP", func(t *testing.T) {
+		rl := NewRateLimiter(limits)
+		// The IP's budget is 6: alice spends 4 and bob gets the other 2.
+		if count, scope := allowed(rl, ActionPost, "alice", "10.0.0.1", old, 10); count != 4 || scope != "user" {
+			t.Fatalf("alice allowed %d before %q ran out, want 4 before user", count, scope)
+		}
+		if count, scope := allowed(rl, ActionPost, "bob", "10.0.0.1", old, 10); count != 2 || scope != "ip" {
+			t.Fatalf("bob allowed %d before %q ran out, want 2 before ip", count, scope)
+		}
+		// A request the IP turned away is not charged to the user.
+		if count, _ := allowed(rl, ActionPost, "bob", "10.0.0.2", old, 10); count != 2 {
+			t.Errorf("bob allowed %d from another IP, want the 2 left of bob's budget", count)
+		}
+	})
+}
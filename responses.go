@@ -3,20 +3,25 @@ package main
 import (
 	"encoding/json"
 	"net/http"
+
+	"github.com/asynkron/protoactor-go/actor"
 )
 
 // Response structure for API responses.
 type APIResponse struct {
 	Status  string      `json:"status"`
+	Code    string      `json:"code,omitempty"` // The ErrorCode of a failed request.
 	Message string      `json:"message,omitempty"`
 	Data    interface{} `json:"data,omitempty"`
 }
 
 // Error response for failed requests.
-func JSONError(w http.ResponseWriter, code int, message string) {
-	w.WriteHeader(code)
+func JSONError(w http.ResponseWriter, code ErrorCode, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code.HTTPStatus())
 	resp := APIResponse{
 		Status:  "error",
+		Code:    code.String(),
 		Message: message,
 	}
 	json.NewEncoder(w).Encode(resp)
@@ -24,7 +29,17 @@ func JSONError(w http.ResponseWriter, code int, message string) {
 
 // Success response for successful requests.
 func JSONSuccess(w http.ResponseWriter, data interface{}) {
-	w.WriteHeader(http.StatusOK)
+	jsonData(w, http.StatusOK, data)
+}
+
+// Created response for requests that made something new, which is returned.
+func JSONCreated(w http.ResponseWriter, data interface{}) {
+	jsonData(w, http.StatusCreated, data)
+}
+
+func jsonData(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
 	resp := APIResponse{
 		Status: "success",
 		Data:   data,
@@ -32,14 +47,40 @@ func JSONSuccess(w http.ResponseWriter, data interface{}) {
 	json.NewEncoder(w).Encode(resp)
 }
 
-func JSONFeed(w http.ResponseWriter, data map[string]interface{}) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
+// engineResult waits for the engine's reply to a request. A timeout or a reply
+// that is not a Result becomes a failed Result, so callers always get one.
+func engineResult(future *actor.Future) *Result {
+	resp, err := future.Result()
+	if err != nil {
+		engineTimeouts.Inc()
+		return failure(CodeTimeout, "The engine did not respond in time")
+	}
+	result, ok := resp.(*Result)
+	if !ok {
+		return failure(CodeInternal, "Unexpected reply from the engine")
+	}
+	return result
+}
 
-	resp := APIResponse{
-		Status: "success",
-		Data:   data,
+// writeResult writes result as the request's one response. A successful result
+// without a payload is reported with the message acknowledged.
+func writeResult(w http.ResponseWriter, result *Result, acknowledged string) {
+	switch {
+	case !result.OK():
+		JSONError(w, result.Code, result.Message)
+	case result.Data != nil:
+		JSONSuccess(w, result.Data)
+	default:
+		JSONSuccess(w, acknowledged)
 	}
+}
 
-	json.NewEncoder(w).Encode(resp)
+// writeCreated writes the result of a request that creates something, replying
+// 201 with what was created.
+func writeCreated(w http.ResponseWriter, result *Result) {
+	if !result.OK() {
+		JSONError(w, result.Code, result.Message)
+		return
+	}
+	JSONCreated(w, result.Data)
 }
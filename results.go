@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// ErrorCode classifies why a request failed. The engine replies with one in
+// every Result, and the HTTP layer maps it to a status code in one place.
+type ErrorCode int
+
+const (
+	CodeOK ErrorCode = iota
+	CodeInvalidRequest
+	CodeInvalidCursor
+	CodeUnauthorized
+	CodeForbidden
+	CodeBanned
+	CodeUserNotFound
+	CodeSubredditNotFound
+	CodePostNotFound
+	CodeCommentNotFound
+	CodeMessageNotFound
+	CodeMediaNotFound
+	CodeNotificationNotFound
+	CodeUserExists
+	CodeSubredditExists
+	CodeTooLarge
+	CodeUnsupportedMedia
+	CodeRateLimited
+	CodeTimeout
+	CodeInternal
+)
+
+var errorCodeNames = map[ErrorCode]string{
+	CodeOK:                   "ok",
+	CodeInvalidRequest:       "invalid_request",
+	CodeInvalidCursor:        "invalid_cursor",
+	CodeUnauthorized:         "unauthorized",
+	CodeForbidden:            "forbidden",
+	CodeBanned:               "banned",
+	CodeUserNotFound:         "user_not_found",
+	CodeSubredditNotFound:    "subreddit_not_found",
+	CodePostNotFound:         "post_not_found",
+	CodeCommentNotFound:      "comment_not_found",
+	CodeMessageNotFound:      "message_not_found",
+	CodeMediaNotFound:        "media_not_found",
+	CodeNotificationNotFound: "notification_not_found",
+	CodeUserExists:           "user_exists",
+	CodeSubredditExists:      "subreddit_exists",
+	CodeTooLarge:             "too_large",
+	CodeUnsupportedMedia:     "unsupported_media",
+	CodeRateLimited:          "rate_limited",
+	CodeTimeout:              "timeout",
+	CodeInternal:             "internal",
+}
+
+// String returns the code's name as it appears in error responses.
+func (c ErrorCode) String() string {
+	if name, ok := errorCodeNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("ErrorCode(%d)", int(c))
+}
+
+// HTTPStatus returns the HTTP status code a response carrying c is sent with.
+func (c ErrorCode) HTTPStatus() int {
+	switch c {
+	case CodeOK:
+		return http.StatusOK
+	case CodeInvalidRequest, CodeInvalidCursor:
+		return http.StatusBadRequest
+	case CodeUnauthorized:
+		return http.StatusUnauthorized
+	case CodeForbidden, CodeBanned:
+		return http.StatusForbidden
+	case CodeUserNotFound, CodeSubredditNotFound, CodePostNotFound, CodeCommentNotFound, CodeMessageNotFound, CodeMediaNotFound, CodeNotificationNotFound:
+		return http.StatusNotFound
+	case CodeUserExists, CodeSubredditExists:
+		return http.StatusConflict
+	case CodeTooLarge:
+		return http.StatusRequestEntityTooLarge
+	case CodeUnsupportedMedia:
+		return http.StatusUnsupportedMediaType
+	case CodeRateLimited:
+		return http.StatusTooManyRequests
+	case CodeTimeout:
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusInternalServerError
+}
+
+// Result is the reply to every request sent to the engine and its subreddit actors.
+type Result struct {
+	Code    ErrorCode
+	Message string      // Why the request failed; empty on success.
+	Data    interface{} // The reply's payload on success, or nil if there is none.
+}
+
+// OK reports whether the request succeeded.
+func (r *Result) OK() bool {
+	return r.Code == CodeOK
+}
+
+func success(data interface{}) *Result {
+	return &Result{Code: CodeOK, Data: data}
+}
+
+func failure(code ErrorCode, format string, args ...interface{}) *Result {
+	return &Result{Code: code, Message: fmt.Sprintf(format, args...)}
+}
@@ -2,112 +2,447 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"golang.org/x/crypto/bcrypt"
 )
 
+const minPasswordLength = 8
+
+// dummyPasswordHash is compared against when a login names an unknown user, so
+// that unknown and known usernames take the same time to reject.
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("not-a-real-password"), bcrypt.DefaultCost)
+
 // Initialize routes
 func InitializeRoutes(router *mux.Router, rs *RedditSystem) {
+	router.Use(MetricsMiddleware)
+	router.Use(AuthMiddleware(rs))
+	router.Use(RateLimitMiddleware(rs.limiter))
 	router.HandleFunc("/register", RegisterUserHandler(rs)).Methods("POST")
+	router.HandleFunc("/login", LoginHandler(rs)).Methods("POST")
 	router.HandleFunc("/subreddit/create", CreateSubredditHandler(rs)).Methods("POST")
 	router.HandleFunc("/subreddit/join", JoinSubredditHandler(rs)).Methods("POST")
+	router.HandleFunc("/subreddit/leave", LeaveSubredditHandler(rs)).Methods("POST")
+	router.HandleFunc("/subreddit/{name}/members", GetSubredditMembersHandler(rs)).Methods("GET")
+	router.HandleFunc("/subreddit/{name}/moderators", GetModeratorsHandler(rs)).Methods("GET")
+	router.HandleFunc("/subreddit/moderators/add", AddModeratorHandler(rs)).Methods("POST")
+	router.HandleFunc("/subreddit/moderators/remove", RemoveModeratorHandler(rs)).Methods("POST")
+	router.HandleFunc("/subreddit/ban", BanUserHandler(rs)).Methods("POST")
+	router.HandleFunc("/subreddit/unban", UnbanUserHandler(rs)).Methods("POST")
+	router.HandleFunc("/subreddit/banner", SetBannerHandler(rs)).Methods("POST")
+	router.HandleFunc("/post/remove", RemovePostHandler(rs)).Methods("POST")
+	router.HandleFunc("/comment/remove", RemoveCommentHandler(rs)).Methods("POST")
+	router.HandleFunc("/post/edit", EditPostHandler(rs)).Methods("POST")
+	router.HandleFunc("/post/delete", DeletePostHandler(rs)).Methods("POST")
+	router.HandleFunc("/post/{id}/revisions", GetPostRevisionsHandler(rs)).Methods("GET")
+	router.HandleFunc("/comment/edit", EditCommentHandler(rs)).Methods("POST")
+	router.HandleFunc("/comment/delete", DeleteCommentHandler(rs)).Methods("POST")
+	router.HandleFunc("/comment/{id}/revisions", GetCommentRevisionsHandler(rs)).Methods("GET")
 	router.HandleFunc("/post/create", CreatePostHandler(rs)).Methods("POST")
 	router.HandleFunc("/comment/create", CreateCommentHandler(rs)).Methods("POST")
+	router.HandleFunc("/post/crosspost", CrosspostHandler(rs)).Methods("POST")
+	router.HandleFunc("/post/{id}", GetPostHandler(rs)).Methods("GET")
+	router.HandleFunc("/post/{id}/comments", GetPostCommentsHandler(rs)).Methods("GET")
+	router.HandleFunc("/save", SaveHandler(rs, true)).Methods("POST")
+	router.HandleFunc("/unsave", SaveHandler(rs, false)).Methods("POST")
+	router.HandleFunc("/hide", HideHandler(rs, true)).Methods("POST")
+	router.HandleFunc("/unhide", HideHandler(rs, false)).Methods("POST")
 	router.HandleFunc("/post/upvote", UpvoteHandler(rs)).Methods("POST")
 	router.HandleFunc("/post/downvote", DownvoteHandler(rs)).Methods("POST")
+	router.HandleFunc("/post/clearvote", ClearVoteHandler(rs)).Methods("POST")
 	router.HandleFunc("/message/send", SendDirectMessageHandler(rs)).Methods("POST")
+	router.HandleFunc("/messages/inbox", GetMessagesHandler(rs, "inbox")).Methods("GET")
+	router.HandleFunc("/messages/sent", GetMessagesHandler(rs, "sent")).Methods("GET")
+	router.HandleFunc("/messages/conversation/{otherUser}", GetMessagesHandler(rs, "conversation")).Methods("GET")
+	router.HandleFunc("/messages/read", MarkMessageReadHandler(rs)).Methods("POST")
+	router.HandleFunc("/notifications", GetNotificationsHandler(rs)).Methods("GET")
+	router.HandleFunc("/notifications/read", MarkNotificationsReadHandler(rs)).Methods("POST")
+	router.HandleFunc("/notifications/mute", MuteHandler(rs, true)).Methods("POST")
+	router.HandleFunc("/notifications/unmute", MuteHandler(rs, false)).Methods("POST")
 	router.HandleFunc("/feed/{username}", GetUserFeedHandler(rs)).Methods("GET")
+	router.HandleFunc("/user/{username}", GetUserProfileHandler(rs)).Methods("GET")
+	router.HandleFunc("/user/avatar", SetAvatarHandler(rs)).Methods("POST")
+	router.HandleFunc("/user/{username}/saved", GetSavedHandler(rs)).Methods("GET")
+	router.HandleFunc("/user/{username}/subreddits", GetUserSubredditsHandler(rs)).Methods("GET")
+	router.HandleFunc("/search", SearchHandler(rs)).Methods("GET")
+	router.HandleFunc("/media", UploadMediaHandler(rs)).Methods("POST")
+	router.HandleFunc("/media/{hash}", GetMediaHandler(rs, false)).Methods("GET", "HEAD")
+	router.HandleFunc("/media/{hash}/thumb", GetMediaHandler(rs, true)).Methods("GET", "HEAD")
+	router.HandleFunc("/stream", StreamHandler(rs)).Methods("GET")
+	router.Handle("/metrics", promhttp.Handler()).Methods("GET")
+
+	// The description is built last, from the routes above.
+	spec := &apiSpec{}
+	router.Handle("/openapi.json", spec).Methods("GET")
+	if err := spec.build(router); err != nil {
+		errorf("Error building the OpenAPI description: %v\n", err)
+	}
+}
+
+// Credentials is the body of register and login requests.
+type Credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
 }
 
 // Handle user registration
 func RegisterUserHandler(rs *RedditSystem) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		var request struct {
-			Username string `json:"username"`
-		}
+		var request Credentials
 		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-			JSONError(w, http.StatusBadRequest, "Invalid request body")
+			JSONError(w, CodeInvalidRequest, "Invalid request body")
+			return
+		}
+		if len(request.Password) < minPasswordLength {
+			JSONError(w, CodeInvalidRequest, fmt.Sprintf("Password must be at least %d characters", minPasswordLength))
+			return
+		}
+		hash, err := bcrypt.GenerateFromPassword([]byte(request.Password), bcrypt.DefaultCost)
+		if err != nil {
+			JSONError(w, CodeInvalidRequest, "Invalid password")
 			return
 		}
 
 		// Create the RegisterUser message and send it to the engine actor
-		result := rs.system.Root.RequestFuture(engineActor, &RegisterUser{Username: request.Username}, 1*time.Second)
+		result := rs.system.Root.RequestFuture(engineActor, &RegisterUser{Username: request.Username, PasswordHash: string(hash)}, rs.timeout)
 
-		if resp, err := result.Result(); resp == true && err == nil {
-			// Respond with success message
-			JSONSuccess(w, "User registered successfully")
-		} else {
-			JSONError(w, 200, "Username already taken")
+		writeResult(w, engineResult(result), "User registered successfully")
+	}
+}
+
+// LoginToken is the reply to a successful login.
+type LoginToken struct {
+	Token     string    `json:"token"`
+	TokenType string    `json:"token_type"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Handle login, issuing a bearer token for the user
+func LoginHandler(rs *RedditSystem) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request Credentials
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			JSONError(w, CodeInvalidRequest, "Invalid request body")
+			return
+		}
+
+		// Fetch the stored hash from the engine actor and check it here, off the actor
+		result := rs.system.Root.RequestFuture(engineActor, &GetPasswordHash{Username: request.Username}, rs.timeout)
+
+		reply := engineResult(result)
+		if reply.Code == CodeTimeout {
+			JSONError(w, reply.Code, reply.Message)
+			return
+		}
+		account, known := reply.Data.(*Account)
+		if !reply.OK() || !known || account.PasswordHash == "" {
+			bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(request.Password))
+			JSONError(w, CodeUnauthorized, "Invalid username or password")
+			return
 		}
+		if bcrypt.CompareHashAndPassword([]byte(account.PasswordHash), []byte(request.Password)) != nil {
+			JSONError(w, CodeUnauthorized, "Invalid username or password")
+			return
+		}
+
+		token, expiresAt := rs.auth.Issue(request.Username, account.CreatedAt)
+		JSONSuccess(w, &LoginToken{Token: token, TokenType: "Bearer", ExpiresAt: expiresAt})
 	}
 }
 
+// CreateSubredditRequest is the body of a subreddit creation request.
+type CreateSubredditRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
 // Handle subreddit creation
 func CreateSubredditHandler(rs *RedditSystem) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		var request struct {
-			Name        string `json:"name"`
-			Description string `json:"description"`
-		}
+		var request CreateSubredditRequest
 		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-			JSONError(w, http.StatusBadRequest, "Invalid request body")
+			JSONError(w, CodeInvalidRequest, "Invalid request body")
 			return
 		}
 
-		result := rs.system.Root.RequestFuture(engineActor, &CreateSubreddit{Name: request.Name, Description: request.Description}, 1*time.Second)
+		result := rs.system.Root.RequestFuture(engineActor, &CreateSubreddit{Name: request.Name, Description: request.Description, Creator: actingUser(r)}, rs.timeout)
 
-		if resp, err := result.Result(); resp == true && err == nil {
-			// Respond with success message
-			JSONSuccess(w, "Subreddit created successfully")
-		} else {
-			JSONError(w, 200, "Subreddit already exists")
-		}
+		writeResult(w, engineResult(result), "Subreddit created successfully")
 	}
 }
 
+// MembershipRequest is the body of join and leave requests.
+type MembershipRequest struct {
+	Username  string `json:"username,omitempty"` // Always the authenticated user; a different value is rejected.
+	Subreddit string `json:"subreddit"`
+}
+
 // Handle joining a subreddit
 func JoinSubredditHandler(rs *RedditSystem) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		var request struct {
-			Username  string `json:"username"`
-			Subreddit string `json:"subreddit"`
-		}
+		var request MembershipRequest
 		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-			JSONError(w, http.StatusBadRequest, "Invalid request body")
+			JSONError(w, CodeInvalidRequest, "Invalid request body")
 			return
 		}
+		request.Username = actingUser(r)
 
 		// Send the JoinSubreddit message to the engine actor
-		result := rs.system.Root.RequestFuture(engineActor, &JoinSubreddit{Username: request.Username, Subreddit: request.Subreddit}, 1*time.Second)
-
-		if resp, err := result.Result(); resp == 200 && err == nil {
-			// Respond with success message
-			JSONSuccess(w, "Subreddit joined successfully")
-		} else {
-			if resp == 301 {
-				JSONError(w, 403, "No such username")
-			} else if resp == 302 {
-				JSONError(w, 403, "No such subreddit")
-			}
+		result := rs.system.Root.RequestFuture(engineActor, &JoinSubreddit{Username: request.Username, Subreddit: request.Subreddit}, rs.timeout)
+
+		writeResult(w, engineResult(result), "Subreddit joined successfully")
+	}
+}
+
+// Handle leaving a subreddit
+func LeaveSubredditHandler(rs *RedditSystem) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request MembershipRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			JSONError(w, CodeInvalidRequest, "Invalid request body")
+			return
 		}
+		request.Username = actingUser(r)
+
+		// Send the LeaveSubreddit message to the engine actor
+		result := rs.system.Root.RequestFuture(engineActor, &LeaveSubreddit{Username: request.Username, Subreddit: request.Subreddit}, rs.timeout)
+
+		writeResult(w, engineResult(result), "Subreddit left successfully")
 	}
 }
 
+// Handle listing the members of a subreddit
+func GetSubredditMembersHandler(rs *RedditSystem) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		page, err := pageParams(r.URL.Query())
+		if err != nil {
+			JSONError(w, CodeInvalidRequest, err.Error())
+			return
+		}
+
+		// Send the GetSubredditMembers message to the engine actor
+		result := rs.system.Root.RequestFuture(engineActor, &GetSubredditMembers{Subreddit: vars["name"], Page: page}, rs.timeout)
+
+		writeResult(w, engineResult(result), "")
+	}
+}
+
+// Handle listing the owner and moderators of a subreddit
+func GetModeratorsHandler(rs *RedditSystem) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		// Send the GetModerators message to the engine actor
+		result := rs.system.Root.RequestFuture(engineActor, &GetModerators{Subreddit: vars["name"]}, rs.timeout)
+
+		writeResult(w, engineResult(result), "")
+	}
+}
+
+// AddModeratorRequest is the body of a request to make a user a moderator.
+type AddModeratorRequest struct {
+	Subreddit   string   `json:"subreddit"`
+	Moderator   string   `json:"moderator"`
+	Permissions []string `json:"permissions,omitempty"`
+}
+
+// Handle the owner making a user a moderator
+func AddModeratorHandler(rs *RedditSystem) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request AddModeratorRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			JSONError(w, CodeInvalidRequest, "Invalid request body")
+			return
+		}
+
+		// Send the AddModerator message to the engine actor
+		result := rs.system.Root.RequestFuture(engineActor, &AddModerator{
+			Subreddit:   request.Subreddit,
+			By:          actingUser(r),
+			Username:    request.Moderator,
+			Permissions: request.Permissions,
+		}, rs.timeout)
+
+		writeResult(w, engineResult(result), "")
+	}
+}
+
+// RemoveModeratorRequest is the body of a request to remove a moderator.
+type RemoveModeratorRequest struct {
+	Subreddit string `json:"subreddit"`
+	Moderator string `json:"moderator"`
+}
+
+// Handle the owner removing a moderator
+func RemoveModeratorHandler(rs *RedditSystem) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request RemoveModeratorRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			JSONError(w, CodeInvalidRequest, "Invalid request body")
+			return
+		}
+
+		// Send the RemoveModerator message to the engine actor
+		result := rs.system.Root.RequestFuture(engineActor, &RemoveModerator{Subreddit: request.Subreddit, By: actingUser(r), Username: request.Moderator}, rs.timeout)
+
+		writeResult(w, engineResult(result), "Moderator removed successfully")
+	}
+}
+
+// BanRequest is the body of a ban request.
+type BanRequest struct {
+	Subreddit string     `json:"subreddit"`
+	User      string     `json:"user"`
+	Reason    string     `json:"reason,omitempty"`
+	Until     *time.Time `json:"until,omitempty"` // RFC 3339; omit for a permanent ban.
+}
+
+// Handle a moderator banning a user from a subreddit
+func BanUserHandler(rs *RedditSystem) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request BanRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			JSONError(w, CodeInvalidRequest, "Invalid request body")
+			return
+		}
+		ban := &BanUser{Subreddit: request.Subreddit, By: actingUser(r), Username: request.User, Reason: request.Reason}
+		if request.Until != nil {
+			ban.Until = *request.Until
+		}
+
+		// Send the BanUser message to the engine actor
+		result := rs.system.Root.RequestFuture(engineActor, ban, rs.timeout)
+
+		writeResult(w, engineResult(result), "")
+	}
+}
+
+// UnbanRequest is the body of a request to lift a ban.
+type UnbanRequest struct {
+	Subreddit string `json:"subreddit"`
+	User      string `json:"user"`
+}
+
+// Handle a moderator lifting a ban
+func UnbanUserHandler(rs *RedditSystem) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request UnbanRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			JSONError(w, CodeInvalidRequest, "Invalid request body")
+			return
+		}
+
+		// Send the UnbanUser message to the engine actor
+		result := rs.system.Root.RequestFuture(engineActor, &UnbanUser{Subreddit: request.Subreddit, By: actingUser(r), Username: request.User}, rs.timeout)
+
+		writeResult(w, engineResult(result), "User unbanned successfully")
+	}
+}
+
+// SetBannerRequest is the body of an owner's request to set a subreddit's banner.
+type SetBannerRequest struct {
+	Subreddit string `json:"subreddit"`
+	Banner    string `json:"banner"` // Hash from POST /media, or empty to clear the banner.
+}
+
+// Handle a subreddit's owner setting its banner
+func SetBannerHandler(rs *RedditSystem) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request SetBannerRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			JSONError(w, CodeInvalidRequest, "Invalid request body")
+			return
+		}
+		if request.Banner != "" && !rs.media.Has(request.Banner) {
+			JSONError(w, CodeMediaNotFound, fmt.Sprintf("No uploaded image with hash %q", request.Banner))
+			return
+		}
+
+		// Send the SetBanner message to the engine actor
+		result := rs.system.Root.RequestFuture(engineActor, &SetBanner{Subreddit: request.Subreddit, By: actingUser(r), Banner: request.Banner}, rs.timeout)
+
+		writeResult(w, engineResult(result), "")
+	}
+}
+
+// RemovePostRequest is the body of a moderator's post removal.
+type RemovePostRequest struct {
+	PostID string `json:"post_id"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// Handle a moderator removing a post
+func RemovePostHandler(rs *RedditSystem) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request RemovePostRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			JSONError(w, CodeInvalidRequest, "Invalid request body")
+			return
+		}
+
+		// Send the RemovePost message to the engine actor
+		result := rs.system.Root.RequestFuture(engineActor, &RemovePost{By: actingUser(r), PostID: request.PostID, Reason: request.Reason}, rs.timeout)
+
+		writeResult(w, engineResult(result), "")
+	}
+}
+
+// RemoveCommentRequest is the body of a moderator's comment removal.
+type RemoveCommentRequest struct {
+	CommentID string `json:"comment_id"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// Handle a moderator removing a comment
+func RemoveCommentHandler(rs *RedditSystem) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request RemoveCommentRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			JSONError(w, CodeInvalidRequest, "Invalid request body")
+			return
+		}
+
+		// Send the RemoveComment message to the engine actor
+		result := rs.system.Root.RequestFuture(engineActor, &RemoveComment{By: actingUser(r), CommentID: request.CommentID, Reason: request.Reason}, rs.timeout)
+
+		writeResult(w, engineResult(result), "")
+	}
+}
+
+// CreatePostRequest is the body of a post creation request.
+type CreatePostRequest struct {
+	Title     string      `json:"title"`
+	Content   string      `json:"content"`
+	Author    string      `json:"author,omitempty"` // Always the authenticated user; a different value is rejected.
+	Subreddit string      `json:"subreddit"`
+	Kind      string      `json:"kind,omitempty" enum:"text,link,image,gallery"` // Defaults to text.
+	URL       string      `json:"url,omitempty"`                                 // Link posts.
+	Images    []PostImage `json:"images,omitempty"`                              // Hashes from POST /media, in display order.
+}
+
 // Handle post creation
 func CreatePostHandler(rs *RedditSystem) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		var request struct {
-			Title     string `json:"title"`
-			Content   string `json:"content"`
-			Author    string `json:"author"`
-			Subreddit string `json:"subreddit"`
-		}
+		var request CreatePostRequest
 		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-			JSONError(w, http.StatusBadRequest, "Invalid request body")
+			JSONError(w, CodeInvalidRequest, "Invalid request body")
 			return
 		}
+		request.Author = actingUser(r)
+		for _, image := range request.Images {
+			if !rs.media.Has(image.Hash) {
+				JSONError(w, CodeMediaNotFound, fmt.Sprintf("No uploaded image with hash %q", image.Hash))
+				return
+			}
+		}
 
 		// Send the createPost message to the engine actor
 		result := rs.system.Root.RequestFuture(engineActor, &CreatePost{
@@ -115,35 +450,33 @@ func CreatePostHandler(rs *RedditSystem) http.HandlerFunc {
 			Content:   request.Content,
 			Author:    request.Author,
 			Subreddit: request.Subreddit,
-		}, 1*time.Second)
-
-		if resp, err := result.Result(); resp == 200 && err == nil {
-			// Respond with success message
-			JSONSuccess(w, "Post created successfully")
-		} else {
-			if resp == 301 {
-				JSONError(w, 403, "No such username")
-			} else if resp == 302 {
-				JSONError(w, 403, "No such subreddit")
-			}
-		}
+			Kind:      request.Kind,
+			URL:       request.URL,
+			Images:    request.Images,
+		}, rs.timeout)
+
+		writeCreated(w, engineResult(result))
 	}
 }
 
+// CreateCommentRequest is the body of a comment creation request.
+type CreateCommentRequest struct {
+	Content  string `json:"content"`
+	Author   string `json:"author,omitempty"` // Always the authenticated user; a different value is rejected.
+	PostID   string `json:"post_id"`
+	ParentID string `json:"parent_id,omitempty"`
+}
+
 // Handle comment creation
 func CreateCommentHandler(rs *RedditSystem) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		var request struct {
-			Content  string `json:"content"`
-			Author   string `json:"author"`
-			PostID   string `json:"post_id"`
-			ParentID string `json:"parent_id,omitempty"`
-		}
+		var request CreateCommentRequest
 
 		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-			JSONError(w, http.StatusBadRequest, "Invalid request body")
+			JSONError(w, CodeInvalidRequest, "Invalid request body")
 			return
 		}
+		request.Author = actingUser(r)
 
 		// Send the CreateComment message to the engine actor
 		result := rs.system.Root.RequestFuture(engineActor, &CreateComment{
@@ -151,129 +484,584 @@ func CreateCommentHandler(rs *RedditSystem) http.HandlerFunc {
 			Author:   request.Author,
 			PostID:   request.PostID,
 			ParentID: request.ParentID,
-		}, 1*time.Second)
-
-		if resp, err := result.Result(); resp == 200 && err == nil {
-			// Respond with success message
-			JSONSuccess(w, "Comment created successfully")
-		} else {
-			if resp == 301 {
-				JSONError(w, 403, "No such username")
-			} else if resp == 302 {
-				JSONError(w, 403, "No such post")
-			}
+		}, rs.timeout)
+
+		writeCreated(w, engineResult(result))
+	}
+}
+
+// CrosspostRequest is the body of a request to share a post into another subreddit.
+type CrosspostRequest struct {
+	Author    string `json:"author,omitempty"` // Always the authenticated user; a different value is rejected.
+	PostID    string `json:"post_id"`
+	Subreddit string `json:"subreddit"`       // The subreddit to share into, which the author must have joined.
+	Title     string `json:"title,omitempty"` // Defaults to the original's title.
+}
+
+// Handle crossposting a post into another subreddit
+func CrosspostHandler(rs *RedditSystem) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request CrosspostRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			JSONError(w, CodeInvalidRequest, "Invalid request body")
+			return
 		}
+		request.Author = actingUser(r)
+
+		// Send the Crosspost message to the engine actor
+		result := rs.system.Root.RequestFuture(engineActor, &Crosspost{
+			Author:    request.Author,
+			PostID:    request.PostID,
+			Subreddit: request.Subreddit,
+			Title:     request.Title,
+		}, rs.timeout)
+
+		writeCreated(w, engineResult(result))
 	}
 }
 
-// Handle upvoting a post or comment
-func UpvoteHandler(rs *RedditSystem) http.HandlerFunc {
+// Handle getting a post with its content and media
+func GetPostHandler(rs *RedditSystem) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		var request struct {
-			UserID    string `json:"user_id"`
-			MediaType string `json:"media_type"`
-			TargetID  string `json:"target_id"`
+		vars := mux.Vars(r)
+
+		// Send the GetPost message to the engine actor
+		result := rs.system.Root.RequestFuture(engineActor, &GetPost{PostID: vars["id"]}, rs.timeout)
+
+		writeResult(w, engineResult(result), "")
+	}
+}
+
+// Handle getting the comment tree of a post
+func GetPostCommentsHandler(rs *RedditSystem) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		query := r.URL.Query()
+
+		request := &GetPostComments{
+			PostID:       vars["id"],
+			Sort:         query.Get("sort"),
+			Continuation: query.Get("continuation"),
+			Viewer:       actingUser(r),
+		}
+		var err error
+		if request.Depth, err = intParam(query, "depth"); err != nil {
+			JSONError(w, CodeInvalidRequest, "depth must be a number")
+			return
+		}
+		if request.Limit, err = intParam(query, "limit"); err != nil {
+			JSONError(w, CodeInvalidRequest, "limit must be a number")
+			return
 		}
+
+		// Send the GetPostComments message to the engine actor
+		result := rs.system.Root.RequestFuture(engineActor, request, rs.timeout)
+
+		writeResult(w, engineResult(result), "")
+	}
+}
+
+// EditPostRequest is the body of a post edit; omitted fields are left unchanged.
+type EditPostRequest struct {
+	Author  string  `json:"author,omitempty"` // Always the authenticated user; a different value is rejected.
+	PostID  string  `json:"post_id"`
+	Title   *string `json:"title,omitempty"`
+	Content *string `json:"content,omitempty"`
+}
+
+// Handle the author editing a post's title or content
+func EditPostHandler(rs *RedditSystem) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request EditPostRequest
 		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-			JSONError(w, http.StatusBadRequest, "Invalid request body")
+			JSONError(w, CodeInvalidRequest, "Invalid request body")
 			return
 		}
+		request.Author = actingUser(r)
+
+		// Send the EditPost message to the engine actor
+		result := rs.system.Root.RequestFuture(engineActor, &EditPost{
+			Author:  request.Author,
+			PostID:  request.PostID,
+			Title:   request.Title,
+			Content: request.Content,
+		}, rs.timeout)
+
+		writeResult(w, engineResult(result), "")
+	}
+}
 
-		/// Send the CreateComment message to the engine actor
-		result := rs.system.Root.RequestFuture(engineActor, &Upvote{UserID: request.UserID, MediaType: request.MediaType, TargetID: request.TargetID}, 1*time.Second)
+// DeletePostRequest is the body of a post deletion.
+type DeletePostRequest struct {
+	Author string `json:"author,omitempty"` // Always the authenticated user; a different value is rejected.
+	PostID string `json:"post_id"`
+}
 
-		if resp, err := result.Result(); resp == 201 && err == nil {
-			// Respond with success message
-			JSONSuccess(w, "Post Upvoted successfully")
-		} else if resp == 202 {
-			// Respond with success message
-			JSONSuccess(w, "Comment Upvoted successfully")
-		} else {
-			if resp == 301 {
-				JSONError(w, 403, "No such post")
-			} else if resp == 302 {
-				JSONError(w, 403, "No such comment")
-			}
+// Handle the author deleting a post
+func DeletePostHandler(rs *RedditSystem) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request DeletePostRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			JSONError(w, CodeInvalidRequest, "Invalid request body")
+			return
+		}
+		request.Author = actingUser(r)
+
+		// Send the DeletePost message to the engine actor
+		result := rs.system.Root.RequestFuture(engineActor, &DeletePost{Author: request.Author, PostID: request.PostID}, rs.timeout)
+
+		writeResult(w, engineResult(result), "")
+	}
+}
+
+// Handle getting a post's edit history
+func GetPostRevisionsHandler(rs *RedditSystem) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		// Send the GetPostRevisions message to the engine actor
+		result := rs.system.Root.RequestFuture(engineActor, &GetPostRevisions{PostID: vars["id"]}, rs.timeout)
+
+		writeResult(w, engineResult(result), "")
+	}
+}
+
+// EditCommentRequest is the body of a comment edit.
+type EditCommentRequest struct {
+	Author    string `json:"author,omitempty"` // Always the authenticated user; a different value is rejected.
+	CommentID string `json:"comment_id"`
+	Content   string `json:"content"`
+}
+
+// Handle the author editing a comment
+func EditCommentHandler(rs *RedditSystem) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request EditCommentRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			JSONError(w, CodeInvalidRequest, "Invalid request body")
+			return
+		}
+		request.Author = actingUser(r)
+
+		// Send the EditComment message to the engine actor
+		result := rs.system.Root.RequestFuture(engineActor, &EditComment{Author: request.Author, CommentID: request.CommentID, Content: request.Content}, rs.timeout)
+
+		writeResult(w, engineResult(result), "")
+	}
+}
+
+// DeleteCommentRequest is the body of a comment deletion.
+type DeleteCommentRequest struct {
+	Author    string `json:"author,omitempty"` // Always the authenticated user; a different value is rejected.
+	CommentID string `json:"comment_id"`
+}
+
+// Handle the author deleting a comment
+func DeleteCommentHandler(rs *RedditSystem) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request DeleteCommentRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			JSONError(w, CodeInvalidRequest, "Invalid request body")
+			return
+		}
+		request.Author = actingUser(r)
+
+		// Send the DeleteComment message to the engine actor
+		result := rs.system.Root.RequestFuture(engineActor, &DeleteComment{Author: request.Author, CommentID: request.CommentID}, rs.timeout)
+
+		writeResult(w, engineResult(result), "")
+	}
+}
+
+// Handle getting a comment's edit history
+func GetCommentRevisionsHandler(rs *RedditSystem) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		// Send the GetCommentRevisions message to the engine actor
+		result := rs.system.Root.RequestFuture(engineActor, &GetCommentRevisions{CommentID: vars["id"]}, rs.timeout)
+
+		writeResult(w, engineResult(result), "")
+	}
+}
+
+// pageParams reads the limit, after and before query parameters of a paginated listing.
+func pageParams(query url.Values) (Page, error) {
+	page := Page{After: query.Get("after"), Before: query.Get("before")}
+	limit, err := intParam(query, "limit")
+	if err != nil {
+		return page, errors.New("limit must be a number")
+	}
+	if page.After != "" && page.Before != "" {
+		return page, errors.New("after and before cannot be combined")
+	}
+	page.Limit = limit
+	return page, nil
+}
+
+// intParam reads an optional integer query parameter, returning 0 when it is absent.
+func intParam(query url.Values, name string) (int, error) {
+	value := query.Get(name)
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(value)
+}
+
+// VoteRequest is the body of upvote, downvote and clear vote requests.
+type VoteRequest struct {
+	UserID    string `json:"user_id,omitempty"` // Always the authenticated user; a different value is rejected.
+	MediaType string `json:"media_type" enum:"Post,Comment"`
+	TargetID  string `json:"target_id"`
+}
+
+// Handle upvoting a post or comment
+func UpvoteHandler(rs *RedditSystem) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request VoteRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			JSONError(w, CodeInvalidRequest, "Invalid request body")
+			return
 		}
+		request.UserID = actingUser(r)
+
+		// Send the Upvote message to the engine actor
+		result := rs.system.Root.RequestFuture(engineActor, &Upvote{UserID: request.UserID, MediaType: request.MediaType, TargetID: request.TargetID}, rs.timeout)
+		writeResult(w, engineResult(result), "")
 	}
 }
 
 // Handle downvoting a post or comment
 func DownvoteHandler(rs *RedditSystem) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		var request struct {
-			UserID    string `json:"user_id"`
-			MediaType string `json:"media_type"`
-			TargetID  string `json:"target_id"`
-		}
+		var request VoteRequest
 		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-			JSONError(w, http.StatusBadRequest, "Invalid request body")
+			JSONError(w, CodeInvalidRequest, "Invalid request body")
 			return
 		}
+		request.UserID = actingUser(r)
 
 		// Send the Downvote message to the engine actor
-		result := rs.system.Root.RequestFuture(engineActor, &Downvote{UserID: request.UserID, MediaType: request.MediaType, TargetID: request.TargetID}, 1*time.Second)
-
-		if resp, err := result.Result(); resp == 201 && err == nil {
-			// Respond with success message
-			JSONSuccess(w, "Post Downvoted successfully")
-		} else if resp == 202 {
-			// Respond with success message
-			JSONSuccess(w, "Comment Downvoted successfully")
-		} else {
-			if resp == 301 {
-				JSONError(w, 403, "No such post")
-			} else if resp == 302 {
-				JSONError(w, 403, "No such comment")
-			}
+		result := rs.system.Root.RequestFuture(engineActor, &Downvote{UserID: request.UserID, MediaType: request.MediaType, TargetID: request.TargetID}, rs.timeout)
+		writeResult(w, engineResult(result), "")
+	}
+}
+
+// Handle clearing a vote on a post or comment
+func ClearVoteHandler(rs *RedditSystem) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request VoteRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			JSONError(w, CodeInvalidRequest, "Invalid request body")
+			return
 		}
+		request.UserID = actingUser(r)
+
+		// Send the ClearVote message to the engine actor
+		result := rs.system.Root.RequestFuture(engineActor, &ClearVote{UserID: request.UserID, MediaType: request.MediaType, TargetID: request.TargetID}, rs.timeout)
+		writeResult(w, engineResult(result), "")
 	}
 }
 
+// SaveRequest is the body of save, unsave, hide and unhide requests.
+type SaveRequest struct {
+	Username  string `json:"username,omitempty"` // Always the authenticated user; a different value is rejected.
+	MediaType string `json:"media_type" enum:"Post,Comment"`
+	TargetID  string `json:"target_id"`
+}
+
+// Handle saving or unsaving a post or comment
+func SaveHandler(rs *RedditSystem, saved bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request SaveRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			JSONError(w, CodeInvalidRequest, "Invalid request body")
+			return
+		}
+		request.Username = actingUser(r)
+
+		// Send the SetSaved message to the engine actor
+		result := rs.system.Root.RequestFuture(engineActor, &SetSaved{Username: request.Username, MediaType: request.MediaType, TargetID: request.TargetID, Saved: saved}, rs.timeout)
+
+		writeResult(w, engineResult(result), "")
+	}
+}
+
+// Handle hiding or unhiding a post or comment
+func HideHandler(rs *RedditSystem, hidden bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request SaveRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			JSONError(w, CodeInvalidRequest, "Invalid request body")
+			return
+		}
+		request.Username = actingUser(r)
+
+		// Send the SetHidden message to the engine actor
+		result := rs.system.Root.RequestFuture(engineActor, &SetHidden{Username: request.Username, MediaType: request.MediaType, TargetID: request.TargetID, Hidden: hidden}, rs.timeout)
+
+		writeResult(w, engineResult(result), "")
+	}
+}
+
+// SendMessageRequest is the body of a direct message.
+type SendMessageRequest struct {
+	From    string `json:"from,omitempty"` // Always the authenticated user; a different value is rejected.
+	To      string `json:"to"`
+	Content string `json:"content"`
+	ReplyTo string `json:"reply_to,omitempty"`
+}
+
 // Handle sending direct messages
 func SendDirectMessageHandler(rs *RedditSystem) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		var request struct {
-			From    string `json:"from"`
-			To      string `json:"to"`
-			Content string `json:"content"`
-		}
+		var request SendMessageRequest
 		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-			JSONError(w, http.StatusBadRequest, "Invalid request body")
+			JSONError(w, CodeInvalidRequest, "Invalid request body")
 			return
 		}
+		request.From = actingUser(r)
 
 		// Send the SendDirectMessage message to the engine actor
 		result := rs.system.Root.RequestFuture(engineActor, &SendDirectMessage{
 			From:    request.From,
 			To:      request.To,
 			Content: request.Content,
-		}, 1*time.Second)
-
-		if resp, err := result.Result(); resp == 200 && err == nil {
-			// Respond with success message
-			JSONSuccess(w, "DM sent successfully")
-		} else {
-			if resp == 301 {
-				JSONError(w, 403, "Sender doesn't exist")
-			} else if resp == 302 {
-				JSONError(w, 403, "Receiver doesn't exist")
-			}
+			ReplyTo: request.ReplyTo,
+		}, rs.timeout)
+
+		writeResult(w, engineResult(result), "")
+	}
+}
+
+// Handle listing the acting user's inbox, sent messages or a conversation
+func GetMessagesHandler(rs *RedditSystem, box string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		page, err := pageParams(r.URL.Query())
+		if err != nil {
+			JSONError(w, CodeInvalidRequest, err.Error())
+			return
 		}
+
+		// Send the GetMessages message to the engine actor
+		result := rs.system.Root.RequestFuture(engineActor, &GetMessages{
+			Username: actingUser(r),
+			Box:      box,
+			With:     vars["otherUser"],
+			Page:     page,
+		}, rs.timeout)
+
+		writeResult(w, engineResult(result), "")
 	}
 }
 
-// Handle getting a user's feed
+// MarkReadRequest is the body of a request to mark a message read.
+type MarkReadRequest struct {
+	MessageID string `json:"message_id"`
+}
+
+// Handle marking a received message as read
+func MarkMessageReadHandler(rs *RedditSystem) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request MarkReadRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			JSONError(w, CodeInvalidRequest, "Invalid request body")
+			return
+		}
+
+		// Send the MarkMessageRead message to the engine actor
+		result := rs.system.Root.RequestFuture(engineActor, &MarkMessageRead{Username: actingUser(r), MessageID: request.MessageID}, rs.timeout)
+
+		writeResult(w, engineResult(result), "")
+	}
+}
+
+// Handle listing the acting user's notifications
+func GetNotificationsHandler(rs *RedditSystem) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		page, err := pageParams(query)
+		if err != nil {
+			JSONError(w, CodeInvalidRequest, err.Error())
+			return
+		}
+
+		// Send the GetNotifications message to the engine actor
+		result := rs.system.Root.RequestFuture(engineActor, &GetNotifications{
+			Username: actingUser(r),
+			Unread:   query.Get("unread") == "true",
+			Page:     page,
+		}, rs.timeout)
+
+		writeResult(w, engineResult(result), "")
+	}
+}
+
+// MarkNotificationsReadRequest is the body of a request to mark notifications read.
+type MarkNotificationsReadRequest struct {
+	NotificationID string `json:"notification_id,omitempty"` // Marks every notification read if omitted.
+}
+
+// Handle marking one or all of the acting user's notifications as read
+func MarkNotificationsReadHandler(rs *RedditSystem) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request MarkNotificationsReadRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			JSONError(w, CodeInvalidRequest, "Invalid request body")
+			return
+		}
+
+		// Send the MarkNotificationsRead message to the engine actor
+		result := rs.system.Root.RequestFuture(engineActor, &MarkNotificationsRead{Username: actingUser(r), NotificationID: request.NotificationID}, rs.timeout)
+
+		writeResult(w, engineResult(result), "")
+	}
+}
+
+// MuteRequest is the body of mute and unmute requests.
+type MuteRequest struct {
+	PostID string `json:"post_id"`
+}
+
+// Handle muting or unmuting notifications about a post
+func MuteHandler(rs *RedditSystem, muted bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request MuteRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			JSONError(w, CodeInvalidRequest, "Invalid request body")
+			return
+		}
+
+		// Send the SetMuted message to the engine actor
+		result := rs.system.Root.RequestFuture(engineActor, &SetMuted{Username: actingUser(r), PostID: request.PostID, Muted: muted}, rs.timeout)
+
+		writeResult(w, engineResult(result), "")
+	}
+}
+
+// Handle getting the acting user's feed
 func GetUserFeedHandler(rs *RedditSystem) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
 		username := vars["username"]
+		if username != actingUser(r) {
+			JSONError(w, CodeForbidden, "Feeds are private")
+			return
+		}
+		query := r.URL.Query()
+
+		page, err := pageParams(query)
+		if err != nil {
+			JSONError(w, CodeInvalidRequest, err.Error())
+			return
+		}
 
 		// Send the GetUserFeed message to the engine actor
-		result := rs.system.Root.RequestFuture(engineActor, &GetUserFeed{Username: username, writer: w}, 1*time.Second)
+		result := rs.system.Root.RequestFuture(engineActor, &GetUserFeed{
+			Username: username,
+			Sort:     query.Get("sort"),
+			Time:     query.Get("t"),
+			Page:     page,
+		}, rs.timeout)
+
+		writeResult(w, engineResult(result), "")
+	}
+}
 
-		if resp, err := result.Result(); resp == 200 && err == nil {
+// Handle getting a user's profile
+func GetUserProfileHandler(rs *RedditSystem) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		username := vars["username"]
+
+		// Send the GetUserProfile message to the engine actor
+		result := rs.system.Root.RequestFuture(engineActor, &GetUserProfile{Username: username}, rs.timeout)
+
+		writeResult(w, engineResult(result), "")
+	}
+}
+
+// SetAvatarRequest is the body of a request to set the acting user's avatar.
+type SetAvatarRequest struct {
+	Username string `json:"username,omitempty"` // Always the authenticated user; a different value is rejected.
+	Avatar   string `json:"avatar"`             // Hash from POST /media, or empty to clear the avatar.
+}
+
+// Handle setting a user's avatar
+func SetAvatarHandler(rs *RedditSystem) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request SetAvatarRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			JSONError(w, CodeInvalidRequest, "Invalid request body")
 			return
 		}
+		request.Username = actingUser(r)
+		if request.Avatar != "" && !rs.media.Has(request.Avatar) {
+			JSONError(w, CodeMediaNotFound, fmt.Sprintf("No uploaded image with hash %q", request.Avatar))
+			return
+		}
+
+		// Send the SetAvatar message to the engine actor
+		result := rs.system.Root.RequestFuture(engineActor, &SetAvatar{Username: request.Username, Avatar: request.Avatar}, rs.timeout)
+
+		writeResult(w, engineResult(result), "")
+	}
+}
+
+// Handle listing a user's saved posts and comments, which only they may see
+func GetSavedHandler(rs *RedditSystem) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		username := vars["username"]
+		if username != actingUser(r) {
+			JSONError(w, CodeForbidden, "Saved items are private")
+			return
+		}
+
+		page, err := pageParams(r.URL.Query())
+		if err != nil {
+			JSONError(w, CodeInvalidRequest, err.Error())
+			return
+		}
+
+		// Send the GetSaved message to the engine actor
+		result := rs.system.Root.RequestFuture(engineActor, &GetSaved{Username: username, Page: page}, rs.timeout)
+
+		writeResult(w, engineResult(result), "")
+	}
+}
+
+// Handle listing the subreddits a user has joined
+func GetUserSubredditsHandler(rs *RedditSystem) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		// Send the GetUserSubreddits message to the engine actor
+		result := rs.system.Root.RequestFuture(engineActor, &GetUserSubreddits{Username: vars["username"]}, rs.timeout)
+
+		writeResult(w, engineResult(result), "")
+	}
+}
+
+// Handle searching posts, comments and subreddits
+func SearchHandler(rs *RedditSystem) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		page, err := pageParams(query)
+		if err != nil {
+			JSONError(w, CodeInvalidRequest, err.Error())
+			return
+		}
+
+		// Send the Search message to the engine actor
+		result := rs.system.Root.RequestFuture(engineActor, &Search{
+			Query: query.Get("q"),
+			Sort:  query.Get("sort"),
+			Page:  page,
+		}, rs.timeout)
+
+		writeResult(w, engineResult(result), "")
 	}
 }
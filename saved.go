@@ -0,0 +1,307 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"time"
+
+	"github.com/asynkron/protoactor-go/actor"
+)
+
+// SetSaved saves a post or comment for the user, or unsaves it.
+type SetSaved struct {
+	Username  string
+	MediaType string // "Post" or "Comment".
+	TargetID  string
+	Saved     bool
+}
+
+// SetHidden hides a post or comment from the user, or shows it again. Hidden
+// posts are left out of the user's feed, and hidden comments out of the
+// comment trees the user reads with a token.
+type SetHidden struct {
+	Username  string
+	MediaType string // "Post" or "Comment".
+	TargetID  string
+	Hidden    bool
+}
+
+type GetSaved struct {
+	Username string
+	Page
+}
+
+// SavedItem is a post or comment a user has saved.
+type SavedItem struct {
+	MediaType string
+	TargetID  string
+	SavedAt   time.Time
+}
+
+func (si *SavedItem) sortKey() sortKey {
+	return sortKey{CreatedAt: si.SavedAt.UnixNano(), ID: si.TargetID}
+}
+
+// SaveResult is the engine's reply to SetSaved and SetHidden: whether the
+// target is saved and hidden after the request.
+type SaveResult struct {
+	MediaType string `json:"media_type"`
+	TargetID  string `json:"target_id"`
+	Saved     bool   `json:"saved"`
+	Hidden    bool   `json:"hidden"`
+}
+
+// SavedView is a saved post or comment as it is now, rather than as it was
+// when it was saved.
+type SavedView struct {
+	MediaType string     `json:"media_type"`
+	ID        string     `json:"id"`
+	SavedAt   time.Time  `json:"saved_at"`
+	Subreddit string     `json:"subreddit"`
+	Author    string     `json:"author"`
+	Title     string     `json:"title"`             // For a comment, the title of its post.
+	PostID    string     `json:"post_id,omitempty"` // Comments only.
+	Content   string     `json:"content"`
+	Score     int        `json:"score"`
+	CreatedAt time.Time  `json:"created_at"`
+	EditedAt  *time.Time `json:"edited_at,omitempty"`
+	Deleted   bool       `json:"deleted,omitempty"` // Deleted by its author or removed by a moderator.
+}
+
+// SavedList is the engine's reply to GetSaved, most recently saved first.
+type SavedList struct {
+	Username string      `json:"username"`
+	Items    []SavedView `json:"items"`
+	Before   string      `json:"before,omitempty"`
+	After    string      `json:"after,omitempty"`
+}
+
+// getSavedItems asks a subreddit actor to render some of its posts and comments.
+type getSavedItems struct {
+	PostIDs    []string
+	CommentIDs []string
+}
+
+// savedItems is a subreddit actor's reply to getSavedItems, keyed by ID.
+type savedItems struct {
+	Items map[string]SavedView
+}
+
+func (re *RedditEngine) setSaved(msg *SetSaved, context actor.Context) {
+	user, exists := re.users[msg.Username]
+	if !exists {
+		debugf("No such user with username %s\n", msg.Username)
+		context.Respond(failure(CodeUserNotFound, "No such username"))
+		return
+	}
+	if _, rejected := re.targetSubreddit(msg.MediaType, msg.TargetID); rejected != nil {
+		context.Respond(rejected)
+		return
+	}
+
+	index := -1
+	for i, item := range user.Saved {
+		if item.TargetID == msg.TargetID {
+			index = i
+			break
+		}
+	}
+	switch {
+	case msg.Saved && index < 0:
+		user.Saved = append(user.Saved, &SavedItem{MediaType: msg.MediaType, TargetID: msg.TargetID, SavedAt: re.now})
+	case !msg.Saved && index >= 0:
+		user.Saved = append(user.Saved[:index], user.Saved[index+1:]...)
+	}
+	debugf("User %s set saved %v on %s %s\n", user.Username, msg.Saved, msg.MediaType, msg.TargetID)
+	context.Respond(success(&SaveResult{MediaType: msg.MediaType, TargetID: msg.TargetID, Saved: msg.Saved, Hidden: user.Hidden[msg.TargetID]}))
+}
+
+func (re *RedditEngine) setHidden(msg *SetHidden, context actor.Context) {
+	user, exists := re.users[msg.Username]
+	if !exists {
+		debugf("No such user with username %s\n", msg.Username)
+		context.Respond(failure(CodeUserNotFound, "No such username"))
+		return
+	}
+	if _, rejected := re.targetSubreddit(msg.MediaType, msg.TargetID); rejected != nil {
+		context.Respond(rejected)
+		return
+	}
+
+	if msg.Hidden {
+		if user.Hidden == nil {
+			user.Hidden = make(map[string]bool)
+		}
+		user.Hidden[msg.TargetID] = true
+	} else {
+		delete(user.Hidden, msg.TargetID)
+	}
+	saved := false
+	for _, item := range user.Saved {
+		saved = saved || item.TargetID == msg.TargetID
+	}
+	debugf("User %s set hidden %v on %s %s\n", user.Username, msg.Hidden, msg.MediaType, msg.TargetID)
+	context.Respond(success(&SaveResult{MediaType: msg.MediaType, TargetID: msg.TargetID, Saved: saved, Hidden: msg.Hidden}))
+}
+
+// hidden returns a copy of the IDs username has hidden, which subreddit actors
+// can read while the engine goes on changing the original.
+func (re *RedditEngine) hidden(username string) map[string]bool {
+	if user, exists := re.users[username]; exists && len(user.Hidden) > 0 {
+		return maps.Clone(user.Hidden)
+	}
+	return nil
+}
+
+// getSaved lists one page of the user's saved posts and comments. Each is
+// rendered by its subreddit, asked in parallel by a savedCollector, which replies.
+func (re *RedditEngine) getSaved(msg *GetSaved, context actor.Context) {
+	user, exists := re.users[msg.Username]
+	if !exists {
+		debugf("No such user with username %s\n", msg.Username)
+		context.Respond(failure(CodeUserNotFound, "No such username"))
+		return
+	}
+
+	saved := make([]*SavedItem, len(user.Saved))
+	for i, item := range user.Saved { // Newest first
+		saved[len(saved)-1-i] = item
+	}
+	start, end, before, after, ok := paginate(len(saved), func(i int) sortKey {
+		return saved[i].sortKey()
+	}, fmt.Sprintf("saved/%s", user.Username), msg.Page)
+	if !ok {
+		context.Respond(failure(CodeInvalidCursor, "Invalid cursor"))
+		return
+	}
+
+	requests := make(map[*actor.PID]*getSavedItems)
+	for _, item := range saved[start:end] {
+		subreddit, rejected := re.targetSubreddit(item.MediaType, item.TargetID)
+		if rejected != nil {
+			continue
+		}
+		pid := subreddit.PID
+		if requests[pid] == nil {
+			requests[pid] = &getSavedItems{}
+		}
+		if item.MediaType == "Post" {
+			requests[pid].PostIDs = append(requests[pid].PostIDs, item.TargetID)
+		} else {
+			requests[pid].CommentIDs = append(requests[pid].CommentIDs, item.TargetID)
+		}
+	}
+	collector := &savedCollector{
+		list:     &SavedList{Username: user.Username, Items: []SavedView{}, Before: before, After: after},
+		saved:    saved[start:end],
+		requests: requests,
+		replyTo:  context.Sender(),
+		timeout:  re.feedTimeout,
+	}
+	context.Spawn(actor.PropsFromProducer(func() actor.Actor { return collector }))
+}
+
+// savedCollector asks each subreddit holding part of a page of saved items to
+// render them, puts the replies in save order, sends the SavedList to replyTo
+// and stops. Items whose subreddit has not replied within timeout are shown
+// as deleted.
+type savedCollector struct {
+	list     *SavedList
+	saved    []*SavedItem
+	requests map[*actor.PID]*getSavedItems
+	replyTo  *actor.PID
+	timeout  time.Duration
+
+	pending int
+	views   map[string]SavedView
+}
+
+func (sc *savedCollector) Receive(context actor.Context) {
+	switch msg := context.Message().(type) {
+	case *actor.Started:
+		sc.views = make(map[string]SavedView)
+		sc.pending = len(sc.requests)
+		if sc.pending == 0 {
+			sc.finish(context)
+			return
+		}
+		for pid, request := range sc.requests {
+			context.Request(pid, request)
+		}
+		context.SetReceiveTimeout(sc.timeout)
+	case *savedItems:
+		for id, view := range msg.Items {
+			sc.views[id] = view
+		}
+		sc.pending--
+		if sc.pending == 0 {
+			sc.finish(context)
+		}
+	case *actor.ReceiveTimeout:
+		warnf("Saved items of %s timed out waiting on %d subreddits\n", sc.list.Username, sc.pending)
+		sc.finish(context)
+	}
+}
+
+func (sc *savedCollector) finish(context actor.Context) {
+	context.CancelReceiveTimeout()
+	for _, item := range sc.saved {
+		view, found := sc.views[item.TargetID]
+		if !found {
+			view = SavedView{ID: item.TargetID, Author: deletedPlaceholder, Title: deletedPlaceholder, Content: deletedPlaceholder, Deleted: true}
+		}
+		view.MediaType, view.SavedAt = item.MediaType, item.SavedAt
+		sc.list.Items = append(sc.list.Items, view)
+	}
+	debugf("Saved items fetched for %s: %d items\n", sc.list.Username, len(sc.list.Items))
+	context.Send(sc.replyTo, success(sc.list))
+	context.Stop(context.Self())
+}
+
+// getSavedItems renders the posts and comments a savedCollector asks for.
+// Deleted and removed ones keep their place but show "[deleted]".
+func (sa *SubredditActor) getSavedItems(msg *getSavedItems, context actor.Context) {
+	items := make(map[string]SavedView, len(msg.PostIDs)+len(msg.CommentIDs))
+	for _, id := range msg.PostIDs {
+		post, exists := sa.posts[id]
+		if !exists {
+			continue
+		}
+		view := SavedView{
+			ID:        post.ID,
+			Subreddit: sa.subreddit.Name,
+			Author:    post.Author,
+			Title:     post.Title,
+			Content:   post.Content,
+			Score:     post.Score(),
+			CreatedAt: post.CreatedAt,
+			EditedAt:  post.EditedAt,
+		}
+		if post.Deleted || post.Removal != nil {
+			view.Author, view.Title, view.Content, view.Deleted = deletedPlaceholder, deletedPlaceholder, deletedPlaceholder, true
+		}
+		items[id] = view
+	}
+	for _, id := range msg.CommentIDs {
+		comment, exists := sa.comments[id]
+		if !exists {
+			continue
+		}
+		view := SavedView{
+			ID:        comment.ID,
+			Subreddit: sa.subreddit.Name,
+			Author:    comment.Author,
+			Title:     comment.Post.Title,
+			PostID:    comment.Post.ID,
+			Content:   comment.Content,
+			Score:     comment.Score(),
+			CreatedAt: comment.CreatedAt,
+			EditedAt:  comment.EditedAt,
+		}
+		if comment.Deleted || comment.Removal != nil {
+			view.Author, view.Content, view.Deleted = deletedPlaceholder, deletedPlaceholder, true
+		}
+		items[id] = view
+	}
+	context.Respond(&savedItems{Items: items})
+}
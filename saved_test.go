@@ -0,0 +1,104 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func feedIDs(feed *Feed) []string {
+	var ids []string
+	for _, post := range feed.Posts {
+		ids = append(ids, post.ID)
+	}
+	return ids
+}
+
+func TestHidden(t *testing.T) {
+	e := startCommunity(t)
+	first := e.request(&CreatePost{Title: "First", Content: "Post", Author: "alice", Subreddit: "golang"}).Data.(*FeedItem)
+	second := e.request(&CreatePost{Title: "Second", Content: "Post", Author: "alice", Subreddit: "golang"}).Data.(*FeedItem)
+	comment := e.request(&CreateComment{Content: "Hi", Author: "carol", PostID: first.ID}).Data.(*CommentNode)
+	e.request(&CreateComment{Content: "Hello", Author: "carol", PostID: first.ID, ParentID: comment.ID})
+
+	result := e.request(&SetHidden{Username: "bob", MediaType: "Post", TargetID: second.ID, Hidden: true}).Data.(*SaveResult)
+	if !result.Hidden || result.Saved {
+		t.Errorf("hiding replied %+v, want hidden and not saved", result)
+	}
+	feed := e.request(&GetUserFeed{Username: "bob", Sort: "new"}).Data.(*Feed)
+	if got := feedIDs(feed); !reflect.DeepEqual(got, []string{first.ID}) {
+		t.Errorf("bob's feed = %v, want only %s", got, first.ID)
+	}
+	feed = e.request(&GetUserFeed{Username: "carol", Sort: "new"}).Data.(*Feed)
+	if got := feedIDs(feed); !reflect.DeepEqual(got, []string{second.ID, first.ID}) {
+		t.Errorf("carol's feed = %v, want both posts", got)
+	}
+
+	// A hidden comment is left out with its replies, for its hider only.
+	e.request(&SetHidden{Username: "bob", MediaType: "Comment", TargetID: comment.ID, Hidden: true})
+	if tree := e.request(&GetPostComments{PostID: first.ID, Viewer: "bob"}).Data.(*CommentTree); len(tree.Comments) != 0 {
+		t.Errorf("bob sees %d comments, want the hidden one left out", len(tree.Comments))
+	}
+	if tree := e.request(&GetPostComments{PostID: first.ID, Viewer: "carol"}).Data.(*CommentTree); len(tree.Comments) != 1 {
+		t.Errorf("carol sees %d comments, want 1", len(tree.Comments))
+	}
+
+	e.request(&SetHidden{Username: "bob", MediaType: "Post", TargetID: second.ID, Hidden: false})
+	feed = e.request(&GetUserFeed{Username: "bob", Sort: "new"}).Data.(*Feed)
+	if got := feedIDs(feed); !reflect.DeepEqual(got, []string{second.ID, first.ID}) {
+		t.Errorf("bob's feed after unhiding = %v, want both posts", got)
+	}
+
+	e.refuse(&SetHidden{Username: "bob", MediaType: "Post", TargetID: "nobody_post_9", Hidden: true}, CodePostNotFound)
+	e.refuse(&SetHidden{Username: "bob", MediaType: "Subreddit", TargetID: "golang", Hidden: true}, CodeInvalidRequest)
+}
+
+func TestSaved(t *testing.T) {
+	e := startCommunity(t)
+	var saved []string // Newest first, as the list shows them.
+	for i := 0; i < 4; i++ {
+		post := e.request(&CreatePost{Title: "Post", Content: "Text", Author: "alice", Subreddit: "golang"}).Data.(*FeedItem)
+		e.request(&SetSaved{Username: "bob", MediaType: "Post", TargetID: post.ID, Saved: true})
+		saved = append([]string{post.ID}, saved...)
+	}
+	comment := e.request(&CreateComment{Content: "Hi", Author: "carol", PostID: saved[0]}).Data.(*CommentNode)
+	e.request(&SetSaved{Username: "bob", MediaType: "Comment", TargetID: comment.ID, Saved: true})
+	e.request(&SetSaved{Username: "bob", MediaType: "Comment", TargetID: comment.ID, Saved: true}) // Saving again adds nothing.
+	saved = append([]string{comment.ID}, saved...)
+
+	var got []string
+	page := Page{Limit: 2}
+	for pages := 0; ; pages++ {
+		if pages == 3 {
+			t.Fatal("more than 3 pages of 5 items")
+		}
+		list := e.request(&GetSaved{Username: "bob", Page: page}).Data.(*SavedList)
+		for _, item := range list.Items {
+			got = append(got, item.ID)
+		}
+		if list.After == "" {
+			break
+		}
+		page.After = list.After
+	}
+	if !reflect.DeepEqual(got, saved) {
+		t.Fatalf("saved pages = %v, want %v", got, saved)
+	}
+
+	// Items show as they are now.
+	e.request(&EditComment{Author: "carol", CommentID: comment.ID, Content: "Hello"})
+	e.request(&DeletePost{Author: "alice", PostID: saved[2]})
+	e.request(&SetSaved{Username: "bob", MediaType: "Post", TargetID: saved[1], Saved: false})
+	list := e.request(&GetSaved{Username: "bob"}).Data.(*SavedList)
+	if len(list.Items) != 4 {
+		t.Fatalf("%d items saved after unsaving one, want 4", len(list.Items))
+	}
+	if item := list.Items[0]; item.MediaType != "Comment" || item.Content != "Hello" || item.PostID != saved[1] || item.EditedAt == nil {
+		t.Errorf("saved comment = %+v, want its edited content on %s", item, saved[1])
+	}
+	if item := list.Items[1]; item.ID != saved[2] || !item.Deleted || item.Title != deletedPlaceholder {
+		t.Errorf("saved deleted post = %+v, want %s as a placeholder", item, saved[2])
+	}
+
+	e.refuse(&GetSaved{Username: "bob", Page: Page{After: "not a cursor!"}}, CodeInvalidCursor)
+	e.refuse(&SetSaved{Username: "bob", MediaType: "Comment", TargetID: "nobody_comment_9", Saved: true}, CodeCommentNotFound)
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/asynkron/protoactor-go/actor"
+)
+
+const snippetLength = 200
+
+// BM25 tuning: k1 caps how much repeating a term helps, b how much long documents are penalised.
+const (
+	bm25K1      = 1.2
+	bm25B       = 0.75
+	titleWeight = 2 // A term in a title counts as this many in the body.
+)
+
+type Search struct {
+	Query string // Free text plus optional subreddit:, author: and type: filters.
+	Sort  string // "relevance", "score" or "new"; defaults to "relevance".
+	Page
+}
+
+// Messages sent by subreddit actors to keep the engine's search index current.
+// They are not journaled: each subreddit re-sends its documents when it starts.
+
+// indexDocument adds a document to the index or replaces it.
+type indexDocument struct {
+	Doc searchDocument
+}
+
+// unindexDocument drops a deleted or removed document.
+type unindexDocument struct {
+	Type string
+	ID   string
+}
+
+// documentScored updates the score of an indexed document after a vote.
+type documentScored struct {
+	Type  string
+	ID    string
+	Score int
+}
+
+// searchDocument is one post, comment or subreddit as the index sees it.
+type searchDocument struct {
+	Type      string // "post", "comment" or "subreddit".
+	ID        string
+	Title     string
+	Text      string
+	Subreddit string
+	Author    string
+	PostID    string // For comments, the post they are on.
+	Domain    string // For link posts, the domain linked to.
+	Score     int
+	CreatedAt time.Time
+}
+
+func (d *searchDocument) key() string {
+	return d.Type + ":" + d.ID
+}
+
+func postDocument(post *Post) searchDocument {
+	return searchDocument{
+		Type:      "post",
+		ID:        post.ID,
+		Title:     post.Title,
+		Text:      post.Content,
+		Subreddit: post.Subreddit.Name,
+		Author:    post.Author,
+		Domain:    post.Domain,
+		Score:     post.Score(),
+		CreatedAt: post.CreatedAt,
+	}
+}
+
+func commentDocument(comment *Comment) searchDocument {
+	return searchDocument{
+		Type:      "comment",
+		ID:        comment.ID,
+		Text:      comment.Content,
+		Subreddit: comment.Post.Subreddit.Name,
+		Author:    comment.Author,
+		PostID:    comment.Post.ID,
+		Score:     comment.Score(),
+		CreatedAt: comment.CreatedAt,
+	}
+}
+
+// SearchHit is one result of a search.
+type SearchHit struct {
+	Type      string    `json:"type"`
+	ID        string    `json:"id"`
+	Title     string    `json:"title,omitempty"`
+	Snippet   string    `json:"snippet,omitempty"`
+	Subreddit string    `json:"subreddit"`
+	Author    string    `json:"author,omitempty"`
+	PostID    string    `json:"post_id,omitempty"`
+	Score     int       `json:"score"`
+	Relevance float64   `json:"relevance"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SearchResults is the engine's reply to Search.
+type SearchResults struct {
+	Query  string      `json:"query"`
+	Sort   string      `json:"sort"`
+	Hits   []SearchHit `json:"hits"`
+	Before string      `json:"before,omitempty"`
+	After  string      `json:"after,omitempty"`
+}
+
+// indexedDocument is a document with the term counts it was indexed under.
+type indexedDocument struct {
+	searchDocument
+	terms  map[string]int
+	length int
+}
+
+// searchIndex is an in-memory inverted index from terms to the documents containing them.
+type searchIndex struct {
+	docs        map[string]*indexedDocument
+	postings    map[string]map[string]int // Map of term to document key to weighted term count.
+	totalLength int
+}
+
+func newSearchIndex() *searchIndex {
+	return &searchIndex{
+		docs:     make(map[string]*indexedDocument),
+		postings: make(map[string]map[string]int),
+	}
+}
+
+// tokenize lower-cases text and splits it into words.
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func (idx *searchIndex) add(doc searchDocument) {
+	key := doc.key()
+	idx.remove(doc.Type, doc.ID)
+
+	entry := &indexedDocument{searchDocument: doc, terms: make(map[string]int)}
+	for _, term := range tokenize(doc.Title) {
+		entry.terms[term] += titleWeight
+	}
+	for _, term := range tokenize(doc.Text) {
+		entry.terms[term]++
+	}
+	for term, count := range entry.terms {
+		if idx.postings[term] == nil {
+			idx.postings[term] = make(map[string]int)
+		}
+		idx.postings[term][key] = count
+		entry.length += count
+	}
+	idx.docs[key] = entry
+	idx.totalLength += entry.length
+}
+
+func (idx *searchIndex) remove(docType, id string) {
+	key := docType + ":" + id
+	entry, exists := idx.docs[key]
+	if !exists {
+		return
+	}
+	for term := range entry.terms {
+		delete(idx.postings[term], key)
+		if len(idx.postings[term]) == 0 {
+			delete(idx.postings, term)
+		}
+	}
+	idx.totalLength -= entry.length
+	delete(idx.docs, key)
+}
+
+func (idx *searchIndex) setScore(docType, id string, score int) {
+	if entry, exists := idx.docs[docType+":"+id]; exists {
+		entry.Score = score
+	}
+}
+
+// searchQuery is a parsed query string.
+type searchQuery struct {
+	terms   []string
+	filters map[string]string // Map of filter name to the value it must equal.
+}
+
+// searchFilters are the field:value filters a query may use.
+var searchFilters = map[string]func(doc *indexedDocument) string{
+	"subreddit": func(doc *indexedDocument) string { return doc.Subreddit },
+	"author":    func(doc *indexedDocument) string { return doc.Author },
+	"type":      func(doc *indexedDocument) string { return doc.Type },
+	"domain":    func(doc *indexedDocument) string { return doc.Domain },
+}
+
+func parseQuery(q string) (searchQuery, error) {
+	query := searchQuery{filters: make(map[string]string)}
+	for _, field := range strings.Fields(q) {
+		name, value, found := strings.Cut(field, ":")
+		if found {
+			if _, known := searchFilters[strings.ToLower(name)]; known && value != "" {
+				query.filters[strings.ToLower(name)] = value
+				continue
+			}
+		}
+		query.terms = append(query.terms, tokenize(field)...)
+	}
+	if len(query.terms) == 0 && len(query.filters) == 0 {
+		return query, fmt.Errorf("q must contain a search term or filter")
+	}
+	return query, nil
+}
+
+func (q searchQuery) matches(doc *indexedDocument) bool {
+	for name, value := range q.filters {
+		if !strings.EqualFold(searchFilters[name](doc), value) {
+			return false
+		}
+	}
+	return true
+}
+
+// match returns the documents containing every term of the query and passing its
+// filters, with their BM25 relevance. A query of filters alone matches with zero relevance.
+func (idx *searchIndex) match(query searchQuery) map[*indexedDocument]float64 {
+	results := make(map[*indexedDocument]float64)
+	if len(query.terms) == 0 {
+		for _, doc := range idx.docs {
+			if query.matches(doc) {
+				results[doc] = 0
+			}
+		}
+		return results
+	}
+
+	// Walk the rarest term's postings and look the other terms up per document.
+	terms := append([]string(nil), query.terms...)
+	sort.Slice(terms, func(i, j int) bool {
+		return len(idx.postings[terms[i]]) < len(idx.postings[terms[j]])
+	})
+	n := float64(len(idx.docs))
+	avgLength := float64(idx.totalLength) / math.Max(n, 1)
+	for key := range idx.postings[terms[0]] {
+		doc := idx.docs[key]
+		if !query.matches(doc) {
+			continue
+		}
+		relevance := 0.0
+		for _, term := range terms {
+			tf := float64(idx.postings[term][key])
+			if tf == 0 {
+				relevance = -1
+				break
+			}
+			df := float64(len(idx.postings[term]))
+			idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+			norm := bm25K1 * (1 - bm25B + bm25B*float64(doc.length)/avgLength)
+			relevance += idf * tf * (bm25K1 + 1) / (tf + norm)
+		}
+		if relevance >= 0 {
+			results[doc] = relevance
+		}
+	}
+	return results
+}
+
+func validSearchSort(order string) bool {
+	return order == "relevance" || order == "score" || order == "new"
+}
+
+func snippet(text string) string {
+	runes := []rune(text)
+	if len(runes) <= snippetLength {
+		return text
+	}
+	return string(runes[:snippetLength]) + "…"
+}
+
+// search answers a Search from the engine's index, one page at a time.
+func (re *RedditEngine) search(msg *Search, context actor.Context) {
+	order := msg.Sort
+	if order == "" {
+		order = "relevance"
+	}
+	if !validSearchSort(order) {
+		context.Respond(failure(CodeInvalidRequest, "sort must be relevance, score or new"))
+		return
+	}
+	query, err := parseQuery(msg.Query)
+	if err != nil {
+		context.Respond(failure(CodeInvalidRequest, "%v", err))
+		return
+	}
+
+	matched := re.index.match(query)
+	hits := make([]SearchHit, 0, len(matched))
+	for doc, relevance := range matched {
+		hits = append(hits, SearchHit{
+			Type:      doc.Type,
+			ID:        doc.ID,
+			Title:     doc.Title,
+			Snippet:   snippet(doc.Text),
+			Subreddit: doc.Subreddit,
+			Author:    doc.Author,
+			PostID:    doc.PostID,
+			Score:     doc.Score,
+			Relevance: relevance,
+			CreatedAt: doc.CreatedAt,
+		})
+	}
+	keyAt := func(i int) sortKey {
+		key := sortKey{CreatedAt: hits[i].CreatedAt.UnixNano(), ID: hits[i].Type + ":" + hits[i].ID}
+		switch order {
+		case "relevance":
+			key.Rank = hits[i].Relevance
+		case "score":
+			key.Rank = float64(hits[i].Score)
+		}
+		return key
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		return keyAt(i).before(keyAt(j))
+	})
+
+	scope := fmt.Sprintf("search/%s/%s", msg.Query, order)
+	start, end, before, after, ok := paginate(len(hits), keyAt, scope, msg.Page)
+	if !ok {
+		context.Respond(failure(CodeInvalidCursor, "Invalid cursor"))
+		return
+	}
+	context.Respond(success(&SearchResults{
+		Query:  msg.Query,
+		Sort:   order,
+		Hits:   hits[start:end],
+		Before: before,
+		After:  after,
+	}))
+}
+
+// publishIndex sends every live post and comment of the subreddit to the engine's index.
+func (sa *SubredditActor) publishIndex(context actor.Context) {
+	for _, post := range sa.posts {
+		if post.Removal == nil && !post.Deleted {
+			context.Send(context.Parent(), &indexDocument{Doc: postDocument(post)})
+		}
+	}
+	for _, comment := range sa.comments {
+		if comment.Removal == nil && !comment.Deleted {
+			context.Send(context.Parent(), &indexDocument{Doc: commentDocument(comment)})
+		}
+	}
+}
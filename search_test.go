@@ -0,0 +1,105 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		q           string
+		wantTerms   []string
+		wantFilters map[string]string
+		wantErr     bool
+	}{
+		{q: "Go generics", wantTerms: []string{"go", "generics"}, wantFilters: map[string]string{}},
+		{q: "subreddit:golang go", wantTerms: []string{"go"}, wantFilters: map[string]string{"subreddit": "golang"}},
+		{q: "Author:Bob TYPE:comment", wantFilters: map[string]string{"author": "Bob", "type": "comment"}},
+		{q: "domain:go.dev", wantFilters: map[string]string{"domain": "go.dev"}},
+		{q: "flair:news", wantTerms: []string{"flair", "news"}, wantFilters: map[string]string{}},
+		{q: "subreddit: go", wantTerms: []string{"subreddit", "go"}, wantFilters: map[string]string{}},
+		{q: "", wantErr: true},
+		{q: "!!! ...", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.q, func(t *testing.T) {
+			query, err := parseQuery(tt.q)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseQuery(%q) error = %v, want error %t", tt.q, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(query.terms, tt.wantTerms) || !reflect.DeepEqual(query.filters, tt.wantFilters) {
+				t.Errorf("parseQuery(%q) = %q %v, want %q %v", tt.q, query.terms, query.filters, tt.wantTerms, tt.wantFilters)
+			}
+		})
+	}
+}
+
+func TestSearchFilters(t *testing.T) {
+	idx := newSearchIndex()
+	idx.add(searchDocument{Type: "post", ID: "generics", Title: "Generics in Go", Text: "Type parameters at last", Subreddit: "golang", Author: "alice"})
+	idx.add(searchDocument{Type: "post", ID: "versus", Title: "Go vs Rust", Text: "A comparison", Subreddit: "rust", Author: "bob", Domain: "go.dev"})
+	idx.add(searchDocument{Type: "comment", ID: "reply", Text: "Generics are great", Subreddit: "golang", Author: "bob", PostID: "generics"})
+	idx.add(searchDocument{Type: "post", ID: "gone", Title: "Go modules", Subreddit: "golang", Author: "carol"})
+	idx.remove("post", "gone")
+
+	tests := []struct {
+		q    string
+		want []string
+	}{
+		{q: "go", want: []string{"generics", "versus"}},
+		{q: "go generics", want: []string{"generics"}},
+		{q: "go subreddit:golang", want: []string{"generics"}},
+		{q: "go subreddit:GoLang", want: []string{"generics"}},
+		{q: "generics author:bob", want: []string{"reply"}},
+		{q: "generics type:post", want: []string{"generics"}},
+		{q: "subreddit:golang type:comment", want: []string{"reply"}},
+		{q: "domain:GO.DEV", want: []string{"versus"}},
+		{q: "go domain:example.com"},
+		{q: "author:carol"},
+		{q: "modules"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.q, func(t *testing.T) {
+			query, err := parseQuery(tt.q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for doc := range idx.match(query) {
+				got = append(got, doc.ID)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("match(%q) = %v, want %v", tt.q, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearch(t *testing.T) {
+	e := startCommunity(t)
+	post := e.request(&CreatePost{Title: "Generics in Go", Content: "At last", Author: "alice", Subreddit: "golang"}).Data.(*FeedItem)
+	e.request(&CreateComment{Content: "Generics are great", Author: "bob", PostID: post.ID})
+
+	results := e.request(&Search{Query: "generics type:post"}).Data.(*SearchResults)
+	if len(results.Hits) != 1 || results.Hits[0].ID != post.ID || results.Hits[0].Subreddit != "golang" {
+		t.Fatalf("hits = %+v, want only %s", results.Hits, post.ID)
+	}
+	results = e.request(&Search{Query: "generics", Sort: "new", Page: Page{Limit: 1}}).Data.(*SearchResults)
+	if len(results.Hits) != 1 || results.Hits[0].Type != "comment" || results.After == "" {
+		t.Errorf("first page by new = %+v after %q, want the comment and a next page", results.Hits, results.After)
+	}
+
+	e.request(&DeletePost{Author: "alice", PostID: post.ID})
+	results = e.request(&Search{Query: "generics type:post"}).Data.(*SearchResults)
+	if len(results.Hits) != 0 {
+		t.Errorf("hits after deleting the post = %+v, want none", results.Hits)
+	}
+
+	e.refuse(&Search{Query: "generics", Sort: "best"}, CodeInvalidRequest)
+	e.refuse(&Search{Query: "   "}, CodeInvalidRequest)
+}
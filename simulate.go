@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"RedditAPI/simulator"
+	"github.com/asynkron/protoactor-go/actor"
+)
+
+// engineDriver lets the simulator talk to the engine actor directly, skipping
+// HTTP, authentication and password hashing.
+type engineDriver struct {
+	system  *actor.ActorSystem
+	timeout time.Duration
+}
+
+// request sends msg to the engine actor and turns a failed Result into an error.
+func (d *engineDriver) request(msg interface{}) (*Result, error) {
+	result := engineResult(d.system.Root.RequestFuture(engineActor, msg, d.timeout))
+	if !result.OK() {
+		return nil, fmt.Errorf("%s: %s", result.Code, result.Message)
+	}
+	return result, nil
+}
+
+func (d *engineDriver) Register(username, password string) error {
+	_, err := d.request(&RegisterUser{Username: username, PasswordHash: "simulated"})
+	return err
+}
+
+func (d *engineDriver) CreateSubreddit(username, name, description string) error {
+	_, err := d.request(&CreateSubreddit{Name: name, Description: description, Creator: username})
+	return err
+}
+
+func (d *engineDriver) JoinSubreddit(username, subreddit string) error {
+	_, err := d.request(&JoinSubreddit{Username: username, Subreddit: subreddit})
+	return err
+}
+
+func (d *engineDriver) CreatePost(username, subreddit, title, content string) (string, error) {
+	result, err := d.request(&CreatePost{Title: title, Content: content, Author: username, Subreddit: subreddit})
+	if err != nil {
+		return "", err
+	}
+	return result.Data.(*FeedItem).ID, nil
+}
+
+func (d *engineDriver) CreateComment(username, postID, parentID, content string) (string, error) {
+	result, err := d.request(&CreateComment{Content: content, Author: username, PostID: postID, ParentID: parentID})
+	if err != nil {
+		return "", err
+	}
+	return result.Data.(*CommentNode).ID, nil
+}
+
+func (d *engineDriver) Vote(username, postID string, up bool) error {
+	var vote interface{} = &Downvote{UserID: username, MediaType: "Post", TargetID: postID}
+	if up {
+		vote = &Upvote{UserID: username, MediaType: "Post", TargetID: postID}
+	}
+	_, err := d.request(vote)
+	return err
+}
+
+func (d *engineDriver) SendMessage(from, to, content string) error {
+	_, err := d.request(&SendDirectMessage{From: from, To: to, Content: content})
+	return err
+}
+
+func (d *engineDriver) Feed(username string) ([]simulator.Post, error) {
+	result, err := d.request(&GetUserFeed{Username: username, Sort: "new"})
+	if err != nil {
+		return nil, err
+	}
+	feed := result.Data.(*Feed)
+	posts := make([]simulator.Post, len(feed.Posts))
+	for i, item := range feed.Posts {
+		posts[i] = simulator.Post{ID: item.ID, Title: item.Title, Subreddit: item.Subreddit, Author: item.Author}
+	}
+	return posts, nil
+}
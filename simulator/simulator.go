@@ -0,0 +1,234 @@
+// Package simulator loads a Reddit clone engine with simulated users. Each user
+// is an actor that alternates between online sessions, in which it reads its
+// feed, posts, comments, replies in its own threads, votes, reposts and sends
+// direct messages, and offline
+// periods. Subreddit membership follows a Zipf distribution, and users post to
+// their more popular subreddits more often.
+//
+// The simulator reaches the engine through a Driver, so the same workload can
+// run over HTTP or in the server's own process.
+package simulator
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/asynkron/protoactor-go/actor"
+)
+
+// Post is a post as a simulated user sees it in its feed.
+type Post struct {
+	ID        string
+	Title     string
+	Subreddit string
+	Author    string
+}
+
+// Driver performs requests against the engine on behalf of simulated users.
+// Implementations must be safe for concurrent use.
+type Driver interface {
+	Register(username, password string) error
+	CreateSubreddit(username, name, description string) error
+	JoinSubreddit(username, subreddit string) error
+	CreatePost(username, subreddit, title, content string) (postID string, err error)
+	CreateComment(username, postID, parentID, content string) (commentID string, err error) // parentID is empty for a top-level comment.
+	Vote(username, postID string, up bool) error
+	SendMessage(from, to, content string) error
+	Feed(username string) ([]Post, error)
+}
+
+// Config shapes a simulation run.
+type Config struct {
+	Users       int
+	Subreddits  int
+	Duration    time.Duration // How long users stay active after setup.
+	Zipf        float64       // Zipf exponent of subreddit popularity; must be greater than 1.
+	MaxJoined   int           // Most subreddits a single user joins.
+	Think       time.Duration // Mean pause between a user's actions while online.
+	Session     time.Duration // Mean length of an online period.
+	Offline     time.Duration // Mean length of an offline period.
+	Setup       int           // Number of setup requests in flight at once.
+	ReportEvery time.Duration // Interval between progress lines; zero disables them.
+	Seed        int64
+}
+
+// DefaultConfig returns a small run suitable for a laptop.
+func DefaultConfig() Config {
+	return Config{
+		Users:       200,
+		Subreddits:  20,
+		Duration:    30 * time.Second,
+		Zipf:        1.2,
+		MaxJoined:   5,
+		Think:       200 * time.Millisecond,
+		Session:     10 * time.Second,
+		Offline:     5 * time.Second,
+		Setup:       16,
+		ReportEvery: 5 * time.Second,
+		Seed:        1,
+	}
+}
+
+// RegisterFlags defines a flag for each field of c on fs, each name starting with prefix.
+func (c *Config) RegisterFlags(fs *flag.FlagSet, prefix string) {
+	fs.IntVar(&c.Users, prefix+"users", c.Users, "number of simulated users")
+	fs.IntVar(&c.Subreddits, prefix+"subreddits", c.Subreddits, "number of subreddits")
+	fs.DurationVar(&c.Duration, prefix+"duration", c.Duration, "how long users stay active after setup")
+	fs.Float64Var(&c.Zipf, prefix+"zipf", c.Zipf, "Zipf exponent of subreddit popularity (> 1)")
+	fs.IntVar(&c.MaxJoined, prefix+"max-joined", c.MaxJoined, "most subreddits a user joins")
+	fs.DurationVar(&c.Think, prefix+"think", c.Think, "mean pause between a user's actions while online")
+	fs.DurationVar(&c.Session, prefix+"session", c.Session, "mean length of an online period")
+	fs.DurationVar(&c.Offline, prefix+"offline", c.Offline, "mean length of an offline period")
+	fs.IntVar(&c.Setup, prefix+"setup-concurrency", c.Setup, "number of setup requests in flight at once")
+	fs.DurationVar(&c.ReportEvery, prefix+"report-every", c.ReportEvery, "interval between progress lines (0 disables)")
+	fs.Int64Var(&c.Seed, prefix+"seed", c.Seed, "random seed")
+}
+
+func (c *Config) validate() error {
+	switch {
+	case c.Users < 2:
+		return fmt.Errorf("at least 2 users are needed")
+	case c.Subreddits < 1:
+		return fmt.Errorf("at least 1 subreddit is needed")
+	case c.Zipf <= 1:
+		return fmt.Errorf("the Zipf exponent must be greater than 1")
+	case c.MaxJoined < 1:
+		return fmt.Errorf("users must be able to join at least 1 subreddit")
+	case c.Think <= 0 || c.Session <= 0 || c.Offline <= 0:
+		return fmt.Errorf("think, session and offline times must be positive")
+	case c.Setup < 1:
+		return fmt.Errorf("setup concurrency must be at least 1")
+	}
+	return nil
+}
+
+// Run sets up users and subreddits through driver, lets the users act for
+// cfg.Duration, and returns what they did. Progress lines go to out.
+func Run(cfg Config, driver Driver, out io.Writer) (*Report, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	rng := rand.New(rand.NewSource(cfg.Seed))
+	system := actor.NewActorSystem()
+	defer system.Shutdown()
+	stats := system.Root.Spawn(actor.PropsFromProducer(newStatsActor))
+
+	usernames := make([]string, cfg.Users)
+	for i := range usernames {
+		usernames[i] = fmt.Sprintf("sim_user_%d", i)
+	}
+	subreddits := make([]string, cfg.Subreddits)
+	for i := range subreddits {
+		subreddits[i] = fmt.Sprintf("sim_sub_%d", i)
+	}
+	// popularity[i] is the relative weight of subreddits[i], which is ranked i+1.
+	popularity := make([]float64, cfg.Subreddits)
+	for i := range popularity {
+		popularity[i] = 1 / math.Pow(float64(i+1), cfg.Zipf)
+	}
+
+	start := time.Now()
+	fmt.Fprintf(out, "Setting up %d users and %d subreddits\n", cfg.Users, cfg.Subreddits)
+	setup := func(n int, request func(i int) (string, error)) {
+		limit := make(chan struct{}, cfg.Setup)
+		var wg sync.WaitGroup
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			limit <- struct{}{}
+			go func(i int) {
+				defer wg.Done()
+				defer func() { <-limit }()
+				began := time.Now()
+				action, err := request(i)
+				system.Root.Send(stats, &sample{Action: action, Setup: true, Latency: time.Since(began), Failed: err != nil})
+			}(i)
+		}
+		wg.Wait()
+	}
+	setup(cfg.Users, func(i int) (string, error) {
+		return "register", driver.Register(usernames[i], "password-"+usernames[i])
+	})
+	setup(cfg.Subreddits, func(i int) (string, error) {
+		owner := usernames[i%cfg.Users]
+		return "create_subreddit", driver.CreateSubreddit(owner, subreddits[i], "Simulated subreddit "+subreddits[i])
+	})
+
+	// Each user joins up to MaxJoined subreddits drawn by popularity, so a few
+	// subreddits gather most members.
+	zipf := rand.NewZipf(rng, cfg.Zipf, 1, uint64(cfg.Subreddits-1))
+	joined := make([][]int, cfg.Users)
+	var joins [][2]int
+	for u := range joined {
+		seen := make(map[int]bool)
+		for want := 1 + rng.Intn(cfg.MaxJoined); len(seen) < want && len(seen) < cfg.Subreddits; {
+			rank := int(zipf.Uint64())
+			if !seen[rank] {
+				seen[rank] = true
+				joined[u] = append(joined[u], rank)
+				joins = append(joins, [2]int{u, rank})
+			}
+		}
+	}
+	setup(len(joins), func(i int) (string, error) {
+		return "join", driver.JoinSubreddit(usernames[joins[i][0]], subreddits[joins[i][1]])
+	})
+	fmt.Fprintf(out, "Setup finished in %s (%d memberships)\n", time.Since(start).Round(time.Millisecond), len(joins))
+
+	// Let the users loose and stop them once cfg.Duration has passed.
+	began := time.Now()
+	deadline := began.Add(cfg.Duration)
+	var done sync.WaitGroup
+	for u, username := range usernames {
+		member := &simUser{
+			name:     username,
+			peers:    usernames,
+			driver:   driver,
+			stats:    stats,
+			cfg:      cfg,
+			deadline: deadline,
+			done:     &done,
+			rng:      rand.New(rand.NewSource(rng.Int63())),
+		}
+		for _, rank := range joined[u] {
+			member.subreddits = append(member.subreddits, subreddits[rank])
+			member.weights = append(member.weights, popularity[rank])
+		}
+		done.Add(1)
+		system.Root.Spawn(actor.PropsFromProducer(func() actor.Actor { return member }))
+	}
+
+	stopProgress := make(chan struct{})
+	if cfg.ReportEvery > 0 {
+		go func() {
+			ticker := time.NewTicker(cfg.ReportEvery)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-stopProgress:
+					return
+				case <-ticker.C:
+					if report, err := collect(system, stats, time.Since(began)); err == nil {
+						report.printProgress(out)
+					}
+				}
+			}
+		}()
+	}
+	done.Wait()
+	close(stopProgress)
+
+	return collect(system, stats, time.Since(began))
+}
+
+func collect(system *actor.ActorSystem, stats *actor.PID, elapsed time.Duration) (*Report, error) {
+	reply, err := system.Root.RequestFuture(stats, &reportRequest{Elapsed: elapsed}, 5*time.Second).Result()
+	if err != nil {
+		return nil, fmt.Errorf("collecting statistics: %w", err)
+	}
+	return reply.(*Report), nil
+}
@@ -0,0 +1,160 @@
+package simulator
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/asynkron/protoactor-go/actor"
+)
+
+// sample is one timed request, sent to the stats actor by the user that made it.
+type sample struct {
+	Action  string
+	Setup   bool // Made while setting up users, subreddits and memberships.
+	Latency time.Duration
+	Failed  bool
+}
+
+// session counts a user going online or offline.
+type session struct {
+	Online bool
+}
+
+// reportRequest asks the stats actor for a Report covering elapsed activity time.
+type reportRequest struct {
+	Elapsed time.Duration
+}
+
+// ActionStats summarises the requests of one kind.
+type ActionStats struct {
+	Count     int
+	Errors    int
+	latencies []time.Duration // Sorted when the report is built.
+}
+
+// Percentile returns the latency below which fraction p of requests completed.
+func (a *ActionStats) Percentile(p float64) time.Duration {
+	if len(a.latencies) == 0 {
+		return 0
+	}
+	return a.latencies[int(p*float64(len(a.latencies)-1))]
+}
+
+// Report is what a simulation run did.
+type Report struct {
+	Elapsed  time.Duration           // Activity time the report covers, after setup.
+	Setup    map[string]*ActionStats // Requests made during setup, by action.
+	Actions  map[string]*ActionStats // Requests made by active users, by action.
+	Sessions int                     // Times a user came online.
+	Offline  int                     // Times a user went offline.
+}
+
+// Throughput returns the requests per second made by active users.
+func (r *Report) Throughput() float64 {
+	total := 0
+	for _, stats := range r.Actions {
+		total += stats.Count
+	}
+	return float64(total) / r.Elapsed.Seconds()
+}
+
+func (r *Report) printProgress(out io.Writer) {
+	errors := 0
+	for _, stats := range r.Actions {
+		errors += stats.Errors
+	}
+	fmt.Fprintf(out, "%6s  %8.1f req/s  %d errors  %d sessions\n", r.Elapsed.Round(time.Second), r.Throughput(), errors, r.Sessions)
+}
+
+// Print writes the report as tables of per-action counts, error counts and latency percentiles.
+func (r *Report) Print(out io.Writer) {
+	fmt.Fprintf(out, "\nSetup\n")
+	printTable(out, r.Setup, 0)
+	fmt.Fprintf(out, "\nActivity over %s: %.1f req/s, %d sessions started, %d ended\n", r.Elapsed.Round(time.Millisecond), r.Throughput(), r.Sessions, r.Offline)
+	printTable(out, r.Actions, r.Elapsed)
+}
+
+func printTable(out io.Writer, actions map[string]*ActionStats, elapsed time.Duration) {
+	names := make([]string, 0, len(actions))
+	for name := range actions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "action\tcount\terrors\treq/s\tp50\tp95\tp99\tmax\t")
+	for _, name := range names {
+		stats := actions[name]
+		rate := "-"
+		if elapsed > 0 {
+			rate = fmt.Sprintf("%.1f", float64(stats.Count)/elapsed.Seconds())
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%s\t%s\t%s\t%s\t\n", name, stats.Count, stats.Errors, rate,
+			round(stats.Percentile(0.5)), round(stats.Percentile(0.95)), round(stats.Percentile(0.99)), round(stats.Percentile(1)))
+	}
+	w.Flush()
+}
+
+func round(d time.Duration) time.Duration {
+	return d.Round(10 * time.Microsecond)
+}
+
+// statsActor gathers samples from every simulated user, so they never share state.
+type statsActor struct {
+	setup    map[string]*ActionStats
+	actions  map[string]*ActionStats
+	sessions int
+	offline  int
+}
+
+func newStatsActor() actor.Actor {
+	return &statsActor{setup: make(map[string]*ActionStats), actions: make(map[string]*ActionStats)}
+}
+
+func (s *statsActor) Receive(context actor.Context) {
+	switch msg := context.Message().(type) {
+	case *sample:
+		table := s.actions
+		if msg.Setup {
+			table = s.setup
+		}
+		stats, exists := table[msg.Action]
+		if !exists {
+			stats = &ActionStats{}
+			table[msg.Action] = stats
+		}
+		stats.Count++
+		if msg.Failed {
+			stats.Errors++
+		}
+		stats.latencies = append(stats.latencies, msg.Latency)
+	case *session:
+		if msg.Online {
+			s.sessions++
+		} else {
+			s.offline++
+		}
+	case *reportRequest:
+		context.Respond(&Report{
+			Elapsed:  msg.Elapsed,
+			Setup:    snapshot(s.setup),
+			Actions:  snapshot(s.actions),
+			Sessions: s.sessions,
+			Offline:  s.offline,
+		})
+	}
+}
+
+// snapshot copies a table with its latencies sorted, leaving the actor's own copy free to grow.
+func snapshot(table map[string]*ActionStats) map[string]*ActionStats {
+	copied := make(map[string]*ActionStats, len(table))
+	for name, stats := range table {
+		latencies := append([]time.Duration(nil), stats.latencies...)
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		copied[name] = &ActionStats{Count: stats.Count, Errors: stats.Errors, latencies: latencies}
+	}
+	return copied
+}
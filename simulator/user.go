@@ -0,0 +1,253 @@
+package simulator
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/asynkron/protoactor-go/actor"
+)
+
+// tick wakes a simulated user to take its next action.
+type tick struct{}
+
+// seenLimit is how many posts from its last feed read a user remembers to comment on, vote on or repost.
+const seenLimit = 25
+
+// threadLimit is how many of its own latest posts and comments a user remembers to reply under.
+const threadLimit = 10
+
+// actionWeights is how often an online user picks each action, out of their sum.
+var actionWeights = []struct {
+	name   string
+	weight int
+}{
+	{"feed", 20},
+	{"post", 15},
+	{"comment", 25},
+	{"reply", 10},
+	{"vote", 30},
+	{"message", 5},
+	{"repost", 5},
+}
+
+var words = strings.Fields(`actor engine feed vote karma thread reply channel goroutine
+	cache index search stream shard replica latency throughput queue mailbox snapshot
+	journal cursor ranking subreddit moderator golang rust python design release bug`)
+
+// simUser is one simulated user. It is woken by ticks spaced by the think time,
+// and spends exponentially distributed periods online and offline.
+type simUser struct {
+	name       string
+	subreddits []string  // Joined subreddits.
+	weights    []float64 // Popularity of each joined subreddit; users post to popular ones more.
+	peers      []string  // Every simulated user, for direct messages.
+	driver     Driver
+	stats      *actor.PID
+	cfg        Config
+	deadline   time.Time
+	done       *sync.WaitGroup
+	rng        *rand.Rand
+
+	online    bool
+	switchAt  time.Time // When the user next goes online or offline.
+	seen      []Post    // Posts from the user's last feed read.
+	threads   []thread  // The user's own latest posts and comments.
+	postCount int
+}
+
+// thread is a post or comment a user wrote. CommentID is empty for a post.
+type thread struct {
+	PostID    string
+	CommentID string
+}
+
+func (u *simUser) Receive(context actor.Context) {
+	switch context.Message().(type) {
+	case *actor.Started:
+		// Start everyone offline for a random part of a period so sessions are staggered.
+		u.switchAt = time.Now().Add(u.exponential(u.cfg.Offline))
+		u.schedule(context)
+	case *tick:
+		if time.Now().After(u.deadline) {
+			u.done.Done()
+			context.Stop(context.Self())
+			return
+		}
+		u.step(context)
+		u.schedule(context)
+	}
+}
+
+// schedule sends the user its next tick after a think time, without blocking the actor.
+func (u *simUser) schedule(context actor.Context) {
+	system, self := context.ActorSystem(), context.Self()
+	time.AfterFunc(u.exponential(u.cfg.Think), func() {
+		system.Root.Send(self, &tick{})
+	})
+}
+
+func (u *simUser) exponential(mean time.Duration) time.Duration {
+	return time.Duration(u.rng.ExpFloat64() * float64(mean))
+}
+
+// step moves the user online or offline when its period is over, and otherwise
+// takes one action if it is online.
+func (u *simUser) step(context actor.Context) {
+	if now := time.Now(); now.After(u.switchAt) {
+		u.online = !u.online
+		context.Send(u.stats, &session{Online: u.online})
+		if u.online {
+			u.switchAt = now.Add(u.exponential(u.cfg.Session))
+			u.do(context, "feed", u.readFeed) // Coming online opens the front page.
+		} else {
+			u.switchAt = now.Add(u.exponential(u.cfg.Offline))
+			u.seen = nil
+		}
+		return
+	}
+	if !u.online {
+		return
+	}
+
+	switch u.pickAction() {
+	case "feed":
+		u.do(context, "feed", u.readFeed)
+	case "post":
+		u.do(context, "post", func() error {
+			u.postCount++
+			title := fmt.Sprintf("%s #%d", u.sentence(3+u.rng.Intn(5)), u.postCount)
+			postID, err := u.driver.CreatePost(u.name, u.pickSubreddit(""), title, u.sentence(10+u.rng.Intn(40)))
+			if err == nil {
+				u.remember(thread{PostID: postID})
+			}
+			return err
+		})
+	case "comment":
+		if post, ok := u.pickSeen(); ok {
+			u.do(context, "comment", func() error {
+				return u.comment(thread{PostID: post.ID})
+			})
+		}
+	case "reply":
+		// A reply continues one of the user's own threads, under its post or comment.
+		if len(u.threads) > 0 {
+			under := u.threads[u.rng.Intn(len(u.threads))]
+			u.do(context, "reply", func() error {
+				return u.comment(under)
+			})
+		}
+	case "vote":
+		if post, ok := u.pickSeen(); ok {
+			u.do(context, "vote", func() error {
+				return u.driver.Vote(u.name, post.ID, u.rng.Float64() < 0.8)
+			})
+		}
+	case "message":
+		peer := u.peers[u.rng.Intn(len(u.peers))]
+		if peer != u.name {
+			u.do(context, "message", func() error {
+				return u.driver.SendMessage(u.name, peer, u.sentence(5+u.rng.Intn(15)))
+			})
+		}
+	case "repost":
+		// A repost copies the title of a post the user has seen into another subreddit it belongs to.
+		if post, ok := u.pickSeen(); ok && len(u.subreddits) > 1 {
+			u.do(context, "repost", func() error {
+				target := u.pickSubreddit(post.Subreddit)
+				_, err := u.driver.CreatePost(u.name, target, post.Title, fmt.Sprintf("Reposted from r/%s, originally by u/%s", post.Subreddit, post.Author))
+				return err
+			})
+		}
+	}
+}
+
+// do times one request and reports it to the stats actor.
+func (u *simUser) do(context actor.Context, action string, request func() error) {
+	began := time.Now()
+	err := request()
+	context.Send(u.stats, &sample{Action: action, Latency: time.Since(began), Failed: err != nil})
+}
+
+// comment writes a comment under a post or comment, and remembers it so the
+// user can come back to it.
+func (u *simUser) comment(under thread) error {
+	commentID, err := u.driver.CreateComment(u.name, under.PostID, under.CommentID, u.sentence(3+u.rng.Intn(20)))
+	if err == nil {
+		u.remember(thread{PostID: under.PostID, CommentID: commentID})
+	}
+	return err
+}
+
+// remember keeps one of the user's own posts or comments, forgetting the oldest past threadLimit.
+func (u *simUser) remember(t thread) {
+	u.threads = append(u.threads, t)
+	if len(u.threads) > threadLimit {
+		u.threads = u.threads[1:]
+	}
+}
+
+func (u *simUser) readFeed() error {
+	posts, err := u.driver.Feed(u.name)
+	if err != nil {
+		return err
+	}
+	if len(posts) > seenLimit {
+		posts = posts[:seenLimit]
+	}
+	u.seen = posts
+	return nil
+}
+
+func (u *simUser) pickAction() string {
+	total := 0
+	for _, action := range actionWeights {
+		total += action.weight
+	}
+	n := u.rng.Intn(total)
+	for _, action := range actionWeights {
+		if n < action.weight {
+			return action.name
+		}
+		n -= action.weight
+	}
+	return actionWeights[0].name
+}
+
+// pickSubreddit picks a joined subreddit other than except, weighted by popularity.
+func (u *simUser) pickSubreddit(except string) string {
+	total := 0.0
+	for i, name := range u.subreddits {
+		if name != except {
+			total += u.weights[i]
+		}
+	}
+	n := u.rng.Float64() * total
+	for i, name := range u.subreddits {
+		if name == except {
+			continue
+		}
+		if n < u.weights[i] {
+			return name
+		}
+		n -= u.weights[i]
+	}
+	return u.subreddits[0]
+}
+
+func (u *simUser) pickSeen() (Post, bool) {
+	if len(u.seen) == 0 {
+		return Post{}, false
+	}
+	return u.seen[u.rng.Intn(len(u.seen))], true
+}
+
+func (u *simUser) sentence(n int) string {
+	picked := make([]string, n)
+	for i := range picked {
+		picked[i] = words[u.rng.Intn(len(words))]
+	}
+	return strings.Join(picked, " ")
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/asynkron/protoactor-go/actor"
+)
+
+// Stream event types.
+const (
+	EventPost         = "post"         // A new post in a subreddit the user has joined.
+	EventReply        = "reply"        // A comment on the user's post or a reply to their comment.
+	EventMessage      = "message"      // A direct message to the user.
+	EventNotification = "notification" // A new notification for the user.
+)
+
+// streamBuffer is how many events a stream may fall behind before it is closed.
+const streamBuffer = 64
+
+// streamWriteTimeout is how long a write to a stream may block before the client is dropped.
+const streamWriteTimeout = 10 * time.Second
+
+// streamHeartbeat is how often an idle stream is sent a comment to keep proxies from closing it.
+const streamHeartbeat = 15 * time.Second
+
+// UserEvent is published on the actor system's event stream for delivery to the
+// live streams of its recipients.
+type UserEvent struct {
+	Recipients map[string]bool // Usernames the event is delivered to.
+	Type       string
+	Data       interface{}
+}
+
+// Reply is the payload of a reply event.
+type Reply struct {
+	CommentID string    `json:"comment_id"`
+	PostID    string    `json:"post_id"`
+	ParentID  string    `json:"parent_id,omitempty"` // Empty for a comment on the post itself.
+	Subreddit string    `json:"subreddit"`
+	Author    string    `json:"author"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// publish hands an event to the event stream. Events are dropped while an actor
+// replays its journal, since they were delivered when first handled.
+func publish(context actor.Context, event *UserEvent) {
+	if _, replaying := context.(replayContext); replaying || len(event.Recipients) == 0 {
+		return
+	}
+	context.ActorSystem().EventStream.Publish(event)
+}
+
+// Handle streaming the acting user's events as server-sent events. The event
+// stream calls the subscription from the publishing actor, so it only ever
+// does a non-blocking send; a client that falls streamBuffer events behind, or
+// stops reading for streamWriteTimeout, is disconnected rather than holding up
+// the engine.
+func StreamHandler(rs *RedditSystem) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username := actingUser(r)
+		controller := http.NewResponseController(w)
+		write := func(format string, args ...interface{}) bool {
+			controller.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+			if _, err := fmt.Fprintf(w, format, args...); err != nil {
+				return false
+			}
+			return controller.Flush() == nil
+		}
+
+		events := make(chan *UserEvent, streamBuffer)
+		overflow := make(chan struct{})
+		var once sync.Once
+		subscription := rs.system.EventStream.SubscribeWithPredicate(func(evt interface{}) {
+			select {
+			case events <- evt.(*UserEvent):
+			default:
+				once.Do(func() { close(overflow) })
+			}
+		}, func(evt interface{}) bool {
+			event, ok := evt.(*UserEvent)
+			return ok && event.Recipients[username]
+		})
+		defer rs.system.EventStream.Unsubscribe(subscription)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		if !write(": connected\n\n") {
+			return
+		}
+		debugf("User %s connected to the event stream\n", username)
+		defer debugf("User %s disconnected from the event stream\n", username)
+
+		heartbeat := time.NewTicker(streamHeartbeat)
+		defer heartbeat.Stop()
+		for id := 1; ; {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-rs.done:
+				return
+			case <-overflow:
+				write("event: overflow\ndata: {}\n\n")
+				warnf("Event stream of user %s fell behind\n", username)
+				return
+			case event := <-events:
+				data, err := json.Marshal(event.Data)
+				if err != nil {
+					errorf("Error encoding %s event: %v\n", event.Type, err)
+					continue
+				}
+				if !write("id: %d\nevent: %s\ndata: %s\n\n", id, event.Type, data) {
+					return
+				}
+				id++
+			case <-heartbeat.C:
+				if !write(": keepalive\n\n") {
+					return
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,463 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/asynkron/protoactor-go/actor"
+)
+
+// GetSubredditPosts asks a subreddit actor for its posts ranked by Sort that
+// fall in one page of a feed. The engine's feed collector merges the replies.
+type GetSubredditPosts struct {
+	Sort   string
+	Since  time.Time // Posts created before Since are left out; zero keeps all.
+	Bounds pageBounds
+	Hidden map[string]bool // IDs of posts the reader has hidden, which are left out.
+}
+
+// rankedPost is a feed item with the key it was ranked by.
+type rankedPost struct {
+	FeedItem
+	Key sortKey
+}
+
+// SubredditPosts is a subreddit actor's reply to GetSubredditPosts.
+type SubredditPosts struct {
+	Posts     []rankedPost
+	HasBefore bool // The subreddit has posts ranked before the page.
+	HasAfter  bool // The subreddit has posts ranked after the page.
+}
+
+// SubredditActor owns one subreddit: its members, posts, comments and votes.
+// The engine spawns one per subreddit and routes messages to it; each keeps
+// its own journal so subreddits recover independently.
+type SubredditActor struct {
+	Persistence
+	subreddit *Subreddit
+	posts     map[string]*Post    // Map of post ID to Post details.
+	comments  map[string]*Comment // Map of comment ID to Comment details.
+}
+
+func NewSubredditActor(name, description, owner string, createdAt time.Time, provider *FileProvider) *SubredditActor {
+	return &SubredditActor{
+		Persistence: Persistence{provider: provider},
+		subreddit: &Subreddit{
+			ID:          name,
+			Name:        name,
+			Description: description,
+			CreatedAt:   createdAt,
+			Members:     make(map[string]time.Time),
+			Owner:       owner,
+			Moderators:  make(map[string]*Moderator),
+			Bans:        make(map[string]*Ban),
+		},
+		posts:    make(map[string]*Post),
+		comments: make(map[string]*Comment),
+	}
+}
+
+// Receive handles incoming messages for the SubredditActor.
+// State-changing messages are journaled before they are handled.
+func (sa *SubredditActor) Receive(context actor.Context) {
+	defer observeMessage("subreddit", context.Message(), time.Now())
+	sa.receive(sa, context)
+}
+
+// events lists the messages that change a subreddit's state.
+func (sa *SubredditActor) events() eventRegistry {
+	return subredditEvents
+}
+
+var subredditEvents = eventRegistry{
+	"JoinSubreddit":    func() interface{} { return &JoinSubreddit{} },
+	"LeaveSubreddit":   func() interface{} { return &LeaveSubreddit{} },
+	"CreatePost":       func() interface{} { return &CreatePost{} },
+	"CreateComment":    func() interface{} { return &CreateComment{} },
+	"crosspostCreated": func() interface{} { return &crosspostCreated{} },
+	"Upvote":           func() interface{} { return &Upvote{} },
+	"Downvote":         func() interface{} { return &Downvote{} },
+	"ClearVote":        func() interface{} { return &ClearVote{} },
+	"AddModerator":     func() interface{} { return &AddModerator{} },
+	"RemoveModerator":  func() interface{} { return &RemoveModerator{} },
+	"BanUser":          func() interface{} { return &BanUser{} },
+	"UnbanUser":        func() interface{} { return &UnbanUser{} },
+	"RemovePost":       func() interface{} { return &RemovePost{} },
+	"RemoveComment":    func() interface{} { return &RemoveComment{} },
+	"EditPost":         func() interface{} { return &EditPost{} },
+	"DeletePost":       func() interface{} { return &DeletePost{} },
+	"EditComment":      func() interface{} { return &EditComment{} },
+	"DeleteComment":    func() interface{} { return &DeleteComment{} },
+	"SetBanner":        func() interface{} { return &SetBanner{} },
+}
+
+// handle dispatches a message to its handler. It is shared by live traffic and journal replay.
+func (sa *SubredditActor) handle(message interface{}, context actor.Context) {
+	switch msg := message.(type) {
+	case *actor.Started:
+		sa.publishIndex(context)
+		sa.announce(context)
+	case *JoinSubreddit:
+		sa.join(msg.Username, context)
+	case *LeaveSubreddit:
+		sa.leave(msg.Username, context)
+	case *CreatePost:
+		sa.createPost(msg, context)
+	case *CreateComment:
+		sa.createComment(msg, context)
+	case *Crosspost:
+		sa.crosspost(msg, context)
+	case *getSavedItems:
+		sa.getSavedItems(msg, context)
+	case *crosspostCreated:
+		sa.addCrosspost(msg)
+	case *Upvote:
+		sa.castVote(msg.UserID, msg.MediaType, msg.TargetID, VoteUp, context)
+	case *Downvote:
+		sa.castVote(msg.UserID, msg.MediaType, msg.TargetID, VoteDown, context)
+	case *ClearVote:
+		sa.castVote(msg.UserID, msg.MediaType, msg.TargetID, VoteNone, context)
+	case *GetPostComments:
+		sa.getPostComments(msg, context)
+	case *GetSubredditPosts:
+		sa.getPosts(msg, context)
+	case *GetSubredditMembers:
+		sa.getMembers(msg, context)
+	case *AddModerator:
+		sa.addModerator(msg, context)
+	case *RemoveModerator:
+		sa.removeModerator(msg, context)
+	case *BanUser:
+		sa.banUser(msg, context)
+	case *UnbanUser:
+		sa.unbanUser(msg, context)
+	case *RemovePost:
+		sa.removePost(msg, context)
+	case *RemoveComment:
+		sa.removeComment(msg, context)
+	case *GetModerators:
+		sa.getModerators(context)
+	case *SetBanner:
+		sa.setBanner(msg, context)
+	case *EditPost:
+		sa.editPost(msg, context)
+	case *DeletePost:
+		sa.deletePost(msg, context)
+	case *GetPost:
+		sa.getPost(msg, context)
+	case *GetPostRevisions:
+		if post, exists := sa.post(msg.PostID, context); exists {
+			context.Respond(success(postHistory(post)))
+		}
+	case *EditComment:
+		sa.editComment(msg, context)
+	case *DeleteComment:
+		sa.deleteComment(msg, context)
+	case *GetCommentRevisions:
+		if comment, exists := sa.comment(msg.CommentID, context); exists {
+			context.Respond(success(commentHistory(comment)))
+		}
+	}
+}
+
+// post returns the post with id. If there is none it replies CodePostNotFound
+// and reports false: the engine routes by its own index, which a crash
+// between the two journals can leave out of step with the subreddit.
+func (sa *SubredditActor) post(id string, context actor.Context) (*Post, bool) {
+	post, exists := sa.posts[id]
+	if !exists {
+		debugf("No such post with ID %s in subreddit %s\n", id, sa.subreddit.Name)
+		context.Respond(failure(CodePostNotFound, "No such post"))
+	}
+	return post, exists
+}
+
+// comment returns the comment with id, or replies CodeCommentNotFound and reports false.
+func (sa *SubredditActor) comment(id string, context actor.Context) (*Comment, bool) {
+	comment, exists := sa.comments[id]
+	if !exists {
+		debugf("No such comment with ID %s in subreddit %s\n", id, sa.subreddit.Name)
+		context.Respond(failure(CodeCommentNotFound, "No such comment"))
+	}
+	return comment, exists
+}
+
+// announce tells the engine what the subreddit holds once it has recovered.
+func (sa *SubredditActor) announce(context actor.Context) {
+	loaded := &subredditLoaded{
+		Subreddit: sa.subreddit.Name,
+		Banner:    sa.subreddit.Banner,
+		Posts:     make([]string, 0, len(sa.posts)),
+		Comments:  make(map[string]string, len(sa.comments)),
+		Karma:     make(map[string]karmaTotals),
+	}
+	karma := loaded.Karma
+	for _, post := range sa.posts {
+		loaded.Posts = append(loaded.Posts, post.ID)
+		karma[post.Author] = karma[post.Author].plus(karmaTotals{Post: post.Score()}, 1)
+	}
+	for _, comment := range sa.comments {
+		loaded.Comments[comment.ID] = comment.Post.ID
+		karma[comment.Author] = karma[comment.Author].plus(karmaTotals{Comment: comment.Score()}, 1)
+	}
+	context.Send(context.Parent(), loaded)
+}
+
+// join adds username to the members. Joining again is a no-op.
+func (sa *SubredditActor) join(username string, context actor.Context) {
+	if sa.banned(username) {
+		debugf("User %s is banned from subreddit %s\n", username, sa.subreddit.Name)
+		context.Respond(failure(CodeBanned, "You are banned from this subreddit"))
+		return
+	}
+	if _, member := sa.subreddit.Members[username]; member {
+		context.Respond(success(nil))
+		return
+	}
+	sa.subreddit.Members[username] = sa.now
+	sa.subreddit.Subscribers++
+	context.Send(context.Parent(), &membershipChanged{
+		Username:    username,
+		Subreddit:   sa.subreddit.Name,
+		Joined:      true,
+		Subscribers: sa.subreddit.Subscribers,
+	})
+	debugf("User %s joined subreddit %s\n", username, sa.subreddit.Name)
+	context.Respond(success(nil))
+}
+
+func (sa *SubredditActor) leave(username string, context actor.Context) {
+	if _, member := sa.subreddit.Members[username]; !member {
+		debugf("User %s is not a member of subreddit %s\n", username, sa.subreddit.Name)
+		context.Respond(failure(CodeForbidden, "Not a member of this subreddit"))
+		return
+	}
+	delete(sa.subreddit.Members, username)
+	sa.subreddit.Subscribers--
+	context.Send(context.Parent(), &membershipChanged{
+		Username:    username,
+		Subreddit:   sa.subreddit.Name,
+		Subscribers: sa.subreddit.Subscribers,
+	})
+	debugf("User %s left subreddit %s\n", username, sa.subreddit.Name)
+	context.Respond(success(nil))
+}
+
+// createPost stores a post the engine has already validated and given an ID, and
+// replies with its feed item.
+func (sa *SubredditActor) createPost(msg *CreatePost, context actor.Context) {
+	if sa.banned(msg.Author) {
+		debugf("User %s is banned from subreddit %s\n", msg.Author, sa.subreddit.Name)
+		context.Respond(failure(CodeBanned, "You are banned from this subreddit"))
+		return
+	}
+	if _, member := sa.subreddit.Members[msg.Author]; msg.CrosspostOf != nil && !member {
+		debugf("User %s is not a member of subreddit %s\n", msg.Author, sa.subreddit.Name)
+		context.Respond(failure(CodeForbidden, "Only members of r/%s can crosspost to it", sa.subreddit.Name))
+		return
+	}
+	post := &Post{
+		ID:          msg.ID,
+		Title:       msg.Title,
+		Content:     msg.Content,
+		Author:      msg.Author,
+		Subreddit:   sa.subreddit,
+		Kind:        msg.Kind,
+		URL:         msg.URL,
+		Images:      msg.Images,
+		CreatedAt:   sa.now,
+		CrosspostOf: msg.CrosspostOf,
+	}
+	if post.Kind == "" { // Journaled before posts had kinds.
+		post.Kind = KindText
+	}
+	post.Domain, _ = linkDomain(post.URL)
+	sa.posts[post.ID] = post
+	sa.subreddit.Posts = append(sa.subreddit.Posts, post)
+	context.Send(context.Parent(), &postCreated{ID: post.ID, Subreddit: sa.subreddit.Name})
+	context.Send(context.Parent(), &indexDocument{Doc: postDocument(post)})
+	if post.CrosspostOf != nil {
+		context.Send(context.Parent(), &crosspostCreated{
+			OriginalID: post.CrosspostOf.ID,
+			Crosspost:  CrosspostRef{ID: post.ID, Subreddit: sa.subreddit.Name, Author: post.Author, CreatedAt: post.CreatedAt},
+		})
+	}
+	members := make(map[string]bool, len(sa.subreddit.Members))
+	for username := range sa.subreddit.Members {
+		if username != post.Author {
+			members[username] = true
+		}
+	}
+	item := feedItem(post)
+	publish(context, &UserEvent{Recipients: members, Type: EventPost, Data: item})
+	notifyMentions(post.Content, "", Notification{From: post.Author, Subreddit: sa.subreddit.Name, PostID: post.ID, Body: post.Content}, context)
+	debugf("Created new post in subreddit %s by user %s with id %s\n", sa.subreddit.Name, msg.Author, post.ID)
+	context.Respond(success(&item))
+}
+
+// createComment stores a comment the engine has already validated and given an
+// ID, and replies with it as a comment node.
+func (sa *SubredditActor) createComment(msg *CreateComment, context actor.Context) {
+	if sa.banned(msg.Author) {
+		debugf("User %s is banned from subreddit %s\n", msg.Author, sa.subreddit.Name)
+		context.Respond(failure(CodeBanned, "You are banned from this subreddit"))
+		return
+	}
+	post, exists := sa.post(msg.PostID, context)
+	if !exists {
+		return
+	}
+	if post.Removal != nil {
+		context.Respond(failure(CodeForbidden, "The post has been removed"))
+		return
+	}
+	if post.Deleted {
+		context.Respond(failure(CodeForbidden, "The post has been deleted"))
+		return
+	}
+	var parent *Comment
+	if msg.ParentID != "" {
+		if parent, exists = sa.comment(msg.ParentID, context); !exists {
+			return
+		}
+		if parent.Deleted {
+			context.Respond(failure(CodeForbidden, "The parent comment has been deleted"))
+			return
+		}
+	}
+	comment := &Comment{
+		ID:        msg.ID,
+		Content:   msg.Content,
+		Author:    msg.Author,
+		Post:      post,
+		CreatedAt: sa.now,
+	}
+	repliedTo := post.Author
+	if parent != nil { // If it's a reply to another comment
+		parentId := parent.ID
+		comment.ParentID = &parentId
+		parent.Replies = append(parent.Replies, comment)
+		repliedTo = parent.Author
+	} else {
+		post.Comments = append(post.Comments, comment)
+	}
+	post.CommentCount++
+	sa.comments[comment.ID] = comment
+	context.Send(context.Parent(), &commentCreated{ID: comment.ID, PostID: post.ID})
+	context.Send(context.Parent(), &indexDocument{Doc: commentDocument(comment)})
+	if repliedTo != comment.Author {
+		publish(context, &UserEvent{Recipients: map[string]bool{repliedTo: true}, Type: EventReply, Data: &Reply{
+			CommentID: comment.ID,
+			PostID:    post.ID,
+			ParentID:  msg.ParentID,
+			Subreddit: sa.subreddit.Name,
+			Author:    comment.Author,
+			Content:   comment.Content,
+			CreatedAt: comment.CreatedAt,
+		}})
+	}
+	notification := Notification{
+		Type:      NotificationReply,
+		From:      comment.Author,
+		Subreddit: sa.subreddit.Name,
+		PostID:    post.ID,
+		CommentID: comment.ID,
+		Body:      comment.Content,
+	}
+	context.Send(context.Parent(), &notify{Recipients: []string{repliedTo}, Notification: notification})
+	notifyMentions(comment.Content, repliedTo, notification, context)
+	debugf("Created new comment on post %s by user %s with id %s\n", post.ID, msg.Author, comment.ID)
+	context.Respond(success(commentNode(comment)))
+}
+
+// castVote sets userId's vote on a post or comment. Repeating a vote is a no-op,
+// switching direction moves the vote between counters and VoteNone clears it.
+// The author's post or comment karma, kept by the engine, moves by the same
+// amount as the score.
+func (sa *SubredditActor) castVote(userId, mediaType, targetId string, vote VoteDirection, context actor.Context) {
+	var votes *Votes
+	var author string
+	switch mediaType {
+	case "Post":
+		post, exists := sa.posts[targetId]
+		if !exists {
+			debugf("No such Post with ID %s for vote\n", targetId)
+			context.Respond(failure(CodePostNotFound, "No such post"))
+			return
+		}
+		votes, author = &post.Votes, post.Author
+	case "Comment":
+		comment, exists := sa.comments[targetId]
+		if !exists {
+			debugf("No such comment with ID %s for vote\n", targetId)
+			context.Respond(failure(CodeCommentNotFound, "No such comment"))
+			return
+		}
+		votes, author = &comment.Votes, comment.Author
+	default:
+		debugf("Unknown media type %s for vote\n", mediaType)
+		context.Respond(failure(CodeInvalidRequest, "media_type must be Post or Comment"))
+		return
+	}
+
+	previous := votes.cast(userId, vote)
+	if delta := int(vote - previous); delta != 0 {
+		context.Send(context.Parent(), &karmaChanged{Username: author, Subreddit: sa.subreddit.Name, Comment: mediaType == "Comment", Delta: delta})
+		context.Send(context.Parent(), &documentScored{Type: strings.ToLower(mediaType), ID: targetId, Score: votes.Score()})
+	}
+	debugf("User %s voted %s on %s %s\n", userId, vote, mediaType, targetId)
+	context.Respond(success(&VoteResult{
+		MediaType: mediaType,
+		TargetID:  targetId,
+		Vote:      vote.String(),
+		Changed:   previous != vote,
+		Score:     votes.Score(),
+		Upvotes:   votes.Upvotes,
+		Downvotes: votes.Downvotes,
+	}))
+}
+
+// getPosts replies with the subreddit's posts that fall in the requested page,
+// ranked by msg.Sort with ties broken by creation time and then post ID.
+func (sa *SubredditActor) getPosts(msg *GetSubredditPosts, context actor.Context) {
+	var posts []*Post
+	for _, post := range sa.subreddit.Posts {
+		if post.Removal != nil || post.Deleted || post.CreatedAt.Before(msg.Since) || msg.Hidden[post.ID] {
+			continue
+		}
+		posts = append(posts, post)
+	}
+	sort.Slice(posts, func(i, j int) bool {
+		return postSortKey(posts[i], msg.Sort).before(postSortKey(posts[j], msg.Sort))
+	})
+
+	start, end := msg.Bounds.window(len(posts), func(i int) sortKey {
+		return postSortKey(posts[i], msg.Sort)
+	})
+	reply := &SubredditPosts{HasBefore: start > 0, HasAfter: end < len(posts)}
+	for _, post := range posts[start:end] {
+		reply.Posts = append(reply.Posts, rankedPost{FeedItem: feedItem(post), Key: postSortKey(post, msg.Sort)})
+	}
+	context.Respond(reply)
+}
+
+// feedItem summarises a post for feeds and stream events.
+func feedItem(post *Post) FeedItem {
+	item := FeedItem{
+		ID:             post.ID,
+		Title:          post.Title,
+		Subreddit:      post.Subreddit.Name,
+		Author:         post.Author,
+		Score:          post.Score(),
+		Upvotes:        post.Upvotes,
+		Downvotes:      post.Downvotes,
+		CommentCount:   post.CommentCount,
+		CreatedAt:      post.CreatedAt,
+		EditedAt:       post.EditedAt,
+		CrosspostOf:    post.CrosspostOf,
+		CrosspostCount: len(post.Crossposts),
+	}
+	renderKind(&item, post, false)
+	return item
+}
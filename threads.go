@@ -0,0 +1,190 @@
+package main
+
+import (
+	"sort"
+	"time"
+
+	"github.com/asynkron/protoactor-go/actor"
+)
+
+const (
+	defaultCommentDepth = 5
+	maxCommentDepth     = 10
+	defaultCommentLimit = 50
+	maxCommentLimit     = 200
+)
+
+func validCommentSort(order string) bool {
+	return order == "top" || order == "new" || order == "controversial"
+}
+
+func commentSortKey(comment *Comment, order string) sortKey {
+	key := sortKey{CreatedAt: comment.CreatedAt.UnixNano(), ID: comment.ID}
+	switch order {
+	case "top":
+		key.Rank = float64(comment.Score())
+	case "controversial":
+		key.Rank = controversy(comment.Upvotes, comment.Downvotes)
+	}
+	return key
+}
+
+// commentCursor is the decoded form of a "load more" continuation token.
+type commentCursor struct {
+	PostID   string   `json:"p"`
+	ParentID string   `json:"c,omitempty"` // Empty for top-level comments.
+	Sort     string   `json:"s"`
+	After    *sortKey `json:"a,omitempty"` // Last comment already returned at this level.
+}
+
+// CommentNode is one comment in a rendered thread.
+type CommentNode struct {
+	ID        string         `json:"id"`
+	Author    string         `json:"author"`
+	Content   string         `json:"content"`
+	ParentID  string         `json:"parent_id,omitempty"`
+	Score     int            `json:"score"`
+	Upvotes   int            `json:"upvotes"`
+	Downvotes int            `json:"downvotes"`
+	CreatedAt time.Time      `json:"created_at"`
+	EditedAt  *time.Time     `json:"edited_at,omitempty"`
+	Removed   bool           `json:"removed,omitempty"` // Removed by a moderator; the content is withheld.
+	Deleted   bool           `json:"deleted,omitempty"` // Deleted by its author.
+	Replies   []*CommentNode `json:"replies,omitempty"`
+	More      *MoreComments  `json:"more,omitempty"` // Replies not included because of the depth or per-level limit.
+}
+
+// MoreComments stands in for comments left out of a response.
+type MoreComments struct {
+	Count        int    `json:"count"`
+	Continuation string `json:"continuation"`
+}
+
+// CommentTree is the engine's reply to GetPostComments.
+type CommentTree struct {
+	PostID   string         `json:"post_id"`
+	ParentID string         `json:"parent_id,omitempty"` // Set when continuing below a comment.
+	Sort     string         `json:"sort"`
+	Comments []*CommentNode `json:"comments"`
+	More     *MoreComments  `json:"more,omitempty"`
+}
+
+func (sa *SubredditActor) getPostComments(msg *GetPostComments, context actor.Context) {
+	post, exists := sa.posts[msg.PostID]
+	if !exists {
+		debugf("No such post with ID %s\n", msg.PostID)
+		context.Respond(failure(CodePostNotFound, "No such post"))
+		return
+	}
+
+	cursor := commentCursor{PostID: post.ID, Sort: msg.Sort}
+	if msg.Continuation != "" {
+		if err := decodeCursor(msg.Continuation, &cursor); err != nil || cursor.PostID != post.ID {
+			debugf("Invalid continuation token for post %s\n", post.ID)
+			context.Respond(failure(CodeInvalidCursor, "Invalid continuation token"))
+			return
+		}
+	}
+	if cursor.Sort == "" {
+		cursor.Sort = "top"
+	}
+	if !validCommentSort(cursor.Sort) {
+		context.Respond(failure(CodeInvalidRequest, "sort must be top, new or controversial"))
+		return
+	}
+
+	replies := post.Comments
+	if cursor.ParentID != "" {
+		parent, exists := sa.comments[cursor.ParentID]
+		if !exists || parent.Post != post {
+			debugf("Invalid continuation token for post %s\n", post.ID)
+			context.Respond(failure(CodeInvalidCursor, "Invalid continuation token"))
+			return
+		}
+		replies = parent.Replies
+	}
+
+	depth := clamp(msg.Depth, defaultCommentDepth, maxCommentDepth)
+	limit := clamp(msg.Limit, defaultCommentLimit, maxCommentLimit)
+	nodes, more := buildCommentLevel(cursor, replies, depth, limit, msg.Hidden)
+	context.Respond(success(&CommentTree{
+		PostID:   post.ID,
+		ParentID: cursor.ParentID,
+		Sort:     cursor.Sort,
+		Comments: nodes,
+		More:     more,
+	}))
+}
+
+// buildCommentLevel renders up to limit replies after cursor.After, recursing
+// depth-1 more levels. Hidden comments are left out along with their replies.
+func buildCommentLevel(cursor commentCursor, replies []*Comment, depth, limit int, hidden map[string]bool) ([]*CommentNode, *MoreComments) {
+	sorted := make([]*Comment, 0, len(replies))
+	for _, reply := range replies {
+		if !hidden[reply.ID] {
+			sorted = append(sorted, reply)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return commentSortKey(sorted[i], cursor.Sort).before(commentSortKey(sorted[j], cursor.Sort))
+	})
+
+	start := 0
+	if cursor.After != nil {
+		start = sort.Search(len(sorted), func(i int) bool {
+			return cursor.After.before(commentSortKey(sorted[i], cursor.Sort))
+		})
+	}
+	end := start + limit
+	if end > len(sorted) {
+		end = len(sorted)
+	}
+
+	nodes := []*CommentNode{}
+	for _, comment := range sorted[start:end] {
+		node := commentNode(comment)
+		if len(comment.Replies) > 0 {
+			child := commentCursor{PostID: cursor.PostID, ParentID: comment.ID, Sort: cursor.Sort}
+			if depth > 1 {
+				node.Replies, node.More = buildCommentLevel(child, comment.Replies, depth-1, limit, hidden)
+			} else {
+				node.More = &MoreComments{Count: len(comment.Replies), Continuation: encodeCursor(child)}
+			}
+		}
+		nodes = append(nodes, node)
+	}
+
+	if end == len(sorted) {
+		return nodes, nil
+	}
+	last := commentSortKey(sorted[end-1], cursor.Sort)
+	next := commentCursor{PostID: cursor.PostID, ParentID: cursor.ParentID, Sort: cursor.Sort, After: &last}
+	return nodes, &MoreComments{Count: len(sorted) - end, Continuation: encodeCursor(next)}
+}
+
+// commentNode renders one comment without its replies, hiding the content of
+// removed and deleted comments.
+func commentNode(comment *Comment) *CommentNode {
+	node := &CommentNode{
+		ID:        comment.ID,
+		Author:    comment.Author,
+		Content:   comment.Content,
+		Score:     comment.Score(),
+		Upvotes:   comment.Upvotes,
+		Downvotes: comment.Downvotes,
+		CreatedAt: comment.CreatedAt,
+		EditedAt:  comment.EditedAt,
+	}
+	if comment.ParentID != nil {
+		node.ParentID = *comment.ParentID
+	}
+	if comment.Removal != nil {
+		node.Content = "[removed]"
+		node.Removed = true
+	}
+	if comment.Deleted {
+		node.Author, node.Content = deletedPlaceholder, deletedPlaceholder
+		node.Deleted = true
+	}
+	return node
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// commentIDs returns the IDs of nodes in order, with their replies in
+// parentheses after them.
+func commentIDs(nodes []*CommentNode) []string {
+	var ids []string
+	for _, node := range nodes {
+		ids = append(ids, node.ID)
+		if len(node.Replies) > 0 {
+			ids = append(ids, "(")
+			ids = append(ids, commentIDs(node.Replies)...)
+			ids = append(ids, ")")
+		}
+	}
+	return ids
+}
+
+func TestCommentParents(t *testing.T) {
+	e := startCommunity(t)
+	post := e.request(&CreatePost{Title: "Hello", Content: "World", Author: "alice", Subreddit: "golang"}).Data.(*FeedItem)
+	other := e.request(&CreatePost{Title: "Other", Content: "Post", Author: "alice", Subreddit: "golang"}).Data.(*FeedItem)
+	comment := e.request(&CreateComment{Content: "Hi", Author: "bob", PostID: post.ID}).Data.(*CommentNode)
+
+	reply := e.request(&CreateComment{Content: "Hello", Author: "carol", PostID: post.ID, ParentID: comment.ID}).Data.(*CommentNode)
+	if reply.ParentID != comment.ID {
+		t.Errorf("reply's parent = %q, want %s", reply.ParentID, comment.ID)
+	}
+	e.refuse(&CreateComment{Content: "Lost", Author: "carol", PostID: post.ID, ParentID: "nobody_comment_9"}, CodeCommentNotFound)
+	e.refuse(&CreateComment{Content: "Astray", Author: "carol", PostID: other.ID, ParentID: comment.ID}, CodeInvalidRequest)
+	e.refuse(&CreateComment{Content: "Nowhere", Author: "carol", PostID: "nobody_post_9"}, CodePostNotFound)
+}
+
+func TestPostComments(t *testing.T) {
+	e := startCommunity(t)
+	post := e.request(&CreatePost{Title: "Hello", Content: "World", Author: "alice", Subreddit: "golang"}).Data.(*FeedItem)
+	comment := func(author, parentID string) string {
+		return e.request(&CreateComment{Content: "Text", Author: author, PostID: post.ID, ParentID: parentID}).Data.(*CommentNode).ID
+	}
+	first := comment("bob", "")
+	reply := comment("carol", first)
+	nested := comment("alice", reply)
+	second := comment("carol", "")
+	third := comment("alice", "")
+	e.request(&Upvote{UserID: "alice", MediaType: "Comment", TargetID: second})
+	e.request(&Upvote{UserID: "bob", MediaType: "Comment", TargetID: second})
+	e.request(&Downvote{UserID: "bob", MediaType: "Comment", TargetID: third})
+	e.request(&Upvote{UserID: "carol", MediaType: "Comment", TargetID: first})
+	e.request(&Downvote{UserID: "alice", MediaType: "Comment", TargetID: first})
+
+	tests := []struct {
+		name string
+		msg  GetPostComments
+		want []string
+	}{
+		{name: "top by default", msg: GetPostComments{}, want: []string{second, first, "(", reply, "(", nested, ")", ")", third}},
+		{name: "new", msg: GetPostComments{Sort: "new"}, want: []string{third, second, first, "(", reply, "(", nested, ")", ")"}},
+		{name: "controversial", msg: GetPostComments{Sort: "controversial", Depth: 1}, want: []string{first, third, second}},
+		{name: "one level", msg: GetPostComments{Depth: 1}, want: []string{second, first, third}},
+		{name: "two levels", msg: GetPostComments{Depth: 2}, want: []string{second, first, "(", reply, ")", third}},
+		{name: "limited per level", msg: GetPostComments{Limit: 2}, want: []string{second, first, "(", reply, "(", nested, ")", ")"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.msg.PostID = post.ID
+			tree := e.request(&tt.msg).Data.(*CommentTree)
+			if got := commentIDs(tree.Comments); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("comments = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("load more at the end of a level", func(t *testing.T) {
+		tree := e.request(&GetPostComments{PostID: post.ID, Limit: 2, Depth: 1}).Data.(*CommentTree)
+		if tree.More == nil || tree.More.Count != 1 {
+			t.Fatalf("more = %+v, want 1 more comment", tree.More)
+		}
+		rest := e.request(&GetPostComments{PostID: post.ID, Continuation: tree.More.Continuation}).Data.(*CommentTree)
+		if got := commentIDs(rest.Comments); !reflect.DeepEqual(got, []string{third}) || rest.More != nil {
+			t.Errorf("continued = %v with more %+v, want [%s] and no more", got, rest.More, third)
+		}
+	})
+
+	t.Run("load more below the depth limit", func(t *testing.T) {
+		tree := e.request(&GetPostComments{PostID: post.ID, Depth: 2}).Data.(*CommentTree)
+		more := tree.Comments[1].Replies[0].More
+		if more == nil || more.Count != 1 {
+			t.Fatalf("more under %s = %+v, want 1 reply", reply, more)
+		}
+		rest := e.request(&GetPostComments{PostID: post.ID, Continuation: more.Continuation}).Data.(*CommentTree)
+		if rest.ParentID != reply || !reflect.DeepEqual(commentIDs(rest.Comments), []string{nested}) {
+			t.Errorf("continued under %q = %v, want [%s] under %s", rest.ParentID, commentIDs(rest.Comments), nested, reply)
+		}
+	})
+
+	t.Run("continuation for another post", func(t *testing.T) {
+		other := e.request(&CreatePost{Title: "Other", Content: "Post", Author: "alice", Subreddit: "golang"}).Data.(*FeedItem)
+		tree := e.request(&GetPostComments{PostID: post.ID, Limit: 1}).Data.(*CommentTree)
+		e.refuse(&GetPostComments{PostID: other.ID, Continuation: tree.More.Continuation}, CodeInvalidCursor)
+	})
+
+	e.refuse(&GetPostComments{PostID: post.ID, Sort: "best"}, CodeInvalidRequest)
+	e.refuse(&GetPostComments{PostID: post.ID, Continuation: "not a token!"}, CodeInvalidCursor)
+}